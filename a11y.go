@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A11ySettings configures the `a11y` command and test suite.
+//
+//	a11y:
+//	  routes: [/blog/hello-world]
+//	  fail-on: serious
+type A11ySettings struct {
+	// Routes are audited in addition to the static pages discovered in the
+	// app and pages directories; list concrete paths for dynamic routes.
+	Routes []string `yaml:"routes,omitempty"`
+	// FailOn is the lowest axe impact that fails the audit: minor,
+	// moderate, serious, or critical. Default: serious.
+	FailOn string `yaml:"fail-on,omitempty"`
+}
+
+// a11yImpacts ranks axe-core impacts from least to most severe.
+var a11yImpacts = []string{"minor", "moderate", "serious", "critical"}
+
+const defaultA11yFailOn = "serious"
+
+// a11yResultMarker prefixes the JSON line the audit script prints.
+const a11yResultMarker = "CODEFLY_A11Y "
+
+// a11yViolation is one element failing one axe rule on one route.
+type a11yViolation struct {
+	Route    string `json:"route"`
+	Rule     string `json:"rule"`
+	Impact   string `json:"impact"`
+	Help     string `json:"help"`
+	HelpURL  string `json:"help_url,omitempty"`
+	Selector string `json:"selector"`
+	HTML     string `json:"html,omitempty"`
+}
+
+type a11yRouteResult struct {
+	Route      string          `json:"route"`
+	Status     int             `json:"status,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Violations []a11yViolation `json:"violations"`
+}
+
+type a11yReport struct {
+	// Passed is false when a route failed to load or has a violation at or
+	// above FailOn.
+	Passed bool              `json:"passed"`
+	FailOn string            `json:"fail_on"`
+	Routes []a11yRouteResult `json:"routes"`
+}
+
+func (a A11ySettings) failOn() (string, error) {
+	if a.FailOn == "" {
+		return defaultA11yFailOn, nil
+	}
+	if a11yImpactRank(a.FailOn) < 0 {
+		return "", fmt.Errorf("a11y.fail-on must be one of %s, got %q", strings.Join(a11yImpacts, ", "), a.FailOn)
+	}
+	return a.FailOn, nil
+}
+
+func a11yImpactRank(impact string) int {
+	for rank, known := range a11yImpacts {
+		if impact == known {
+			return rank
+		}
+	}
+	return -1
+}
+
+// a11yRoutes returns the routes to audit: the requested ones, else every
+// static page the route analyzer found plus the configured routes. Dynamic
+// segments, parallel slots and intercepting routes have no URL of their own
+// to visit.
+func (a A11ySettings) a11yRoutes(requested []string, discovered []nextRoute) ([]string, error) {
+	routes := requested
+	if len(routes) == 0 {
+		for _, route := range discovered {
+			if route.Kind == nextRoutePage && len(route.Params) == 0 && route.Slot == "" && route.Intercepts == "" {
+				routes = append(routes, route.Pattern)
+			}
+		}
+		routes = append(routes, a.Routes...)
+	}
+	seen := map[string]bool{}
+	var unique []string
+	for _, route := range routes {
+		if !strings.HasPrefix(route, "/") {
+			return nil, fmt.Errorf("a11y route %q must be a path starting with /", route)
+		}
+		if !seen[route] {
+			seen[route] = true
+			unique = append(unique, route)
+		}
+	}
+	if len(unique) == 0 {
+		return nil, fmt.Errorf("no static pages to audit; list routes in a11y.routes")
+	}
+	sort.Strings(unique)
+	return unique, nil
+}
+
+// newA11yReport decodes the audit output and applies the failure impact.
+func newA11yReport(output, failOn string) (a11yReport, error) {
+	var routes []a11yRouteResult
+	if err := parseBrowserResult(output, a11yResultMarker, &routes); err != nil {
+		return a11yReport{}, err
+	}
+	report := a11yReport{Passed: true, FailOn: failOn, Routes: routes}
+	for i := range report.Routes {
+		route := &report.Routes[i]
+		if route.Violations == nil {
+			route.Violations = []a11yViolation{}
+		}
+		for j := range route.Violations {
+			route.Violations[j].Route = route.Route
+		}
+		if route.failed() || len(report.blocking(*route)) > 0 {
+			report.Passed = false
+		}
+	}
+	return report, nil
+}
+
+// failure explains why a route was not audited, or is empty if it was.
+func (r a11yRouteResult) failure() string {
+	switch {
+	case r.Error != "":
+		return r.Error
+	case r.Status >= 400:
+		return fmt.Sprintf("HTTP %d", r.Status)
+	default:
+		return ""
+	}
+}
+
+func (r a11yRouteResult) failed() bool {
+	return r.failure() != ""
+}
+
+// blocking returns the route's violations at or above FailOn, most severe
+// first. axe reports no impact for some best-practice rules; those never block.
+func (r a11yReport) blocking(route a11yRouteResult) []a11yViolation {
+	threshold := a11yImpactRank(r.FailOn)
+	var blocking []a11yViolation
+	for _, violation := range route.Violations {
+		if rank := a11yImpactRank(violation.Impact); rank >= 0 && rank >= threshold {
+			blocking = append(blocking, violation)
+		}
+	}
+	sort.SliceStable(blocking, func(i, j int) bool {
+		return a11yImpactRank(blocking[i].Impact) > a11yImpactRank(blocking[j].Impact)
+	})
+	return blocking
+}
+
+// evidence is one entry per failing route: why it failed, with the rule,
+// impact and selector of each blocking violation.
+func (r a11yReport) evidence() []string {
+	var evidence []string
+	for _, route := range r.Routes {
+		if route.failed() {
+			evidence = append(evidence, fmt.Sprintf("%s: not audited: %s", route.Route, route.failure()))
+			continue
+		}
+		blocking := r.blocking(route)
+		if len(blocking) == 0 {
+			continue
+		}
+		lines := []string{fmt.Sprintf("%s: %d violation(s) at or above %s", route.Route, len(blocking), r.FailOn)}
+		for _, violation := range blocking {
+			lines = append(lines, fmt.Sprintf("  [%s] %s: %s — %s", violation.Impact, violation.Rule, violation.Help, violation.Selector))
+		}
+		evidence = append(evidence, strings.Join(lines, "\n"))
+	}
+	return evidence
+}
+
+// failedRoutes counts routes that did not load or have blocking violations.
+func (r a11yReport) failedRoutes() int {
+	return len(r.evidence())
+}
+
+// summary is the test status message of the a11y suite.
+func (r a11yReport) summary() string {
+	if r.Passed {
+		return fmt.Sprintf("no accessibility issues at or above %s", r.FailOn)
+	}
+	return fmt.Sprintf("%d route(s) with accessibility issues at or above %s", r.failedRoutes(), r.FailOn)
+}
+
+func (r a11yReport) text() string {
+	var out strings.Builder
+	for _, route := range r.Routes {
+		switch {
+		case route.failed():
+			fmt.Fprintf(&out, "%s: not audited: %s\n", route.Route, route.failure())
+		case len(route.Violations) == 0:
+			fmt.Fprintf(&out, "%s: no violations\n", route.Route)
+		default:
+			fmt.Fprintf(&out, "%s: %d violation(s)\n", route.Route, len(route.Violations))
+			for _, violation := range route.Violations {
+				fmt.Fprintf(&out, "  [%s] %s: %s — %s\n", violation.Impact, violation.Rule, violation.Help, violation.Selector)
+			}
+		}
+	}
+	status := "PASSED"
+	if !r.Passed {
+		status = fmt.Sprintf("FAILED: %d route(s) with issues at or above %s", r.failedRoutes(), r.FailOn)
+	}
+	fmt.Fprintf(&out, "Accessibility %s", status)
+	return out.String()
+}
+
+func (r a11yReport) JSON() (string, error) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("encode accessibility report: %w", err)
+	}
+	return string(data), nil
+}
+
+// a11yAuditScript loads each route in headless Chromium through the
+// project's Playwright and runs axe-core from the project's node_modules
+// (directly, or as the dependency of @axe-core/playwright). CSP is bypassed
+// so axe can be injected into pages with a strict script policy.
+const a11yAuditScript = `const fs = require('fs');
+const path = require('path');
+const { chromium } = require('playwright');
+const request = JSON.parse(process.env.CODEFLY_A11Y_REQUEST);
+const resolveAxe = () => {
+  try { return require.resolve('axe-core/axe.min.js'); } catch (_) {}
+  try {
+    return require.resolve('axe-core/axe.min.js', { paths: [path.dirname(require.resolve('@axe-core/playwright'))] });
+  } catch (_) {}
+  throw new Error('axe-core is not installed: add axe-core or @axe-core/playwright to devDependencies');
+};
+const axeSource = fs.readFileSync(resolveAxe(), 'utf8');
+(async () => {
+  const browser = await chromium.launch();
+  const results = [];
+  try {
+    for (const route of request.routes) {
+      const context = await browser.newContext({ bypassCSP: true });
+      const page = await context.newPage();
+      const result = { route, violations: [] };
+      try {
+        const response = await page.goto(new URL(route, request.baseURL).href, { waitUntil: 'load', timeout: request.timeoutMs });
+        result.status = response ? response.status() : 0;
+        await page.waitForLoadState('networkidle', { timeout: request.timeoutMs }).catch(() => {});
+        await page.addScriptTag({ content: axeSource });
+        const axe = await page.evaluate(() => window.axe.run(document, { resultTypes: ['violations'] }));
+        for (const violation of axe.violations) {
+          for (const node of violation.nodes) {
+            result.violations.push({
+              rule: violation.id,
+              impact: node.impact || violation.impact || '',
+              help: violation.help,
+              help_url: violation.helpUrl,
+              selector: node.target.flat(Infinity).join(' >>> '),
+              html: node.html.slice(0, 300),
+            });
+          }
+        }
+      } catch (error) {
+        result.error = String(error && error.message ? error.message : error).split('\n')[0];
+      }
+      results.push(result);
+      await context.close();
+    }
+  } finally {
+    await browser.close();
+  }
+  console.log('` + a11yResultMarker + `' + JSON.stringify(results));
+})().catch((error) => {
+  console.error(error);
+  process.exit(1);
+});
+`
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const a11yFixtureResult = `[` +
+	`{"route": "/", "status": 200, "violations": [` +
+	`{"rule": "image-alt", "impact": "critical", "help": "Images must have alternate text", "help_url": "https://dequeuniversity.com/rules/axe/4.10/image-alt", "selector": "img.hero", "html": "<img class=\"hero\">"},` +
+	`{"rule": "region", "impact": "moderate", "help": "All page content should be contained by landmarks", "selector": "footer > p"},` +
+	`{"rule": "color-contrast", "impact": "serious", "help": "Elements must meet minimum color contrast ratio thresholds", "selector": "a.muted"}]},` +
+	`{"route": "/about", "status": 200, "violations": [` +
+	`{"rule": "landmark-one-main", "impact": "moderate", "help": "Document should have one main landmark", "selector": "html"}]},` +
+	`{"route": "/gone", "status": 404, "violations": []},` +
+	`{"route": "/down", "error": "page.goto: net::ERR_CONNECTION_REFUSED"}` +
+	`]`
+
+func TestA11yRoutesVisitStaticPagesAndConfiguredPaths(t *testing.T) {
+	discovered := []nextRoute{
+		{Pattern: "/", Kind: nextRoutePage},
+		{Pattern: "/", Kind: nextRouteLayout},
+		{Pattern: "/about", Kind: nextRoutePage},
+		{Pattern: "/blog/[slug]", Kind: nextRoutePage, Params: []nextRouteParam{{Name: "slug"}}},
+		{Pattern: "/feed", Kind: nextRoutePage, Slot: "analytics"},
+		{Pattern: "/photo/[id]", Kind: nextRoutePage, Intercepts: "(.)"},
+		{Pattern: "/api/healthz", Kind: nextRouteHandler},
+	}
+	settings := A11ySettings{Routes: []string{"/blog/hello", "/about"}}
+
+	routes, err := settings.a11yRoutes(nil, discovered)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/", "/about", "/blog/hello"}, routes)
+
+	routes, err = settings.a11yRoutes([]string{"/pricing"}, discovered)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/pricing"}, routes)
+
+	_, err = A11ySettings{}.a11yRoutes(nil, discovered[3:])
+	require.ErrorContains(t, err, "list routes in a11y.routes")
+	_, err = settings.a11yRoutes([]string{"pricing"}, nil)
+	require.ErrorContains(t, err, "must be a path")
+}
+
+func TestA11ySettingsValidateTheFailingImpact(t *testing.T) {
+	failOn, err := A11ySettings{}.failOn()
+	require.NoError(t, err)
+	require.Equal(t, "serious", failOn)
+	failOn, err = A11ySettings{FailOn: "moderate"}.failOn()
+	require.NoError(t, err)
+	require.Equal(t, "moderate", failOn)
+	_, err = A11ySettings{FailOn: "severe"}.failOn()
+	require.ErrorContains(t, err, "minor, moderate, serious, critical")
+}
+
+func TestA11yReportFailsOnSeriousAndCriticalViolationsWithEvidence(t *testing.T) {
+	report, err := newA11yReport("axe noise\n"+a11yResultMarker+a11yFixtureResult+"\n", "serious")
+	require.NoError(t, err)
+	require.False(t, report.Passed)
+	require.Equal(t, "/", report.Routes[0].Violations[0].Route, "violations carry their route")
+	require.NotNil(t, report.Routes[2].Violations)
+
+	evidence := report.evidence()
+	require.Len(t, evidence, 3, "/about only has moderate issues")
+	require.Equal(t, strings.Join([]string{
+		"/: 2 violation(s) at or above serious",
+		"  [critical] image-alt: Images must have alternate text — img.hero",
+		"  [serious] color-contrast: Elements must meet minimum color contrast ratio thresholds — a.muted",
+	}, "\n"), evidence[0])
+	require.Equal(t, "/gone: not audited: HTTP 404", evidence[1])
+	require.Equal(t, "/down: not audited: page.goto: net::ERR_CONNECTION_REFUSED", evidence[2])
+
+	text := report.text()
+	require.Contains(t, text, "/about: 1 violation(s)\n  [moderate] landmark-one-main")
+	require.Contains(t, text, "Accessibility FAILED: 3 route(s) with issues at or above serious")
+
+	encoded, err := report.JSON()
+	require.NoError(t, err)
+	var decoded a11yReport
+	require.NoError(t, json.Unmarshal([]byte(encoded), &decoded))
+	require.Equal(t, "img.hero", decoded.Routes[0].Violations[0].Selector)
+}
+
+func TestA11yReportPassesBelowTheFailingImpact(t *testing.T) {
+	result := `[{"route": "/about", "status": 200, "violations": [{"rule": "region", "impact": "moderate", "help": "Landmarks", "selector": "p"}]}]`
+	report, err := newA11yReport(a11yResultMarker+result, "serious")
+	require.NoError(t, err)
+	require.True(t, report.Passed)
+	require.Empty(t, report.evidence())
+	require.True(t, strings.HasSuffix(report.text(), "Accessibility PASSED"))
+
+	strict, err := newA11yReport(a11yResultMarker+result, "minor")
+	require.NoError(t, err)
+	require.False(t, strict.Passed)
+}
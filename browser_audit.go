@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// browserAuditTimeoutMs bounds each route's navigation and network idle.
+const browserAuditTimeoutMs = 30000
+
+// browserAuditRequest is the JSON the audit scripts read from their request
+// environment variable. Passing it as data keeps route strings out of the
+// script source.
+type browserAuditRequest struct {
+	BaseURL   string   `json:"baseURL"`
+	Routes    []string `json:"routes"`
+	TimeoutMs int      `json:"timeoutMs"`
+}
+
+func newBrowserAuditRequest(baseURL string, routes []string) browserAuditRequest {
+	return browserAuditRequest{BaseURL: baseURL, Routes: routes, TimeoutMs: browserAuditTimeoutMs}
+}
+
+// parseBrowserResult decodes the last output line starting with marker. The
+// audit scripts print their result on one marked line, so Playwright or
+// Next.js noise on stdout cannot be mistaken for it.
+func parseBrowserResult(output, marker string, target any) error {
+	var result string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, marker) {
+			result = strings.TrimPrefix(line, marker)
+		}
+	}
+	if result == "" {
+		return fmt.Errorf("browser audit printed no result")
+	}
+	if err := json.Unmarshal([]byte(result), target); err != nil {
+		return fmt.Errorf("parse browser audit result: %w", err)
+	}
+	return nil
+}
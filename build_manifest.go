@@ -0,0 +1,304 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	nextBuildStatic  = "static"
+	nextBuildISR     = "isr"
+	nextBuildDynamic = "dynamic"
+)
+
+// errNoNextBuild means the source tree has no production build to read.
+var errNoNextBuild = errors.New("no Next.js production build found")
+
+// nextBuildRoute is one route as the production build resolved it.
+type nextBuildRoute struct {
+	Route  string        `json:"route"`
+	Router string        `json:"router"`
+	Kind   nextRouteKind `json:"kind"`
+	// Rendering is static (prerendered once), isr (prerendered and
+	// revalidated every RevalidateSeconds), or dynamic (rendered per request).
+	Rendering         string `json:"rendering"`
+	RevalidateSeconds int    `json:"revalidate_seconds,omitempty"`
+	// Prerendered lists the concrete paths built for a dynamic route.
+	Prerendered []string `json:"prerendered,omitempty"`
+	// FirstLoadJS is the gzip size of the JavaScript a first visit loads,
+	// measured the way `next build` reports it.
+	FirstLoadJS int64 `json:"first_load_js_bytes,omitempty"`
+}
+
+// nextBuildManifest is the authoritative route table of a production build.
+type nextBuildManifest struct {
+	BuildID string           `json:"build_id"`
+	Routes  []nextBuildRoute `json:"routes"`
+	// TotalStaticJS is the gzip size of every chunk under .next/static/chunks.
+	TotalStaticJS int64 `json:"total_static_js_bytes"`
+}
+
+type nextRoutesManifestFile struct {
+	StaticRoutes  []struct{ Page string } `json:"staticRoutes"`
+	DynamicRoutes []struct{ Page string } `json:"dynamicRoutes"`
+}
+
+type nextPrerenderManifestFile struct {
+	Routes map[string]struct {
+		// initialRevalidateSeconds is false for a never-revalidated page;
+		// newer releases also write initialRevalidate.
+		InitialRevalidateSeconds any     `json:"initialRevalidateSeconds"`
+		InitialRevalidate        any     `json:"initialRevalidate"`
+		SrcRoute                 *string `json:"srcRoute"`
+	} `json:"routes"`
+	DynamicRoutes map[string]json.RawMessage `json:"dynamicRoutes"`
+}
+
+type nextChunkManifestFile struct {
+	Pages         map[string][]string `json:"pages"`
+	RootMainFiles []string            `json:"rootMainFiles"`
+}
+
+// readNextBuildManifest reads the manifests `next build` leaves under .next:
+// routes-manifest.json for the route list, app-path-routes-manifest.json for
+// App Router entries, prerender-manifest.json for static/ISR output, and
+// build-manifest.json plus app-build-manifest.json for first-load chunks.
+func readNextBuildManifest(sourceDir string) (*nextBuildManifest, error) {
+	dir := filepath.Join(sourceDir, ".next")
+	var routesFile nextRoutesManifestFile
+	if err := readNextManifest(dir, "routes-manifest.json", &routesFile); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w in %s", errNoNextBuild, sourceDir)
+		}
+		return nil, err
+	}
+	appPaths := map[string]string{}
+	var prerender nextPrerenderManifestFile
+	var chunks, appChunks nextChunkManifestFile
+	for name, target := range map[string]any{
+		"app-path-routes-manifest.json": &appPaths,
+		"prerender-manifest.json":       &prerender,
+		"build-manifest.json":           &chunks,
+		"app-build-manifest.json":       &appChunks,
+	} {
+		if err := readNextManifest(dir, name, target); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	buildID, _ := os.ReadFile(filepath.Join(dir, "BUILD_ID"))
+	manifest := &nextBuildManifest{BuildID: strings.TrimSpace(string(buildID))}
+
+	// app-path-routes-manifest maps entries such as /blog/[slug]/page to
+	// their route; invert it to find a route's App Router entry.
+	appEntries := map[string]string{}
+	for entry, route := range appPaths {
+		appEntries[route] = entry
+	}
+	sizes := nextChunkSizes{dir: dir, cache: map[string]int64{}}
+	seen := map[string]bool{}
+	for _, page := range append(routesFile.StaticRoutes, routesFile.DynamicRoutes...) {
+		if seen[page.Page] || strings.HasPrefix(page.Page, "/_") {
+			continue
+		}
+		seen[page.Page] = true
+		route := nextBuildRoute{Route: page.Page, Router: "pages", Kind: nextRoutePage, Rendering: nextBuildDynamic}
+		var files []string
+		if entry, ok := appEntries[page.Page]; ok {
+			route.Router = "app"
+			if strings.HasSuffix(entry, "/route") {
+				route.Kind = nextRouteHandler
+			} else {
+				files = append(append(files, appChunks.Pages[entry]...), chunks.RootMainFiles...)
+			}
+		} else if page.Page == "/api" || strings.HasPrefix(page.Page, "/api/") {
+			route.Kind = nextRouteHandler
+		} else {
+			files = append(append(files, chunks.Pages[page.Page]...), chunks.Pages["/_app"]...)
+		}
+		if len(files) > 0 {
+			size, err := sizes.total(files)
+			if err != nil {
+				return nil, err
+			}
+			route.FirstLoadJS = size
+		}
+		prerenderRoute(&route, prerender)
+		manifest.Routes = append(manifest.Routes, route)
+	}
+	sort.Slice(manifest.Routes, func(i, j int) bool { return manifest.Routes[i].Route < manifest.Routes[j].Route })
+
+	var chunkFiles []string
+	err := filepath.WalkDir(filepath.Join(dir, "static", "chunks"), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		chunkFiles = append(chunkFiles, filepath.ToSlash(relative))
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("list Next.js static chunks: %w", err)
+	}
+	if manifest.TotalStaticJS, err = sizes.total(chunkFiles); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// prerenderRoute classifies a route from the prerender manifest: the route
+// itself or concrete paths generated from it were built ahead of time.
+func prerenderRoute(route *nextBuildRoute, prerender nextPrerenderManifestFile) {
+	revalidate := 0
+	prerendered := false
+	for path, entry := range prerender.Routes {
+		generated := entry.SrcRoute != nil && *entry.SrcRoute == route.Route && path != route.Route
+		if path != route.Route && !generated {
+			continue
+		}
+		prerendered = true
+		if generated {
+			route.Prerendered = append(route.Prerendered, path)
+		}
+		seconds := nextRevalidateSeconds(entry.InitialRevalidateSeconds)
+		if seconds == 0 {
+			seconds = nextRevalidateSeconds(entry.InitialRevalidate)
+		}
+		if seconds > 0 && (revalidate == 0 || seconds < revalidate) {
+			revalidate = seconds
+		}
+	}
+	if _, ok := prerender.DynamicRoutes[route.Route]; ok {
+		prerendered = true
+	}
+	sort.Strings(route.Prerendered)
+	switch {
+	case !prerendered:
+		route.Rendering = nextBuildDynamic
+	case revalidate > 0:
+		route.Rendering, route.RevalidateSeconds = nextBuildISR, revalidate
+	default:
+		route.Rendering = nextBuildStatic
+	}
+}
+
+func nextRevalidateSeconds(value any) int {
+	if seconds, ok := value.(float64); ok && seconds > 0 {
+		return int(seconds)
+	}
+	return 0
+}
+
+func readNextManifest(dir, name string, target any) error {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("parse .next/%s: %w", name, err)
+	}
+	return nil
+}
+
+// nextChunkSizes measures gzip sizes of build chunks, each file once.
+type nextChunkSizes struct {
+	dir   string
+	cache map[string]int64
+}
+
+func (c nextChunkSizes) total(files []string) (int64, error) {
+	var total int64
+	counted := map[string]bool{}
+	for _, file := range files {
+		if counted[file] || !strings.HasSuffix(file, ".js") {
+			continue
+		}
+		counted[file] = true
+		size, ok := c.cache[file]
+		if !ok {
+			var err error
+			size, err = gzipSize(filepath.Join(c.dir, filepath.FromSlash(file)))
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+			c.cache[file] = size
+		}
+		total += size
+	}
+	return total, nil
+}
+
+func gzipSize(path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	var counter byteCounter
+	writer := gzip.NewWriter(&counter)
+	if _, err := io.Copy(writer, file); err != nil {
+		return 0, fmt.Errorf("measure %s: %w", path, err)
+	}
+	if err := writer.Close(); err != nil {
+		return 0, fmt.Errorf("measure %s: %w", path, err)
+	}
+	return int64(counter), nil
+}
+
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+// text renders the manifest like the `next build` route summary.
+func (m *nextBuildManifest) text() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "Build %s routes (%d):\n", m.BuildID, len(m.Routes))
+	table := tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "Route\tKind\tRendering\tFirst Load JS")
+	for _, route := range m.Routes {
+		rendering := route.Rendering
+		if route.Rendering == nextBuildISR {
+			rendering = fmt.Sprintf("isr (%ds)", route.RevalidateSeconds)
+		}
+		if len(route.Prerendered) > 0 {
+			rendering += fmt.Sprintf(", %d prerendered", len(route.Prerendered))
+		}
+		size := "-"
+		if route.FirstLoadJS > 0 {
+			size = formatKilobytes(route.FirstLoadJS)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", route.Route, route.Kind, rendering, size)
+	}
+	_ = table.Flush()
+	fmt.Fprintf(&out, "Total static JS: %s\n", formatKilobytes(m.TotalStaticJS))
+	return strings.TrimRight(out.String(), "\n")
+}
+
+func (m *nextBuildManifest) JSON() (string, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("encode build manifest: %w", err)
+	}
+	return string(data), nil
+}
+
+func formatKilobytes(size int64) string {
+	return fmt.Sprintf("%.1f kB", float64(size)/1000)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func gzipLength(t *testing.T, content string) int64 {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	_, err := writer.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return int64(buffer.Len())
+}
+
+func TestReadNextBuildManifestClassifiesRoutesAndMeasuresFirstLoadJS(t *testing.T) {
+	source := t.TempDir()
+	random := rand.New(rand.NewSource(1))
+	chunk := func(size int) string {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte('a' + random.Intn(26))
+		}
+		return string(data)
+	}
+	mainApp, home, post, framework, legacy := chunk(4000), chunk(900), chunk(1200), chunk(3000), chunk(700)
+	for name, content := range map[string]string{
+		".next/BUILD_ID": "b1d\n",
+		".next/routes-manifest.json": `{
+			"version": 3,
+			"staticRoutes": [{"page": "/"}, {"page": "/_not-found"}, {"page": "/api/healthz"}, {"page": "/legacy"}],
+			"dynamicRoutes": [{"page": "/blog/[slug]"}, {"page": "/profile/[id]"}]
+		}`,
+		".next/app-path-routes-manifest.json": `{
+			"/page": "/",
+			"/_not-found/page": "/_not-found",
+			"/api/healthz/route": "/api/healthz",
+			"/blog/[slug]/page": "/blog/[slug]",
+			"/profile/[id]/page": "/profile/[id]"
+		}`,
+		".next/prerender-manifest.json": `{
+			"version": 4,
+			"routes": {
+				"/": {"initialRevalidateSeconds": false, "srcRoute": "/"},
+				"/api/healthz": {"initialRevalidateSeconds": false, "srcRoute": "/api/healthz"},
+				"/blog/hello": {"initialRevalidateSeconds": 60, "srcRoute": "/blog/[slug]"},
+				"/blog/world": {"initialRevalidateSeconds": 60, "srcRoute": "/blog/[slug]"}
+			},
+			"dynamicRoutes": {"/blog/[slug]": {"fallback": null}}
+		}`,
+		".next/build-manifest.json": `{
+			"rootMainFiles": ["static/chunks/main-app.js", "static/chunks/missing.js"],
+			"pages": {"/_app": ["static/chunks/framework.js", "static/css/app.css"], "/legacy": ["static/chunks/pages/legacy.js"]}
+		}`,
+		".next/app-build-manifest.json": `{
+			"pages": {
+				"/page": ["static/chunks/main-app.js", "static/chunks/app/page.js"],
+				"/blog/[slug]/page": ["static/chunks/app/blog/page.js"]
+			}
+		}`,
+		".next/static/chunks/main-app.js":      mainApp,
+		".next/static/chunks/app/page.js":      home,
+		".next/static/chunks/app/blog/page.js": post,
+		".next/static/chunks/framework.js":     framework,
+		".next/static/chunks/pages/legacy.js":  legacy,
+		".next/static/css/app.css":             chunk(5000),
+	} {
+		writeProductionTestFile(t, source, name, content)
+	}
+
+	manifest, err := readNextBuildManifest(source)
+	require.NoError(t, err)
+	require.Equal(t, "b1d", manifest.BuildID)
+	require.Equal(t, []nextBuildRoute{
+		{Route: "/", Router: "app", Kind: nextRoutePage, Rendering: nextBuildStatic,
+			FirstLoadJS: gzipLength(t, mainApp) + gzipLength(t, home)},
+		{Route: "/api/healthz", Router: "app", Kind: nextRouteHandler, Rendering: nextBuildStatic},
+		{Route: "/blog/[slug]", Router: "app", Kind: nextRoutePage, Rendering: nextBuildISR, RevalidateSeconds: 60,
+			Prerendered: []string{"/blog/hello", "/blog/world"},
+			FirstLoadJS: gzipLength(t, post) + gzipLength(t, mainApp)},
+		{Route: "/legacy", Router: "pages", Kind: nextRoutePage, Rendering: nextBuildDynamic,
+			FirstLoadJS: gzipLength(t, legacy) + gzipLength(t, framework)},
+		{Route: "/profile/[id]", Router: "app", Kind: nextRoutePage, Rendering: nextBuildDynamic,
+			FirstLoadJS: gzipLength(t, mainApp)},
+	}, manifest.Routes)
+	require.Equal(t, gzipLength(t, mainApp)+gzipLength(t, home)+gzipLength(t, post)+gzipLength(t, framework)+gzipLength(t, legacy),
+		manifest.TotalStaticJS, "every chunk once, CSS excluded")
+
+	text := manifest.text()
+	require.Contains(t, text, "Build b1d routes (5):")
+	require.Regexp(t, `/blog/\[slug\]\s+page\s+isr \(60s\), 2 prerendered\s+\d+\.\d kB`, text)
+	require.Regexp(t, `/api/healthz\s+route-handler\s+static\s+-`, text)
+	require.Contains(t, text, "Total static JS: ")
+
+	encoded, err := manifest.JSON()
+	require.NoError(t, err)
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal([]byte(encoded), &decoded))
+	require.Len(t, decoded["routes"], 5)
+}
+
+func TestReadNextBuildManifestReportsAMissingBuild(t *testing.T) {
+	_, err := readNextBuildManifest(t.TempDir())
+	require.ErrorIs(t, err, errNoNextBuild)
+
+	source := t.TempDir()
+	writeProductionTestFile(t, source, ".next/routes-manifest.json", "{not json")
+	_, err = readNextBuildManifest(source)
+	require.ErrorContains(t, err, "parse .next/routes-manifest.json")
+}
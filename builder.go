@@ -8,6 +8,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 
@@ -36,6 +37,9 @@ type Builder struct {
 	answers map[string]*agentv0.Answer
 
 	relativeToWorkspace string
+
+	// workspaceConfigs hold the private registry tokens of image builds.
+	workspaceConfigs []*v0.Configuration
 }
 
 func NewBuilder(service *Service) *Builder {
@@ -91,6 +95,7 @@ func (s *Builder) Init(ctx context.Context, req *builderv0.InitRequest) (*builde
 	s.Builder.LogInitRequest(req)
 
 	s.DependencyEndpoints = req.DependenciesEndpoints
+	s.workspaceConfigs = dropNilConfigs(req.WorkspaceConfigurations)
 
 	return s.Builder.InitResponse()
 }
@@ -285,8 +290,115 @@ func generatedFiles(root string) (map[string]generatedFile, error) {
 type DockerTemplating struct {
 	NodeImage string
 	Static    bool
+
+	// PackageManager is the detected manager kind: npm, pnpm, yarn, or bun.
+	PackageManager string
+	// Lockfile is copied beside package.json before the frozen install.
+	Lockfile string
+	// Corepack enables the pnpm/Yarn shims pinned by package.json. Without a
+	// packageManager field Corepack falls back to the version bundled with the
+	// digest-pinned Node image, so the toolchain stays reproducible either way.
+	Corepack bool
+	// BunVersion pins the Bun toolchain installed into the build stages.
+	BunVersion string
+	// ManagerFiles are optional install inputs beside package.json, such as
+	// pnpm-workspace.yaml or .yarnrc.yml.
+	ManagerFiles []string
+	// YarnDirectory copies .yarn (releases and plugins) for Yarn Berry.
+	YarnDirectory bool
+	// InstallCommand and BuildCommand are rendered from the same manager
+	// contract the runtime uses.
+	InstallCommand string
+	BuildCommand   string
+	// RegistrySecret mounts the npmrc BuildKit secret for the install, so
+	// private registry tokens never reach a layer.
+	RegistrySecret bool
+
+	// Readiness is the JSON readiness contract baked into the SSR image as
+	// the Kubernetes probe script.
+	Readiness string
+}
+
+// defaultBunVersion pins the Bun toolchain for projects whose package.json
+// does not declare packageManager: bun@<version>.
+const defaultBunVersion = "1.2.21"
+
+// newDockerTemplating resolves the image build inputs from the same package
+// manager detection the runtime uses. An image build is always a frozen
+// install: a project without a committed lockfile fails here instead of
+// producing an image from a floating dependency graph.
+func newDockerTemplating(sourceDir string, settings *Settings) (DockerTemplating, error) {
+	manifest, err := readNodePackageManifest(sourceDir)
+	if err != nil {
+		return DockerTemplating{}, err
+	}
+	manager, err := detectNodePackageManager(sourceDir, settings.PackageManager, manifest)
+	if err != nil {
+		return DockerTemplating{}, err
+	}
+	if manager.Lockfile == "" {
+		return DockerTemplating{}, fmt.Errorf(
+			"%s image builds require a committed lockfile; run %s and commit the result",
+			manager.Kind,
+			manager.describe("install"),
+		)
+	}
+	contract, err := settings.ReadinessContract()
+	if err != nil {
+		return DockerTemplating{}, err
+	}
+	readiness, err := contract.script()
+	if err != nil {
+		return DockerTemplating{}, err
+	}
+	docker := DockerTemplating{
+		Readiness:      readiness,
+		NodeImage:      NodeImage,
+		Static:         settings.IsStatic(),
+		PackageManager: string(manager.Kind),
+		Lockfile:       manager.Lockfile,
+		InstallCommand: manager.describe(manager.installArgs()...),
+		BuildCommand:   manager.describe(manager.runScriptArgs("build")...),
+	}
+	switch manager.Kind {
+	case nodePackageManagerPNPM, nodePackageManagerYarn:
+		docker.Corepack = true
+	case nodePackageManagerBun:
+		docker.BunVersion = manager.Version
+		if docker.BunVersion == "" {
+			docker.BunVersion = defaultBunVersion
+		}
+	}
+	if settings.Registry.configured() {
+		if err := settings.Registry.validate(manager.Kind); err != nil {
+			return DockerTemplating{}, err
+		}
+		docker.RegistrySecret = true
+	}
+	for _, name := range nodeDependencyInputs {
+		if fileExists(filepath.Join(sourceDir, name)) {
+			docker.ManagerFiles = append(docker.ManagerFiles, name)
+		}
+	}
+	if manager.Kind == nodePackageManagerYarn && manager.Berry {
+		// The image stages hand node_modules from the install to the build
+		// stage, and Next.js standalone output traces real files; Plug'n'Play
+		// has neither.
+		yarnrc, _ := os.ReadFile(filepath.Join(sourceDir, ".yarnrc.yml"))
+		if !yarnNodeModulesLinker.Match(yarnrc) {
+			return DockerTemplating{}, fmt.Errorf("Yarn Berry image builds require nodeLinker: node-modules in .yarnrc.yml")
+		}
+		if info, err := os.Stat(filepath.Join(sourceDir, ".yarn")); err == nil && info.IsDir() {
+			docker.YarnDirectory = true
+		}
+	}
+	return docker, nil
 }
 
+// yarnNodeModulesLinker finds the .yarnrc.yml setting that installs into
+// node_modules instead of Plug'n'Play.
+var yarnNodeModulesLinker = regexp.MustCompile(`(?m)^nodeLinker:\s*["']?node-modules`)
+
 // NodeImage matches the tested SaaS Starter frontend build substrate. Keeping
 // the digest here makes agent-generated builds reproducible instead of silently
 // changing whenever a floating node:24-alpine tag moves.
@@ -308,21 +420,31 @@ func (s *Builder) Build(ctx context.Context, req *builderv0.BuildRequest) (*buil
 		return s.Builder.BuildError(fmt.Errorf("invalid docker image name: %s", image.Name))
 	}
 
-	docker := DockerTemplating{
-		NodeImage: NodeImage,
-		Static:    s.Settings.IsStatic(),
-	}
-
-	err = shared.DeleteFile(ctx, s.Local("builder/Dockerfile"))
+	docker, err := newDockerTemplating(s.Local("%s", s.Settings.NodeSourceDir()), s.Settings)
 	if err != nil {
 		return s.Builder.BuildError(err)
 	}
 
+	for _, generated := range []string{"builder/Dockerfile", "builder/readiness.mjs"} {
+		err = shared.DeleteFile(ctx, s.Local("%s", generated))
+		if err != nil {
+			return s.Builder.BuildError(err)
+		}
+	}
+
 	err = s.Templates(ctx, docker, services.WithBuilder(builderFS))
 	if err != nil {
 		return s.Builder.BuildError(err)
 	}
 
+	if docker.RegistrySecret {
+		if err := s.buildWithRegistrySecret(ctx, image); err != nil {
+			return s.Builder.BuildError(err)
+		}
+		s.Builder.WithDockerImages(image)
+		return s.Builder.BuildResponse()
+	}
+
 	builder, err := dockerhelpers.NewBuilder(dockerhelpers.BuilderConfiguration{
 		Root:        s.Location,
 		Dockerfile:  "builder/Dockerfile",
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// BundleBudgetSettings caps what the production build ships to the browser.
+// Runtime.Build checks them against the build manifests after `next build`
+// and fails when a route or the whole chunk set is over budget. Sizes are
+// gzip kilobytes (1 kB = 1000 bytes), as `next build` reports them.
+//
+//	bundle-budgets:
+//	  max-total-static-kb: 900
+//	  routes:
+//	    - route: /dashboard/**
+//	      max-first-load-kb: 250
+//	    - route: "**"
+//	      max-first-load-kb: 150
+type BundleBudgetSettings struct {
+	// MaxTotalStaticKB bounds every chunk under .next/static/chunks.
+	MaxTotalStaticKB float64 `yaml:"max-total-static-kb,omitempty"`
+	// Routes bound first-load JS per route. A route is checked against the
+	// first budget whose glob matches it.
+	Routes []RouteBundleBudget `yaml:"routes,omitempty"`
+}
+
+type RouteBundleBudget struct {
+	// Route is a glob over route patterns: `*` matches one segment, `**`
+	// any number of segments, so /blog/* matches /blog/[slug].
+	Route          string  `yaml:"route"`
+	MaxFirstLoadKB float64 `yaml:"max-first-load-kb"`
+}
+
+const (
+	bundleBudgetFirstLoad   = "first-load-js"
+	bundleBudgetTotalStatic = "total-static-js"
+)
+
+// bundleBudgetViolation is one route, or the chunk total, over its budget.
+type bundleBudgetViolation struct {
+	// Route is empty for the total static chunk budget.
+	Route  string `json:"route,omitempty"`
+	Budget string `json:"budget,omitempty"`
+	Metric string `json:"metric"`
+	Limit  int64  `json:"limit_bytes"`
+	Actual int64  `json:"actual_bytes"`
+}
+
+func (v bundleBudgetViolation) Delta() int64 {
+	return v.Actual - v.Limit
+}
+
+func (v bundleBudgetViolation) String() string {
+	subject := "total static JS"
+	if v.Route != "" {
+		subject = fmt.Sprintf("%s first-load JS (budget %s)", v.Route, v.Budget)
+	}
+	return fmt.Sprintf("%s: %s > %s (+%s)", subject,
+		formatKilobytes(v.Actual), formatKilobytes(v.Limit), formatKilobytes(v.Delta()))
+}
+
+// bundleBudgetError fails a build that exceeds its bundle budgets.
+type bundleBudgetError struct {
+	Violations []bundleBudgetViolation
+}
+
+func (e *bundleBudgetError) Error() string {
+	lines := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		lines = append(lines, violation.String())
+	}
+	return fmt.Sprintf("%d bundle budget(s) exceeded:\n  %s", len(e.Violations), strings.Join(lines, "\n  "))
+}
+
+func (b BundleBudgetSettings) empty() bool {
+	return b.MaxTotalStaticKB == 0 && len(b.Routes) == 0
+}
+
+func (b BundleBudgetSettings) validate() error {
+	if b.MaxTotalStaticKB < 0 {
+		return fmt.Errorf("bundle-budgets.max-total-static-kb must not be negative")
+	}
+	for i, budget := range b.Routes {
+		if budget.Route == "" {
+			return fmt.Errorf("bundle-budgets.routes[%d].route is required", i)
+		}
+		if _, err := path.Match(budget.Route, ""); err != nil {
+			return fmt.Errorf("bundle-budgets.routes[%d].route %q: %w", i, budget.Route, err)
+		}
+		if budget.MaxFirstLoadKB <= 0 {
+			return fmt.Errorf("bundle-budgets.routes[%d].max-first-load-kb must be positive", i)
+		}
+	}
+	return nil
+}
+
+// check returns the budgets the build exceeds, or nil. The settings were
+// validated at Load. Route handlers ship no browser JavaScript and are never
+// over a first-load budget.
+func (b BundleBudgetSettings) check(manifest *nextBuildManifest) error {
+	var violations []bundleBudgetViolation
+	for _, route := range manifest.Routes {
+		for _, budget := range b.Routes {
+			if !matchRouteGlob(budget.Route, route.Route) {
+				continue
+			}
+			if limit := kilobytes(budget.MaxFirstLoadKB); route.FirstLoadJS > limit {
+				violations = append(violations, bundleBudgetViolation{
+					Route: route.Route, Budget: budget.Route, Metric: bundleBudgetFirstLoad,
+					Limit: limit, Actual: route.FirstLoadJS,
+				})
+			}
+			break
+		}
+	}
+	if b.MaxTotalStaticKB > 0 {
+		if limit := kilobytes(b.MaxTotalStaticKB); manifest.TotalStaticJS > limit {
+			violations = append(violations, bundleBudgetViolation{
+				Metric: bundleBudgetTotalStatic, Limit: limit, Actual: manifest.TotalStaticJS,
+			})
+		}
+	}
+	if len(violations) > 0 {
+		return &bundleBudgetError{Violations: violations}
+	}
+	return nil
+}
+
+func kilobytes(value float64) int64 {
+	return int64(value * 1000)
+}
+
+// matchRouteGlob matches a route pattern such as /blog/[slug] segment by
+// segment. A bracketed glob segment names a dynamic segment literally rather
+// than a character class, so /blog/[slug] budgets exactly that route.
+func matchRouteGlob(glob, route string) bool {
+	return matchRouteSegments(splitRoute(glob), splitRoute(route))
+}
+
+func matchRouteSegments(glob, route []string) bool {
+	if len(glob) == 0 {
+		return len(route) == 0
+	}
+	if glob[0] == "**" {
+		for skip := 0; skip <= len(route); skip++ {
+			if matchRouteSegments(glob[1:], route[skip:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(route) == 0 {
+		return false
+	}
+	if isDynamicSegment(glob[0]) {
+		if glob[0] != route[0] {
+			return false
+		}
+	} else if matched, err := path.Match(glob[0], route[0]); err != nil || !matched {
+		return false
+	}
+	return matchRouteSegments(glob[1:], route[1:])
+}
+
+func isDynamicSegment(segment string) bool {
+	return strings.HasPrefix(segment, "[") && strings.HasSuffix(segment, "]")
+}
+
+func splitRoute(route string) []string {
+	trimmed := strings.Trim(route, "/")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "/")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMatchRouteGlob(t *testing.T) {
+	for _, tc := range []struct {
+		glob, route string
+		matches     bool
+	}{
+		{"/dashboard/**", "/dashboard", true},
+		{"/dashboard/**", "/dashboard/settings/[tab]", true},
+		{"/dashboard/*", "/dashboard/settings/[tab]", false},
+		{"/blog/*", "/blog/[slug]", true},
+		{"/blog/[slug]", "/blog/[slug]", true},
+		{"/blog/[slug]", "/blog/s", false},
+		{"**", "/", true},
+		{"*", "/", false},
+		{"/", "/", true},
+		{"/docs-*/**", "/docs-v2/[[...path]]", true},
+	} {
+		require.Equal(t, tc.matches, matchRouteGlob(tc.glob, tc.route), "%s ~ %s", tc.glob, tc.route)
+	}
+}
+
+func TestBundleBudgetsReportOffendingRoutesWithTheirDelta(t *testing.T) {
+	var settings Settings
+	require.NoError(t, yaml.Unmarshal([]byte(`
+bundle-budgets:
+  max-total-static-kb: 500
+  routes:
+    - route: /dashboard/**
+      max-first-load-kb: 250
+    - route: "**"
+      max-first-load-kb: 100
+`), &settings))
+
+	manifest := &nextBuildManifest{
+		TotalStaticJS: 612_500,
+		Routes: []nextBuildRoute{
+			{Route: "/", FirstLoadJS: 95_000},
+			{Route: "/api/healthz", Kind: nextRouteHandler},
+			{Route: "/dashboard/[team]", FirstLoadJS: 310_200},
+			{Route: "/dashboard/settings", FirstLoadJS: 240_000},
+			{Route: "/pricing", FirstLoadJS: 101_000},
+		},
+	}
+	err := settings.BundleBudgets.check(manifest)
+	var exceeded *bundleBudgetError
+	require.True(t, errors.As(err, &exceeded))
+	require.Equal(t, []bundleBudgetViolation{
+		{Route: "/dashboard/[team]", Budget: "/dashboard/**", Metric: bundleBudgetFirstLoad, Limit: 250_000, Actual: 310_200},
+		{Route: "/pricing", Budget: "**", Metric: bundleBudgetFirstLoad, Limit: 100_000, Actual: 101_000},
+		{Metric: bundleBudgetTotalStatic, Limit: 500_000, Actual: 612_500},
+	}, exceeded.Violations)
+	require.Equal(t, int64(60_200), exceeded.Violations[0].Delta())
+	require.Contains(t, err.Error(), "3 bundle budget(s) exceeded")
+	require.Contains(t, err.Error(), "/dashboard/[team] first-load JS (budget /dashboard/**): 310.2 kB > 250.0 kB (+60.2 kB)")
+	require.Contains(t, err.Error(), "total static JS: 612.5 kB > 500.0 kB (+112.5 kB)")
+
+	manifest.TotalStaticJS = 400_000
+	manifest.Routes = manifest.Routes[:2]
+	require.NoError(t, settings.BundleBudgets.check(manifest))
+}
+
+func TestBundleBudgetsRejectInvalidSettings(t *testing.T) {
+	require.True(t, BundleBudgetSettings{}.empty())
+	require.NoError(t, BundleBudgetSettings{}.validate())
+	require.ErrorContains(t, BundleBudgetSettings{Routes: []RouteBundleBudget{{MaxFirstLoadKB: 1}}}.validate(), "route is required")
+	require.ErrorContains(t, BundleBudgetSettings{Routes: []RouteBundleBudget{{Route: "/"}}}.validate(), "must be positive")
+	require.ErrorContains(t, BundleBudgetSettings{Routes: []RouteBundleBudget{{Route: "/[", MaxFirstLoadKB: 1}}}.validate(), "syntax error")
+	require.ErrorContains(t, BundleBudgetSettings{MaxTotalStaticKB: -1}.validate(), "must not be negative")
+}
@@ -110,6 +110,7 @@ func nodeProjectLanguage(sourceFiles []*codev0.SourceFileInfo) string {
 }
 
 type nodePackageManifest struct {
+	PackageManager  string            `json:"packageManager"`
 	Scripts         map[string]string `json:"scripts"`
 	Dependencies    map[string]string `json:"dependencies"`
 	DevDependencies map[string]string `json:"devDependencies"`
@@ -147,14 +148,19 @@ func (c *Code) fixTypeScript(ctx context.Context, input corecode.FixInput) (core
 	if err != nil {
 		return corecode.FixResult{}, err
 	}
+	manager, err := detectNodePackageManager(c.sourceDir(), c.Settings.PackageManager, manifest)
+	if err != nil {
+		return corecode.FixResult{}, err
+	}
 	env := c.runnerEnvironment(ctx)
 
 	if manifest.hasDependency("@biomejs/biome") {
-		args := []string{"exec", "--offline", "--", "biome", "check", "--stdin-file-path", input.Path, "--write"}
+		args := manager.execArgs("biome", "check", "--stdin-file-path", input.Path, "--write")
 		if input.Mode == basev0.FixMode_FIX_MODE_AGGRESSIVE {
 			args = append(args, "--unsafe")
 		}
-		fixed, diagnostics, runErr := runners.RunInput(ctx, env, c.sourceDir(), input.Content, "npm", args...)
+		command, commandArgs := manager.command(args...)
+		fixed, diagnostics, runErr := runners.RunInput(ctx, env, c.sourceDir(), input.Content, command, commandArgs...)
 		if runErr != nil && len(fixed) == 0 {
 			return corecode.FixResult{}, fmt.Errorf("biome check: %w: %s", runErr, strings.TrimSpace(string(diagnostics)))
 		}
@@ -172,8 +178,8 @@ func (c *Code) fixTypeScript(ctx context.Context, input corecode.FixInput) (core
 	var actions []string
 	var output []string
 	if manifest.hasDependency("eslint") || manifest.Scripts["lint"] != "" {
-		args := []string{"exec", "--offline", "--", "eslint", "--fix-dry-run", "--stdin", "--stdin-filename", input.Path, "--format", "json"}
-		jsonOutput, diagnostics, runErr := runners.RunInput(ctx, env, c.sourceDir(), fixed, "npm", args...)
+		command, args := manager.command(manager.execArgs("eslint", "--fix-dry-run", "--stdin", "--stdin-filename", input.Path, "--format", "json")...)
+		jsonOutput, diagnostics, runErr := runners.RunInput(ctx, env, c.sourceDir(), fixed, command, args...)
 		parsed, parseErr := parseESLintFix(jsonOutput, fixed)
 		if parseErr != nil {
 			return corecode.FixResult{}, fmt.Errorf("eslint --fix-dry-run: %w (run error: %v): %s", parseErr, runErr, strings.TrimSpace(string(diagnostics)))
@@ -186,7 +192,8 @@ func (c *Code) fixTypeScript(ctx context.Context, input corecode.FixInput) (core
 		}
 	}
 	if manifest.hasDependency("prettier") {
-		formatted, diagnostics, runErr := runners.RunInput(ctx, env, c.sourceDir(), fixed, "npm", "exec", "--offline", "--", "prettier", "--stdin-filepath", input.Path)
+		command, args := manager.command(manager.execArgs("prettier", "--stdin-filepath", input.Path)...)
+		formatted, diagnostics, runErr := runners.RunInput(ctx, env, c.sourceDir(), fixed, command, args...)
 		if runErr != nil {
 			return corecode.FixResult{}, fmt.Errorf("prettier: %w: %s", runErr, strings.TrimSpace(string(diagnostics)))
 		}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Commands declare their arguments as a Go struct. Each exported field is one
+// argument named by its json tag, and callers may pass either one JSON object
+//
+//	perf {"routes": ["/", "/pricing"], "json": true}
+//
+// or flags, as --name value, --name=value, or a bare --name for booleans:
+//
+//	perf / /pricing --json
+//
+// Flag names accept dashes for underscores (--wait-for sets wait_for). A
+// field tagged `cmd:"positional"` takes the arguments that are not flags.
+// Slices of scalars repeat the flag; other structured fields take a JSON
+// value. Unknown arguments are errors, never passed through.
+
+// noCommandArgs is the schema of commands that take no arguments.
+type noCommandArgs struct{}
+
+// commandArgsValidator is implemented by argument structs that check their
+// values after decoding.
+type commandArgsValidator interface {
+	validate() error
+}
+
+// decodeCommandArgs decodes command arguments into target, a pointer to an
+// argument struct, then runs its validation.
+func decodeCommandArgs(args []string, target any) error {
+	joined := strings.TrimSpace(strings.Join(args, " "))
+	if strings.HasPrefix(joined, "{") {
+		decoder := json.NewDecoder(strings.NewReader(joined))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(target); err != nil {
+			return fmt.Errorf("invalid JSON arguments: %w", err)
+		}
+		if decoder.More() {
+			return fmt.Errorf("invalid JSON arguments: expected a single object")
+		}
+	} else if err := decodeCommandFlags(args, reflect.ValueOf(target).Elem()); err != nil {
+		return err
+	}
+	if validator, ok := target.(commandArgsValidator); ok {
+		return validator.validate()
+	}
+	return nil
+}
+
+type commandArgField struct {
+	name       string
+	index      int
+	positional bool
+}
+
+func commandArgFields(t reflect.Type) []commandArgField {
+	var fields []commandArgField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, commandArgField{name: name, index: i, positional: field.Tag.Get("cmd") == "positional"})
+	}
+	return fields
+}
+
+func decodeCommandFlags(args []string, target reflect.Value) error {
+	fields := commandArgFields(target.Type())
+	byName := map[string]commandArgField{}
+	var positional *commandArgField
+	for i, field := range fields {
+		byName[field.name] = field
+		if field.positional {
+			positional = &fields[i]
+		}
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "--") {
+			if positional == nil {
+				return fmt.Errorf("unexpected argument %q; %s", arg, acceptedCommandArgs(fields))
+			}
+			if err := setCommandArg(target.Field(positional.index), positional.name, arg); err != nil {
+				return err
+			}
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		field, ok := byName[strings.ReplaceAll(name, "-", "_")]
+		if !ok {
+			return fmt.Errorf("unknown argument --%s; %s", name, acceptedCommandArgs(fields))
+		}
+		destination := target.Field(field.index)
+		if !hasValue {
+			if isBoolArg(destination.Type()) {
+				value = "true"
+			} else if i+1 < len(args) {
+				i++
+				value = args[i]
+			} else {
+				return fmt.Errorf("--%s needs a value", name)
+			}
+		}
+		if err := setCommandArg(destination, field.name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isBoolArg(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Bool
+}
+
+// setCommandArg parses one flag value into a field. A scalar flag given
+// twice keeps the last value; a slice flag appends.
+func setCommandArg(field reflect.Value, name, value string) error {
+	switch field.Kind() {
+	case reflect.Pointer:
+		if field.Type().Elem().Kind() != reflect.Struct {
+			element := reflect.New(field.Type().Elem())
+			if err := setCommandArg(element.Elem(), name, value); err != nil {
+				return err
+			}
+			field.Set(element)
+			return nil
+		}
+	case reflect.String:
+		field.SetString(value)
+		return nil
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false, got %q", name, value)
+		}
+		field.SetBool(parsed)
+		return nil
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s must be an integer, got %q", name, value)
+		}
+		field.SetInt(parsed)
+		return nil
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s must be a number, got %q", name, value)
+		}
+		field.SetFloat(parsed)
+		return nil
+	case reflect.Slice:
+		if isScalarArg(field.Type().Elem()) {
+			element := reflect.New(field.Type().Elem()).Elem()
+			if err := setCommandArg(element, name, value); err != nil {
+				return err
+			}
+			field.Set(reflect.Append(field, element))
+			return nil
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(value)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(field.Addr().Interface()); err != nil {
+		return fmt.Errorf("%s must be JSON for %s: %w", name, field.Type(), err)
+	}
+	return nil
+}
+
+func isScalarArg(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int32, reflect.Int64, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+func acceptedCommandArgs(fields []commandArgField) string {
+	if len(fields) == 0 {
+		return "this command takes no arguments"
+	}
+	names := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field.positional {
+			names = append(names, "<"+field.name+">")
+			continue
+		}
+		names = append(names, "--"+strings.ReplaceAll(field.name, "_", "-"))
+	}
+	sort.Strings(names)
+	return "accepted: " + strings.Join(names, ", ")
+}
+
+// commandArgsSchema describes an argument type as JSON Schema.
+func commandArgsSchema(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := map[string]any{}
+		for _, field := range commandArgFields(t) {
+			properties[field.name] = commandArgsSchema(t.Field(field.index).Type)
+		}
+		return map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": commandArgsSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": commandArgsSchema(t.Elem())}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	default:
+		return map[string]any{}
+	}
+}
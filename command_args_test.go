@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	agentv0 "github.com/codefly-dev/core/generated/go/codefly/services/agent/v0"
+	"github.com/stretchr/testify/require"
+)
+
+type sampleCommandArgs struct {
+	Routes  []string          `json:"routes" cmd:"positional"`
+	WaitFor string            `json:"wait_for"`
+	Workers int               `json:"workers"`
+	Ratio   float64           `json:"ratio"`
+	JSON    bool              `json:"json"`
+	Headed  *bool             `json:"headed"`
+	Tags    []string          `json:"tags"`
+	Labels  map[string]string `json:"labels"`
+	ignored string
+}
+
+func (a sampleCommandArgs) validate() error {
+	if a.Workers > 8 {
+		return fmt.Errorf("workers must be at most 8")
+	}
+	return nil
+}
+
+func TestDecodeCommandArgsAcceptsFlags(t *testing.T) {
+	var args sampleCommandArgs
+	require.NoError(t, decodeCommandArgs([]string{
+		"/", "--wait-for", "main h1", "/pricing", "--workers=4", "--json",
+		"--headed=false", "--ratio", "0.5", "--tags", "a", "--tags", "b",
+		"--labels", `{"team": "web"}`,
+	}, &args))
+	require.Equal(t, []string{"/", "/pricing"}, args.Routes)
+	require.Equal(t, "main h1", args.WaitFor)
+	require.Equal(t, 4, args.Workers)
+	require.Equal(t, 0.5, args.Ratio)
+	require.True(t, args.JSON)
+	require.False(t, *args.Headed)
+	require.Equal(t, []string{"a", "b"}, args.Tags)
+	require.Equal(t, map[string]string{"team": "web"}, args.Labels)
+}
+
+func TestDecodeCommandArgsAcceptsOneJSONObject(t *testing.T) {
+	var args sampleCommandArgs
+	require.NoError(t, decodeCommandArgs([]string{`{"routes": ["/"],`, `"wait_for": "main", "headed": true}`}, &args))
+	require.Equal(t, []string{"/"}, args.Routes)
+	require.Equal(t, "main", args.WaitFor)
+	require.True(t, *args.Headed)
+
+	require.ErrorContains(t, decodeCommandArgs([]string{`{"route": "/"}`}, &sampleCommandArgs{}), `unknown field "route"`)
+	require.ErrorContains(t, decodeCommandArgs([]string{`{"json": true} {}`}, &sampleCommandArgs{}), "expected a single object")
+	require.ErrorContains(t, decodeCommandArgs([]string{`{"workers": "two"}`}, &sampleCommandArgs{}), "invalid JSON arguments")
+}
+
+func TestDecodeCommandArgsRejectsWhatTheSchemaDoesNotDeclare(t *testing.T) {
+	err := decodeCommandArgs([]string{"--verbose"}, &sampleCommandArgs{})
+	require.ErrorContains(t, err, "unknown argument --verbose")
+	require.ErrorContains(t, err, "--wait-for")
+	require.ErrorContains(t, err, "<routes>")
+
+	require.ErrorContains(t, decodeCommandArgs([]string{"--workers", "two"}, &sampleCommandArgs{}), "workers must be an integer")
+	require.ErrorContains(t, decodeCommandArgs([]string{"--json=maybe"}, &sampleCommandArgs{}), "json must be true or false")
+	require.ErrorContains(t, decodeCommandArgs([]string{"--wait-for"}, &sampleCommandArgs{}), "--wait-for needs a value")
+	require.ErrorContains(t, decodeCommandArgs([]string{"--labels", "team"}, &sampleCommandArgs{}), "labels must be JSON")
+	require.ErrorContains(t, decodeCommandArgs([]string{"--workers", "9"}, &sampleCommandArgs{}), "workers must be at most 8")
+	require.ErrorContains(t, decodeCommandArgs([]string{`{"workers": 9}`}, &sampleCommandArgs{}), "workers must be at most 8")
+
+	require.NoError(t, decodeCommandArgs(nil, &noCommandArgs{}))
+	require.ErrorContains(t, decodeCommandArgs([]string{"now"}, &noCommandArgs{}), "this command takes no arguments")
+	require.ErrorContains(t, decodeCommandArgs([]string{`{"now": true}`}, &noCommandArgs{}), `unknown field "now"`)
+}
+
+func TestCommandArgsSchemaDescribesTheArgumentStruct(t *testing.T) {
+	encoded, err := json.Marshal(commandArgsSchema(reflect.TypeOf(sampleCommandArgs{})))
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"type": "object",
+		"additionalProperties": false,
+		"properties": {
+			"routes": {"type": "array", "items": {"type": "string"}},
+			"wait_for": {"type": "string"},
+			"workers": {"type": "integer"},
+			"ratio": {"type": "number"},
+			"json": {"type": "boolean"},
+			"headed": {"type": "boolean"},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"labels": {"type": "object", "additionalProperties": {"type": "string"}}
+		}
+	}`, string(encoded))
+
+	viewports := commandArgsSchema(reflect.TypeOf(screenshotRequest{}))["properties"].(map[string]any)["viewports"]
+	require.Equal(t, map[string]any{"type": "array", "items": map[string]any{
+		"type": "object", "additionalProperties": false, "properties": map[string]any{
+			"name": map[string]any{"type": "string"}, "width": map[string]any{"type": "integer"}, "height": map[string]any{"type": "integer"},
+		},
+	}}, viewports)
+}
+
+func TestPublishCommandSchemaAppendsItToTheUsage(t *testing.T) {
+	definition := &agentv0.CommandDefinition{Name: "perf", Usage: `perf {"routes": ["/"]}`}
+	publishCommandSchema(definition, `{"type":"object"}`)
+	require.Equal(t, "perf {\"routes\": [\"/\"]}\nArguments (JSON Schema): {\"type\":\"object\"}", definition.Usage)
+
+	bare := &agentv0.CommandDefinition{Name: "prefetch"}
+	publishCommandSchema(bare, `{"type":"object"}`)
+	require.Equal(t, `Arguments (JSON Schema): {"type":"object"}`, bare.Usage)
+}
+
+func TestPlaywrightArgsBuildTheTestInvocation(t *testing.T) {
+	var args playwrightArgs
+	require.NoError(t, decodeCommandArgs([]string{"tests/e2e", "--grep", "checkout", "--workers", "2", "--headed"}, &args))
+	require.Equal(t, []string{"test", "tests/e2e", "--grep", "checkout", "--workers", "2", "--headed"}, args.testArgs())
+	require.Equal(t, []string{"test"}, playwrightArgs{}.testArgs())
+	require.ErrorContains(t, decodeCommandArgs([]string{"--workers=-1"}, &playwrightArgs{}), "workers must not be negative")
+	require.ErrorContains(t, decodeCommandArgs([]string{"--reporter", "list"}, &playwrightArgs{}), "unknown argument --reporter")
+}
@@ -3,131 +3,291 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"strings"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
 
 	agentv0 "github.com/codefly-dev/core/generated/go/codefly/services/agent/v0"
 	"github.com/codefly-dev/core/resources"
+	"github.com/codefly-dev/core/runners/javascript"
+	"github.com/codefly-dev/core/wool"
 )
 
 // registerCommands registers agent-specific commands.
 // NOTE: test and lint are standard Runtime RPCs — don't duplicate here.
 func (s *Runtime) registerCommands() {
-	s.RegisterCommand(&agentv0.CommandDefinition{
+	registerTypedCommand(s, &agentv0.CommandDefinition{
 		Name:        "screenshot",
-		Description: "Take a screenshot of the running frontend (requires Playwright)",
-		Usage:       `screenshot {"path": "output.png", "url": "/"}`,
+		Description: "Screenshot the running frontend with Playwright at viewports or an emulated device, in chromium, firefox or webkit; returns the written files and their dimensions",
+		Usage:       `screenshot {"url": "/", "path": "output.png", "viewports": [{"name": "mobile", "width": 390, "height": 844}], "device": "", "browser": "chromium", "wait_for": "", "color_scheme": "dark", "selector": "", "full_page": true}`,
 		Tags:        []string{"ui", "testing", "visual"},
 	}, s.cmdScreenshot)
 
-	s.RegisterCommand(&agentv0.CommandDefinition{
+	registerTypedCommand(s, &agentv0.CommandDefinition{
 		Name:        "health",
-		Description: "Check if the Next.js frontend is responding",
+		Description: "Check the running Next.js frontend against the readiness contract",
 		Tags:        []string{"health", "diagnostic"},
 	}, s.cmdHealth)
 
-	s.RegisterCommand(&agentv0.CommandDefinition{
+	registerTypedCommand(s, &agentv0.CommandDefinition{
+		Name:        "diagnostics",
+		Description: "List the compile and runtime errors the running Next.js server currently reports",
+		Tags:        []string{"diagnostic", "errors"},
+	}, s.cmdDiagnostics)
+
+	registerTypedCommand(s, &agentv0.CommandDefinition{
 		Name:        "routes",
-		Description: "List all page routes in the Next.js app",
+		Description: "List the App Router and Pages Router route table: pages, route handlers and their methods, layouts, and middleware",
+		Usage:       `routes {"json": true}`,
 		Tags:        []string{"info", "routing"},
 	}, s.cmdRoutes)
 
-	s.RegisterCommand(&agentv0.CommandDefinition{
+	registerTypedCommand(s, &agentv0.CommandDefinition{
+		Name:        "build-manifest",
+		Description: "List the routes of the last production build: static, ISR (with revalidate interval) or dynamic, and first-load JS size",
+		Usage:       `build-manifest {"json": true}`,
+		Tags:        []string{"info", "routing", "build"},
+	}, s.cmdBuildManifest)
+
+	registerTypedCommand(s, &agentv0.CommandDefinition{
+		Name:        "perf",
+		Description: "Audit routes in headless Chromium: TTFB, FCP, LCP, CLS, TBT, INP, transfer size and request count, checked against perf thresholds",
+		Usage:       `perf {"routes": ["/", "/pricing"], "json": false}`,
+		Tags:        []string{"testing", "performance", "browser"},
+	}, s.cmdPerf)
+
+	registerTypedCommand(s, &agentv0.CommandDefinition{
+		Name:        "a11y",
+		Description: "Audit routes with axe-core in headless Chromium and list violations by rule, impact, selector and route",
+		Usage:       `a11y {"routes": ["/"], "json": false}`,
+		Tags:        []string{"testing", "accessibility", "browser"},
+	}, s.cmdA11y)
+
+	registerTypedCommand(s, &agentv0.CommandDefinition{
+		Name:        "visual",
+		Description: "Screenshot routes at the configured viewports and pixel-diff them against .codefly/visual-baselines; --update accepts new baselines",
+		Usage:       `visual {"routes": ["/"], "update": false, "json": false}`,
+		Tags:        []string{"ui", "testing", "visual"},
+	}, s.cmdVisual)
+
+	registerTypedCommand(s, &agentv0.CommandDefinition{
 		Name:        "playwright",
-		Description: "Run Playwright end-to-end tests",
-		Usage:       `playwright {"target": "tests/e2e", "headed": false}`,
+		Description: "Run Playwright end-to-end tests; returns counts, duration and failures with per-test status and retries, and traces, videos and screenshots collected under .codefly/playwright-artifacts/<run-id>",
+		Usage:       `playwright {"target": "tests/e2e", "headed": false, "grep": "checkout", "project": "chromium", "workers": 2}`,
 		Tags:        []string{"testing", "e2e", "browser"},
 	}, s.cmdPlaywright)
+
+	registerTypedCommand(s, &agentv0.CommandDefinition{
+		Name:        "prefetch",
+		Description: "Fill the offline package cache with every tarball of package-lock.json it does not hold yet, so offline installs need no registry",
+		Tags:        []string{"dependencies", "offline"},
+	}, s.cmdPrefetch)
 }
 
-func (s *Runtime) cmdScreenshot(ctx context.Context, args []string) (string, error) {
-	if s.runner == nil {
-		return "", fmt.Errorf("frontend is not running")
+// jsonOutputArgs selects JSON instead of the text report.
+type jsonOutputArgs struct {
+	JSON bool `json:"json"`
+}
+
+// routeAuditArgs are the arguments of the browser audits; routes default to
+// the command's settings.
+type routeAuditArgs struct {
+	Routes []string `json:"routes" cmd:"positional"`
+	JSON   bool     `json:"json"`
+}
+
+type visualArgs struct {
+	Routes []string `json:"routes" cmd:"positional"`
+	// Update accepts the screenshots as the new baselines.
+	Update bool `json:"update"`
+	JSON   bool `json:"json"`
+}
+
+// playwrightArgs select which Playwright tests run and how.
+type playwrightArgs struct {
+	// Target is a test file or directory filter.
+	Target  string `json:"target" cmd:"positional"`
+	Headed  bool   `json:"headed"`
+	Grep    string `json:"grep"`
+	Project string `json:"project"`
+	Workers int    `json:"workers"`
+}
+
+func (a playwrightArgs) validate() error {
+	if a.Workers < 0 {
+		return fmt.Errorf("workers must not be negative")
 	}
+	return nil
+}
 
-	outputPath := "screenshot.png"
-	targetURL := "/"
-	for i, arg := range args {
-		if arg == "--path" && i+1 < len(args) {
-			outputPath = args[i+1]
-		}
-		if arg == "--url" && i+1 < len(args) {
-			targetURL = args[i+1]
+func (a playwrightArgs) testArgs() []string {
+	args := []string{"test"}
+	if a.Target != "" {
+		args = append(args, a.Target)
+	}
+	if a.Grep != "" {
+		args = append(args, "--grep", a.Grep)
+	}
+	if a.Project != "" {
+		args = append(args, "--project", a.Project)
+	}
+	if a.Workers > 0 {
+		args = append(args, "--workers", fmt.Sprintf("%d", a.Workers))
+	}
+	if a.Headed {
+		args = append(args, "--headed")
+	}
+	return args
+}
+
+// registerTypedCommand registers a command whose arguments decode into A and
+// publishes A's JSON Schema in the definition. A schema that does not encode
+// is a bug in A, so it panics at registration rather than going unpublished.
+func registerTypedCommand[A any](s *Runtime, definition *agentv0.CommandDefinition, run func(context.Context, A) (string, error)) {
+	var zero A
+	schema, err := json.Marshal(commandArgsSchema(reflect.TypeOf(zero)))
+	if err != nil {
+		panic(fmt.Sprintf("%s: encode argument schema: %v", definition.Name, err))
+	}
+	publishCommandSchema(definition, string(schema))
+	s.RegisterCommand(definition, func(ctx context.Context, args []string) (string, error) {
+		var parsed A
+		if err := decodeCommandArgs(args, &parsed); err != nil {
+			return "", fmt.Errorf("%s: %w", definition.Name, err)
 		}
+		return run(ctx, parsed)
+	})
+}
+
+// publishCommandSchema appends the schema to the definition's usage. The
+// command contract has no field for an argument schema, so the usage is where
+// callers discover it, on a line of its own after the example.
+func publishCommandSchema(definition *agentv0.CommandDefinition, schema string) {
+	if definition.Usage != "" {
+		definition.Usage += "\n"
 	}
+	definition.Usage += "Arguments (JSON Schema): " + schema
+}
 
+// cmdScreenshot captures the running frontend. The request reaches the
+// capture script as JSON data, never as script source, so paths and URLs
+// cannot break out of it.
+func (s *Runtime) cmdScreenshot(ctx context.Context, request screenshotRequest) (string, error) {
+	if !s.server.running() {
+		return "", fmt.Errorf("frontend is not running")
+	}
 	addr, err := s.findHTTPAddress()
 	if err != nil {
 		return "", err
 	}
-
-	script := fmt.Sprintf(
-		`const { chromium } = require('playwright');
-		(async () => {
-			const browser = await chromium.launch();
-			const page = await browser.newPage();
-			await page.goto('%s%s');
-			await page.screenshot({ path: '%s', fullPage: true });
-			await browser.close();
-			console.log('Screenshot saved to %s');
-		})();`, addr, targetURL, outputPath, outputPath)
-
-	proc, err := s.runnerEnvironment.NewProcess("node", "-e", script)
+	script, err := request.plan(s.sourceLocation, addr)
 	if err != nil {
-		return "", fmt.Errorf("cannot create screenshot process: %w", err)
+		return "", err
 	}
-	runErr := proc.Run(ctx)
-	if runErr != nil {
-		return "", fmt.Errorf("screenshot failed: %w", runErr)
+	for _, shot := range script.Shots {
+		if err := os.MkdirAll(filepath.Dir(shot.File), 0o755); err != nil {
+			return "", fmt.Errorf("create screenshot directory: %w", err)
+		}
 	}
-	return fmt.Sprintf("Screenshot saved to %s", outputPath), nil
+	output, err := s.runBrowserAudit(ctx, screenshotScript, "CODEFLY_SCREENSHOT_REQUEST", script)
+	if err != nil {
+		return output, fmt.Errorf("screenshot failed: %w", err)
+	}
+	files, err := screenshotFiles(script, output)
+	if err != nil {
+		return output, err
+	}
+	encoded, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("encode screenshot result: %w", err)
+	}
+	return string(encoded), nil
 }
 
-func (s *Runtime) cmdHealth(_ context.Context, _ []string) (string, error) {
-	if s.runner == nil {
+func (s *Runtime) cmdHealth(_ context.Context, _ noCommandArgs) (string, error) {
+	if !s.server.running() {
 		return "NOT RUNNING", nil
 	}
+	supervised := ""
+	if s.supervisor != nil {
+		status := s.supervisor.status()
+		if status.State == serverCrashLoop {
+			return fmt.Sprintf("CRASH-LOOP: %s", status.LastFailure), nil
+		}
+		supervised = fmt.Sprintf(" (%s)", status)
+	}
 	addr, err := s.findHTTPAddress()
 	if err != nil {
 		return "", err
 	}
-	resp, err := http.Get(addr)
+	contract, err := s.Settings.ReadinessContract()
+	if err != nil {
+		return "", err
+	}
+	probeURL, err := contract.url(addr)
 	if err != nil {
-		return fmt.Sprintf("UNHEALTHY: %v", err), nil
+		return "", err
+	}
+	resp, err := http.Get(probeURL)
+	if err != nil {
+		return fmt.Sprintf("UNHEALTHY: %v%s", err, supervised), nil
 	}
 	defer resp.Body.Close()
-	return fmt.Sprintf("HEALTHY: HTTP %d", resp.StatusCode), nil
+	if err := contract.check(resp); err != nil {
+		return fmt.Sprintf("UNHEALTHY: %v%s", err, supervised), nil
+	}
+	return fmt.Sprintf("HEALTHY: %s HTTP %d%s", contract.Path, resp.StatusCode, supervised), nil
 }
 
-func (s *Runtime) cmdRoutes(ctx context.Context, _ []string) (string, error) {
-	// Route `find` through the plugin's runner environment so a Docker-
-	// mode nextjs agent searches its own mounted tree rather than the host.
-	proc, err := s.runnerEnvironment.NewProcess("find", "src/app", "-name", "page.tsx", "-o", "-name", "page.ts")
+// cmdDiagnostics answers "is the app currently broken, and where": the
+// outstanding errors parsed from the server output since the last successful
+// compile, as JSON.
+func (s *Runtime) cmdDiagnostics(_ context.Context, _ noCommandArgs) (string, error) {
+	if !s.server.running() {
+		return "", fmt.Errorf("frontend is not running")
+	}
+	return s.diagnostics.report().JSON()
+}
+
+// cmdRoutes analyzes the configured Node source directory. Container runs
+// bind-mount the same tree, so reading it from the agent matches what the
+// server sees.
+func (s *Runtime) cmdRoutes(_ context.Context, args jsonOutputArgs) (string, error) {
+	routes, err := analyzeNextRoutes(s.sourceLocation)
 	if err != nil {
 		return "", fmt.Errorf("cannot list routes: %w", err)
 	}
-	var buf bytes.Buffer
-	proc.WithOutput(&buf)
-	if runErr := proc.Run(ctx); runErr != nil {
-		return "", fmt.Errorf("cannot list routes: %w", runErr)
-	}
-	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
-	var routes []string
-	for _, line := range lines {
-		route := strings.TrimPrefix(line, "src/app")
-		route = strings.TrimSuffix(route, "/page.tsx")
-		route = strings.TrimSuffix(route, "/page.ts")
-		if route == "" {
-			route = "/"
-		}
-		routes = append(routes, route)
+	if args.JSON {
+		return formatNextRoutesJSON(routes)
 	}
-	return fmt.Sprintf("Routes (%d):\n%s", len(routes), strings.Join(routes, "\n")), nil
+	return formatNextRoutesText(routes), nil
 }
 
-func (s *Runtime) cmdPlaywright(ctx context.Context, args []string) (string, error) {
-	if s.runner == nil {
+// cmdBuildManifest reads the manifests of the last `next build` in the source
+// directory, whether it came from Runtime.Build or a production start.
+func (s *Runtime) cmdBuildManifest(_ context.Context, args jsonOutputArgs) (string, error) {
+	manifest, err := readNextBuildManifest(s.sourceLocation)
+	if errors.Is(err, errNoNextBuild) {
+		return "", fmt.Errorf("%w: run a build or start the production profile first", err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot read build manifest: %w", err)
+	}
+	if args.JSON {
+		return manifest.JSON()
+	}
+	return manifest.text(), nil
+}
+
+// cmdPlaywright runs the project's Playwright tests against the running
+// frontend and returns the structured run as JSON.
+func (s *Runtime) cmdPlaywright(ctx context.Context, args playwrightArgs) (string, error) {
+	if !s.server.running() {
 		return "", fmt.Errorf("frontend is not running — start it first")
 	}
 
@@ -136,44 +296,235 @@ func (s *Runtime) cmdPlaywright(ctx context.Context, args []string) (string, err
 		return "", err
 	}
 
-	// Build npx playwright command
-	pwArgs := []string{"playwright", "test"}
-	headed := false
-	for _, arg := range args {
-		switch arg {
-		case "--headed":
-			headed = true
-		default:
-			pwArgs = append(pwArgs, arg)
-		}
+	manager, err := s.resolvePackageManager()
+	if err != nil {
+		return "", err
 	}
-	if headed {
-		pwArgs = append(pwArgs, "--headed")
+
+	// Build the project-local playwright command. The JSON reporter follows
+	// the same contract as the e2e suite of Runtime.Test.
+	started := time.Now()
+	runID := newPlaywrightRunID(started)
+	cacheDir := filepath.Join(s.sourceLocation, ".codefly", "test-output")
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return "", fmt.Errorf("create test cache dir: %w", err)
 	}
+	jsonFile := filepath.Join(cacheDir, "playwright-"+runID+".json")
+	defer os.Remove(jsonFile)
+	reporterArgs, reporterEnvs := nodeTestReporterConfiguration(nodeTestPlaywright, jsonFile)
+	pwArgs := append(args.testArgs(), reporterArgs...)
 
 	// Route through NativeProc so Playwright inherits Setpgid + pgid-file
 	// tracking. Raw exec.CommandContext here was the worst orphan source
 	// in this repo: Chromium/Webkit detach from the npx parent on purpose,
 	// and without a recorded pgroup they survived every form of CLI death,
 	// holding ports and hundreds of MB of RAM until a manual kill.
-	proc, err := s.runnerEnvironment.NewProcess("npx", pwArgs...)
+	command, commandArgs := manager.command(manager.execArgs("playwright", pwArgs...)...)
+	proc, err := s.runnerEnvironment.NewProcess(command, commandArgs...)
 	if err != nil {
 		return "", fmt.Errorf("cannot create playwright process: %w", err)
 	}
 	var outBuf bytes.Buffer
 	proc.WithOutput(&outBuf)
-	proc.WithEnvironmentVariables(ctx,
-		&resources.EnvironmentVariable{Key: "BASE_URL", Value: addr},
-		&resources.EnvironmentVariable{Key: "PLAYWRIGHT_BASE_URL", Value: addr},
-	)
+	proc.WithEnvironmentVariables(ctx, append([]*resources.EnvironmentVariable{
+		{Key: "BASE_URL", Value: addr},
+		{Key: "PLAYWRIGHT_BASE_URL", Value: addr},
+	}, reporterEnvs...)...)
 	runErr := proc.Run(ctx)
 	output := outBuf.String()
+
+	// A run that dies before the reporter writes (bad config, missing
+	// browsers) has only its console output to show.
+	report, err := os.ReadFile(jsonFile)
+	if err != nil || len(bytes.TrimSpace(report)) == 0 {
+		if runErr != nil {
+			return output, fmt.Errorf("playwright tests failed: %w", runErr)
+		}
+		return output, fmt.Errorf("playwright wrote no JSON report")
+	}
+	parsed := javascript.ParsePlaywrightJSON(string(report))
+	if parsed == nil {
+		return output, fmt.Errorf("cannot parse the Playwright JSON report")
+	}
+	tests, err := readPlaywrightTests(s.sourceLocation, report)
+	if err != nil {
+		return output, err
+	}
+	run := newPlaywrightRun(runID, parsed.ToProtoResponse(string(nodeTestPlaywright), "playwright", time.Since(started)), tests)
+	run.Summary = parsed.LegacyTestSummary().SummaryLine()
+	if err := run.collectArtifacts(filepath.Join(s.sourceLocation, ".codefly", "playwright-artifacts", runID)); err != nil {
+		s.Wool.Warn("some Playwright artifacts were not collected", wool.ErrField(err))
+	}
+	encoded, err := run.JSON()
+	if err != nil {
+		return "", err
+	}
+	if !run.Passed {
+		return encoded, fmt.Errorf("playwright tests failed: %s", run.Summary)
+	}
 	if runErr != nil {
-		return output, fmt.Errorf("playwright tests failed: %w", runErr)
+		return encoded, fmt.Errorf("playwright exited with an error: %w", runErr)
+	}
+	return encoded, nil
+}
+
+// cmdPerf audits cold loads of the running frontend with the project's own
+// Playwright. The report is returned even when it fails its thresholds.
+func (s *Runtime) cmdPerf(ctx context.Context, args routeAuditArgs) (string, error) {
+	if !s.server.running() {
+		return "", fmt.Errorf("frontend is not running — start it first")
+	}
+	routes, err := s.Settings.Perf.perfRoutes(args.Routes)
+	if err != nil {
+		return "", err
+	}
+	addr, err := s.findHTTPAddress()
+	if err != nil {
+		return "", err
+	}
+	output, err := s.runBrowserAudit(ctx, perfAuditScript, "CODEFLY_PERF_REQUEST", newBrowserAuditRequest(addr, routes))
+	if err != nil {
+		return output, fmt.Errorf("performance audit failed (is Playwright installed with Chromium?): %w", err)
+	}
+	measured, err := parsePerfOutput(output)
+	if err != nil {
+		return output, err
+	}
+
+	report := newPerfReport(measured, s.Settings.Perf.Thresholds)
+	output = report.text()
+	if args.JSON {
+		if output, err = report.JSON(); err != nil {
+			return "", err
+		}
+	}
+	if !report.Passed {
+		return output, fmt.Errorf("performance audit failed: %d route(s) did not load, %d threshold violation(s)",
+			report.loadFailures(), len(report.Violations))
 	}
 	return output, nil
 }
 
+// cmdA11y audits the running frontend. Without routes it visits every static
+// page the route analyzer finds, plus a11y.routes.
+func (s *Runtime) cmdA11y(ctx context.Context, args routeAuditArgs) (string, error) {
+	if !s.server.running() {
+		return "", fmt.Errorf("frontend is not running — start it first")
+	}
+	report, err := s.runA11yAudit(ctx, args.Routes)
+	if err != nil {
+		return "", err
+	}
+	output := report.text()
+	if args.JSON {
+		if output, err = report.JSON(); err != nil {
+			return "", err
+		}
+	}
+	if !report.Passed {
+		return output, fmt.Errorf("accessibility audit failed: %d route(s) with issues at or above %s", report.failedRoutes(), report.FailOn)
+	}
+	return output, nil
+}
+
+// runA11yAudit runs axe-core against the running frontend.
+func (s *Runtime) runA11yAudit(ctx context.Context, requested []string) (a11yReport, error) {
+	failOn, err := s.Settings.A11y.failOn()
+	if err != nil {
+		return a11yReport{}, err
+	}
+	var discovered []nextRoute
+	if len(requested) == 0 {
+		if discovered, err = analyzeNextRoutes(s.sourceLocation); err != nil {
+			return a11yReport{}, fmt.Errorf("cannot discover routes to audit: %w", err)
+		}
+	}
+	routes, err := s.Settings.A11y.a11yRoutes(requested, discovered)
+	if err != nil {
+		return a11yReport{}, err
+	}
+	addr, err := s.findHTTPAddress()
+	if err != nil {
+		return a11yReport{}, err
+	}
+	output, err := s.runBrowserAudit(ctx, a11yAuditScript, "CODEFLY_A11Y_REQUEST", newBrowserAuditRequest(addr, routes))
+	if err != nil {
+		return a11yReport{}, fmt.Errorf("accessibility audit failed (is Playwright installed with Chromium, and axe-core?): %w\n%s", err, output)
+	}
+	return newA11yReport(output, failOn)
+}
+
+// cmdVisual runs the visual regression comparison against the running
+// frontend, or with update records its screenshots as the new baselines.
+func (s *Runtime) cmdVisual(ctx context.Context, args visualArgs) (string, error) {
+	if !s.server.running() {
+		return "", fmt.Errorf("frontend is not running — start it first")
+	}
+	report, err := s.runVisual(ctx, args.Routes, args.Update)
+	if err != nil {
+		return "", err
+	}
+	output := report.text()
+	if args.JSON {
+		if output, err = report.JSON(); err != nil {
+			return "", err
+		}
+	}
+	if !report.Passed {
+		return output, fmt.Errorf("visual regression failed: %d of %d screenshot(s)", len(report.evidence()), len(report.Results))
+	}
+	return output, nil
+}
+
+// runVisual captures every planned shot, then compares them in Go.
+func (s *Runtime) runVisual(ctx context.Context, requested []string, update bool) (visualReport, error) {
+	settings := s.Settings.Visual
+	shots, err := settings.shots(s.sourceLocation, requested)
+	if err != nil {
+		return visualReport{}, err
+	}
+	outputDir := filepath.Join(s.sourceLocation, ".codefly", visualOutputDir)
+	if err := os.RemoveAll(outputDir); err != nil {
+		return visualReport{}, fmt.Errorf("clear previous visual output: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Join(outputDir, "actual"), 0o755); err != nil {
+		return visualReport{}, fmt.Errorf("create visual output directory: %w", err)
+	}
+	addr, err := s.findHTTPAddress()
+	if err != nil {
+		return visualReport{}, err
+	}
+	request := visualCaptureRequest{BaseURL: addr, TimeoutMs: browserAuditTimeoutMs, Shots: shots}
+	output, err := s.runBrowserAudit(ctx, visualCaptureScript, "CODEFLY_VISUAL_REQUEST", request)
+	if err != nil {
+		return visualReport{}, fmt.Errorf("visual capture failed (is Playwright installed with Chromium?): %w\n%s", err, output)
+	}
+	var captures []visualCapture
+	if err := parseBrowserResult(output, visualResultMarker, &captures); err != nil {
+		return visualReport{}, err
+	}
+	return settings.compareVisualShots(shots, captures, update), nil
+}
+
+// runBrowserAudit runs one of the agent's audit scripts with node in the
+// source directory, so it requires the project's own Playwright, and hands it
+// the request as JSON in requestEnv. It returns the combined output.
+func (s *Runtime) runBrowserAudit(ctx context.Context, script, requestEnv string, request any) (string, error) {
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("encode browser audit request: %w", err)
+	}
+	proc, err := s.runnerEnvironment.NewProcess("node", "-e", script)
+	if err != nil {
+		return "", fmt.Errorf("cannot create browser audit process: %w", err)
+	}
+	var outBuf bytes.Buffer
+	proc.WithOutput(&outBuf)
+	proc.WithEnvironmentVariables(ctx, resources.Env(requestEnv, string(encoded)))
+	err = proc.Run(ctx)
+	return outBuf.String(), err
+}
+
 func (s *Runtime) findHTTPAddress() (string, error) {
 	net, err := resources.FindNetworkInstanceInNetworkMappings(
 		context.Background(), s.NetworkMappings, s.HttpEndpoint, resources.NewNativeNetworkAccess())
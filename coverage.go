@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CoverageSettings are the minimum coverage a test run must reach, in
+// percent. The top-level thresholds apply to the totals; a path threshold
+// applies to each file its glob matches, first match wins. Setting any
+// threshold collects coverage on every vitest or jest run.
+//
+//	test:
+//	  coverage:
+//	    lines: 80
+//	    branches: 70
+//	    paths:
+//	      - path: src/lib/**
+//	        lines: 95
+type CoverageSettings struct {
+	CoverageThresholds `yaml:",inline"`
+	Paths              []PathCoverageThresholds `yaml:"paths,omitempty"`
+}
+
+// CoverageThresholds are percentages; zero leaves a metric unchecked.
+type CoverageThresholds struct {
+	Lines      float64 `yaml:"lines,omitempty"`
+	Branches   float64 `yaml:"branches,omitempty"`
+	Functions  float64 `yaml:"functions,omitempty"`
+	Statements float64 `yaml:"statements,omitempty"`
+}
+
+type PathCoverageThresholds struct {
+	// Path is a glob over source paths relative to the project: `*` matches
+	// one segment, `**` any number of segments.
+	Path               string `yaml:"path"`
+	CoverageThresholds `yaml:",inline"`
+}
+
+// coverageMetric counts covered items of one kind.
+type coverageMetric struct {
+	Total   int `json:"total"`
+	Covered int `json:"covered"`
+}
+
+// Pct is the covered percentage; nothing to cover counts as fully covered,
+// as istanbul reports it.
+func (m coverageMetric) Pct() float64 {
+	if m.Total == 0 {
+		return 100
+	}
+	return float64(m.Covered) * 100 / float64(m.Total)
+}
+
+// MarshalJSON adds the percentage for readers of the typed report.
+func (m coverageMetric) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Total   int     `json:"total"`
+		Covered int     `json:"covered"`
+		Pct     float64 `json:"pct"`
+	}{m.Total, m.Covered, m.Pct()})
+}
+
+func (m *coverageMetric) add(other coverageMetric) {
+	m.Total += other.Total
+	m.Covered += other.Covered
+}
+
+type coverageSummary struct {
+	Lines      coverageMetric `json:"lines"`
+	Branches   coverageMetric `json:"branches"`
+	Functions  coverageMetric `json:"functions"`
+	Statements coverageMetric `json:"statements"`
+}
+
+func (s *coverageSummary) add(other coverageSummary) {
+	s.Lines.add(other.Lines)
+	s.Branches.add(other.Branches)
+	s.Functions.add(other.Functions)
+	s.Statements.add(other.Statements)
+}
+
+func (s coverageSummary) String() string {
+	return fmt.Sprintf("lines %.1f%%, branches %.1f%%, functions %.1f%%, statements %.1f%%",
+		s.Lines.Pct(), s.Branches.Pct(), s.Functions.Pct(), s.Statements.Pct())
+}
+
+type coverageFile struct {
+	// Path is relative to the project when the file is inside it.
+	Path string `json:"path"`
+	coverageSummary
+}
+
+// coverageReport is the typed coverage of one test run, read from the
+// runner's istanbul reports.
+type coverageReport struct {
+	Total coverageSummary `json:"total"`
+	Files []coverageFile  `json:"files"`
+}
+
+const (
+	coverageSummaryFile = "coverage-summary.json"
+	coverageLcovFile    = "lcov.info"
+	// coverageReportFile is the typed report written next to the runner's.
+	coverageReportFile = "coverage.json"
+)
+
+// coverageArgs makes the runner write istanbul's json-summary and lcov reports
+// into dir, whatever the project configured, plus a text summary for the log.
+func coverageArgs(runner nodeTestRunner, dir string) ([]string, error) {
+	reporters := []string{"json-summary", "lcov", "text-summary"}
+	switch runner {
+	case nodeTestVitest:
+		args := []string{"--coverage.enabled", "--coverage.reportsDirectory=" + dir}
+		for _, reporter := range reporters {
+			args = append(args, "--coverage.reporter="+reporter)
+		}
+		return args, nil
+	case nodeTestJest:
+		args := []string{"--coverage", "--coverageDirectory=" + dir}
+		for _, reporter := range reporters {
+			args = append(args, "--coverageReporters="+reporter)
+		}
+		return args, nil
+	default:
+		return nil, fmt.Errorf("test runner %q has no coverage reporter", runner)
+	}
+}
+
+// readCoverageReport reads the json-summary report in dir, or the lcov one
+// when the summary is missing.
+func readCoverageReport(dir, sourceDir string) (coverageReport, error) {
+	data, err := os.ReadFile(filepath.Join(dir, coverageSummaryFile))
+	if err == nil {
+		return parseCoverageSummary(data, sourceDir)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return coverageReport{}, fmt.Errorf("read coverage summary: %w", err)
+	}
+	data, err = os.ReadFile(filepath.Join(dir, coverageLcovFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return coverageReport{}, fmt.Errorf("the test runner wrote no coverage report to %s", dir)
+		}
+		return coverageReport{}, fmt.Errorf("read lcov report: %w", err)
+	}
+	return parseLcov(data, sourceDir)
+}
+
+// parseCoverageSummary reads istanbul's json-summary format: a "total" entry
+// and one entry per file. Its pct fields are ignored; they are "Unknown" for
+// empty metrics.
+func parseCoverageSummary(data []byte, sourceDir string) (coverageReport, error) {
+	var entries map[string]coverageSummary
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return coverageReport{}, fmt.Errorf("parse coverage summary: %w", err)
+	}
+	report := coverageReport{Files: []coverageFile{}}
+	for path, summary := range entries {
+		if path == "total" {
+			report.Total = summary
+			continue
+		}
+		report.Files = append(report.Files, coverageFile{Path: coveragePath(path, sourceDir), coverageSummary: summary})
+	}
+	if _, ok := entries["total"]; !ok {
+		for _, file := range report.Files {
+			report.Total.add(file.coverageSummary)
+		}
+	}
+	sortCoverageFiles(report.Files)
+	return report, nil
+}
+
+// parseLcov reads the per-file totals of an lcov trace. lcov has no
+// statements; they are its lines, as istanbul's lcov reporter writes them.
+func parseLcov(data []byte, sourceDir string) (coverageReport, error) {
+	report := coverageReport{Files: []coverageFile{}}
+	var current *coverageFile
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "end_of_record" {
+			if current != nil {
+				current.Statements = current.Lines
+				report.Total.add(current.coverageSummary)
+				report.Files = append(report.Files, *current)
+				current = nil
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		if key == "SF" {
+			current = &coverageFile{Path: coveragePath(value, sourceDir)}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		var target *int
+		switch key {
+		case "LF":
+			target = &current.Lines.Total
+		case "LH":
+			target = &current.Lines.Covered
+		case "BRF":
+			target = &current.Branches.Total
+		case "BRH":
+			target = &current.Branches.Covered
+		case "FNF":
+			target = &current.Functions.Total
+		case "FNH":
+			target = &current.Functions.Covered
+		default:
+			continue
+		}
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return coverageReport{}, fmt.Errorf("parse lcov report: %s: %w", line, err)
+		}
+		*target = count
+	}
+	if err := scanner.Err(); err != nil {
+		return coverageReport{}, fmt.Errorf("parse lcov report: %w", err)
+	}
+	sortCoverageFiles(report.Files)
+	return report, nil
+}
+
+func coveragePath(path, sourceDir string) string {
+	if filepath.IsAbs(path) && sourceDir != "" {
+		if relative, err := filepath.Rel(sourceDir, path); err == nil && !strings.HasPrefix(relative, "..") {
+			path = relative
+		}
+	}
+	return filepath.ToSlash(path)
+}
+
+func sortCoverageFiles(files []coverageFile) {
+	slices.SortFunc(files, func(a, b coverageFile) int { return strings.Compare(a.Path, b.Path) })
+}
+
+// coverageViolation is a total, or a file, under one of its thresholds.
+type coverageViolation struct {
+	// Path is empty for the totals.
+	Path      string  `json:"path,omitempty"`
+	Glob      string  `json:"glob,omitempty"`
+	Metric    string  `json:"metric"`
+	Threshold float64 `json:"threshold"`
+	Actual    float64 `json:"actual"`
+}
+
+func (v coverageViolation) String() string {
+	if v.Path == "" {
+		return fmt.Sprintf("total %s coverage %.1f%% < %g%%", v.Metric, v.Actual, v.Threshold)
+	}
+	return fmt.Sprintf("%s %s coverage %.1f%% < %g%% (%s)", v.Path, v.Metric, v.Actual, v.Threshold, v.Glob)
+}
+
+// configured reports whether any threshold is set.
+func (c CoverageSettings) configured() bool {
+	return c.CoverageThresholds != (CoverageThresholds{}) || len(c.Paths) > 0
+}
+
+// check lists every threshold the report misses.
+func (c CoverageSettings) check(report coverageReport) []coverageViolation {
+	violations := summaryViolations("", "", report.Total, c.CoverageThresholds)
+	for _, file := range report.Files {
+		for _, path := range c.Paths {
+			if matchRouteGlob(path.Path, file.Path) {
+				violations = append(violations, summaryViolations(file.Path, path.Path, file.coverageSummary, path.CoverageThresholds)...)
+				break
+			}
+		}
+	}
+	return violations
+}
+
+func summaryViolations(path, glob string, summary coverageSummary, thresholds CoverageThresholds) []coverageViolation {
+	var violations []coverageViolation
+	check := func(name string, metric coverageMetric, threshold float64) {
+		if threshold > 0 && metric.Pct() < threshold {
+			violations = append(violations, coverageViolation{
+				Path: path, Glob: glob, Metric: name, Threshold: threshold, Actual: metric.Pct(),
+			})
+		}
+	}
+	check("lines", summary.Lines, thresholds.Lines)
+	check("branches", summary.Branches, thresholds.Branches)
+	check("functions", summary.Functions, thresholds.Functions)
+	check("statements", summary.Statements, thresholds.Statements)
+	return violations
+}
+
+// coverageReportLimit bounds the files listed in the test output; the typed
+// report keeps all of them.
+const coverageReportLimit = 20
+
+// text summarizes the totals and the least-covered files.
+func (r coverageReport) text(reportPath string) string {
+	lines := []string{"Coverage: " + r.Total.String()}
+	files := slices.Clone(r.Files)
+	slices.SortStableFunc(files, func(a, b coverageFile) int {
+		switch {
+		case a.Lines.Pct() < b.Lines.Pct():
+			return -1
+		case a.Lines.Pct() > b.Lines.Pct():
+			return 1
+		}
+		return 0
+	})
+	for i, file := range files {
+		if i == coverageReportLimit {
+			lines = append(lines, fmt.Sprintf("  ... and %d more file(s)", len(files)-i))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("  %s: %s", file.Path, file.coverageSummary))
+	}
+	if reportPath != "" {
+		lines = append(lines, "Per-file coverage: "+reportPath)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const coverageSummaryFixture = `{
+  "total": {
+    "lines": {"total": 20, "covered": 15, "skipped": 0, "pct": 75},
+    "statements": {"total": 22, "covered": 16, "skipped": 0, "pct": 72.72},
+    "functions": {"total": 5, "covered": 4, "skipped": 0, "pct": 80},
+    "branches": {"total": 8, "covered": 4, "skipped": 0, "pct": 50},
+    "branchesTrue": {"total": 0, "covered": 0, "skipped": 0, "pct": "Unknown"}
+  },
+  "/app/src/lib/math.ts": {
+    "lines": {"total": 10, "covered": 9, "skipped": 0, "pct": 90},
+    "statements": {"total": 11, "covered": 10, "skipped": 0, "pct": 90.9},
+    "functions": {"total": 3, "covered": 3, "skipped": 0, "pct": 100},
+    "branches": {"total": 0, "covered": 0, "skipped": 0, "pct": "Unknown"}
+  },
+  "/app/src/app/page.tsx": {
+    "lines": {"total": 10, "covered": 6, "skipped": 0, "pct": 60},
+    "statements": {"total": 11, "covered": 6, "skipped": 0, "pct": 54.54},
+    "functions": {"total": 2, "covered": 1, "skipped": 0, "pct": 50},
+    "branches": {"total": 8, "covered": 4, "skipped": 0, "pct": 50}
+  }
+}`
+
+func TestCoverageArgsForceMachineReadableReporters(t *testing.T) {
+	args, err := coverageArgs(nodeTestVitest, "/app/.codefly/coverage/unit")
+	require.NoError(t, err)
+	require.Contains(t, args, "--coverage.enabled")
+	require.Contains(t, args, "--coverage.reportsDirectory=/app/.codefly/coverage/unit")
+	require.Contains(t, args, "--coverage.reporter=json-summary")
+	require.Contains(t, args, "--coverage.reporter=lcov")
+
+	args, err = coverageArgs(nodeTestJest, "/app/.codefly/coverage/unit")
+	require.NoError(t, err)
+	require.Contains(t, args, "--coverageDirectory=/app/.codefly/coverage/unit")
+	require.Contains(t, args, "--coverageReporters=json-summary")
+
+	_, err = coverageArgs(nodeTestPlaywright, "/tmp")
+	require.Error(t, err)
+}
+
+func TestParseCoverageSummaryReadsPerFileData(t *testing.T) {
+	report, err := parseCoverageSummary([]byte(coverageSummaryFixture), "/app")
+	require.NoError(t, err)
+	require.Equal(t, coverageMetric{Total: 20, Covered: 15}, report.Total.Lines)
+	require.Equal(t, 50.0, report.Total.Branches.Pct())
+	require.Len(t, report.Files, 2)
+	require.Equal(t, "src/app/page.tsx", report.Files[0].Path)
+	require.Equal(t, "src/lib/math.ts", report.Files[1].Path)
+	require.Equal(t, 100.0, report.Files[1].Branches.Pct(), "nothing to cover is fully covered")
+
+	data, err := json.Marshal(report.Files[0])
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+	  "path": "src/app/page.tsx",
+	  "lines": {"total": 10, "covered": 6, "pct": 60},
+	  "branches": {"total": 8, "covered": 4, "pct": 50},
+	  "functions": {"total": 2, "covered": 1, "pct": 50},
+	  "statements": {"total": 11, "covered": 6, "pct": 54.54545454545455}
+	}`, string(data))
+}
+
+func TestParseLcovSumsFileRecords(t *testing.T) {
+	lcov := strings.Join([]string{
+		"TN:",
+		"SF:/app/src/lib/math.ts",
+		"FN:1,add",
+		"FNF:2",
+		"FNH:1",
+		"DA:1,1",
+		"LF:4",
+		"LH:3",
+		"BRF:2",
+		"BRH:1",
+		"end_of_record",
+		"TN:",
+		"SF:/elsewhere/shared.ts",
+		"LF:6",
+		"LH:6",
+		"end_of_record",
+		"",
+	}, "\n")
+	report, err := parseLcov([]byte(lcov), "/app")
+	require.NoError(t, err)
+	require.Len(t, report.Files, 2)
+	require.Equal(t, "/elsewhere/shared.ts", report.Files[0].Path, "files outside the project keep their path")
+	math := report.Files[1]
+	require.Equal(t, "src/lib/math.ts", math.Path)
+	require.Equal(t, coverageMetric{Total: 4, Covered: 3}, math.Lines)
+	require.Equal(t, math.Lines, math.Statements)
+	require.Equal(t, coverageMetric{Total: 2, Covered: 1}, math.Functions)
+	require.Equal(t, coverageMetric{Total: 10, Covered: 9}, report.Total.Lines)
+
+	_, err = parseLcov([]byte("SF:a.ts\nLF:x\nend_of_record\n"), "")
+	require.Error(t, err)
+}
+
+func TestReadCoverageReportFallsBackToLcov(t *testing.T) {
+	dir := t.TempDir()
+	_, err := readCoverageReport(dir, "/app")
+	require.ErrorContains(t, err, "no coverage report")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, coverageLcovFile), []byte("SF:/app/a.ts\nLF:2\nLH:1\nend_of_record\n"), 0o644))
+	report, err := readCoverageReport(dir, "/app")
+	require.NoError(t, err)
+	require.Equal(t, 50.0, report.Total.Lines.Pct())
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, coverageSummaryFile), []byte(coverageSummaryFixture), 0o644))
+	report, err = readCoverageReport(dir, "/app")
+	require.NoError(t, err)
+	require.Len(t, report.Files, 2, "the json summary wins over lcov")
+}
+
+func TestCoverageThresholdsCheckTotalsAndPaths(t *testing.T) {
+	var settings TestSettings
+	require.NoError(t, yaml.Unmarshal([]byte(`
+coverage:
+  lines: 80
+  branches: 50
+  paths:
+    - path: src/lib/**
+      lines: 95
+    - path: "**"
+      functions: 60
+`), &settings))
+	require.Equal(t, 80.0, settings.Coverage.Lines)
+	require.Len(t, settings.Coverage.Paths, 2)
+
+	report, err := parseCoverageSummary([]byte(coverageSummaryFixture), "/app")
+	require.NoError(t, err)
+	violations := settings.Coverage.check(report)
+	require.Equal(t, []coverageViolation{
+		{Metric: "lines", Threshold: 80, Actual: 75},
+		{Path: "src/app/page.tsx", Glob: "**", Metric: "functions", Threshold: 60, Actual: 50},
+		{Path: "src/lib/math.ts", Glob: "src/lib/**", Metric: "lines", Threshold: 95, Actual: 90},
+	}, violations)
+	require.Equal(t, "total lines coverage 75.0% < 80%", violations[0].String())
+	require.Equal(t, "src/lib/math.ts lines coverage 90.0% < 95% (src/lib/**)", violations[2].String())
+
+	require.Empty(t, CoverageSettings{}.check(report))
+	require.True(t, settings.Coverage.configured())
+	require.False(t, CoverageSettings{}.configured())
+	require.True(t, CoverageSettings{Paths: []PathCoverageThresholds{{Path: "src/**"}}}.configured())
+}
+
+func TestCoverageReportTextListsLeastCoveredFilesFirst(t *testing.T) {
+	report, err := parseCoverageSummary([]byte(coverageSummaryFixture), "/app")
+	require.NoError(t, err)
+	lines := strings.Split(report.text("/app/.codefly/coverage/unit/coverage.json"), "\n")
+	require.Equal(t, "Coverage: lines 75.0%, branches 50.0%, functions 80.0%, statements 72.7%", lines[0])
+	require.True(t, strings.HasPrefix(lines[1], "  src/app/page.tsx: lines 60.0%"))
+	require.True(t, strings.HasPrefix(lines[2], "  src/lib/math.ts: lines 90.0%"))
+	require.Equal(t, "Per-file coverage: /app/.codefly/coverage/unit/coverage.json", lines[3])
+}
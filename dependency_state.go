@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/codefly-dev/core/wool"
+)
+
+// nodeDependencyState records the manifests behind the last successful
+// install, so a pull that adds a package is noticed before `next dev` trips
+// over the missing module.
+type nodeDependencyState struct {
+	Fingerprint string            `json:"fingerprint"`
+	Platform    string            `json:"platform"`
+	Files       map[string]string `json:"files"`
+	InstalledAt time.Time         `json:"installed_at"`
+}
+
+// nodeDependencyStatePath keeps one record per execution platform: native and
+// container runs of the same checkout own different node_modules trees.
+func nodeDependencyStatePath(sourceLocation, platform string) string {
+	return filepath.Join(sourceLocation, ".codefly", "node-dependencies", platform+".json")
+}
+
+func currentNodeDependencyState(sourceLocation, platform string) (*nodeDependencyState, error) {
+	manifests, err := readNodeDependencyManifests(sourceLocation)
+	if err != nil {
+		return nil, err
+	}
+	state := &nodeDependencyState{
+		Fingerprint: nodeDependencyFingerprint(manifests, platform),
+		Platform:    platform,
+		Files:       make(map[string]string, len(manifests)),
+	}
+	for _, manifest := range manifests {
+		state.Files[manifest.name] = fmt.Sprintf("%x", sha256.Sum256(manifest.content))
+	}
+	return state, nil
+}
+
+// readNodeDependencyState returns nil without error when nothing was recorded.
+func readNodeDependencyState(path string) (*nodeDependencyState, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state nodeDependencyState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+func (state *nodeDependencyState) write(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0o644)
+}
+
+// drift lists the manifests that differ between the recorded install and
+// current, in a stable order; nil means node_modules is up to date.
+func (state *nodeDependencyState) drift(current *nodeDependencyState) []string {
+	if state.Fingerprint == current.Fingerprint {
+		return nil
+	}
+	var changed []string
+	for name, sum := range current.Files {
+		switch recorded, ok := state.Files[name]; {
+		case !ok:
+			changed = append(changed, name+" added")
+		case recorded != sum:
+			changed = append(changed, name+" changed")
+		}
+	}
+	for name := range state.Files {
+		if _, ok := current.Files[name]; !ok {
+			changed = append(changed, name+" removed")
+		}
+	}
+	slices.Sort(changed)
+	if len(changed) == 0 {
+		// Same files under a different fingerprint: a record from another
+		// platform or an older fingerprint scheme.
+		changed = append(changed, "platform changed to "+current.Platform)
+	}
+	return changed
+}
+
+// dependencyPlatform is the platform node_modules is installed for: the
+// container's Linux for container runs, the host otherwise.
+func (s *Runtime) dependencyPlatform() string {
+	if s.Runtime.IsContainerRuntime() {
+		return "linux-" + runtime.GOARCH
+	}
+	return runtime.GOOS + "-" + runtime.GOARCH
+}
+
+// staleNodeDependencies describes what changed since the recorded install, or
+// returns "" when node_modules is current. A node_modules installed before any
+// record existed is adopted as is rather than reinstalled.
+func (s *Runtime) staleNodeDependencies() (string, error) {
+	platform := s.dependencyPlatform()
+	current, err := currentNodeDependencyState(s.sourceLocation, platform)
+	if err != nil {
+		return "", fmt.Errorf("fingerprint Node dependencies: %w", err)
+	}
+	path := nodeDependencyStatePath(s.sourceLocation, platform)
+	recorded, err := readNodeDependencyState(path)
+	if err != nil {
+		s.Wool.Warn("cannot read Node dependency state", wool.ErrField(err))
+		return "install record unreadable", nil
+	}
+	if recorded == nil {
+		current.InstalledAt = time.Now()
+		if err := current.write(path); err != nil {
+			s.Wool.Warn("cannot record Node dependency state", wool.ErrField(err))
+		}
+		return "", nil
+	}
+	changed := recorded.drift(current)
+	if len(changed) == 0 {
+		return "", nil
+	}
+	return strings.Join(changed, ", "), nil
+}
+
+// recordNodeDependencies stores the fingerprint of a successful install. A
+// failure only costs a redundant reinstall later, so it is not an error.
+func (s *Runtime) recordNodeDependencies() {
+	platform := s.dependencyPlatform()
+	state, err := currentNodeDependencyState(s.sourceLocation, platform)
+	if err == nil {
+		state.InstalledAt = time.Now()
+		err = state.write(nodeDependencyStatePath(s.sourceLocation, platform))
+	}
+	if err != nil {
+		s.Wool.Warn("cannot record Node dependency state", wool.ErrField(err))
+	}
+}
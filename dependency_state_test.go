@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeDependencyStateFingerprintMatchesCacheKey(t *testing.T) {
+	source := t.TempDir()
+	writeProductionTestFile(t, source, "package.json", `{"name":"web"}`)
+	writeProductionTestFile(t, source, "pnpm-lock.yaml", "lockfileVersion: '9.0'\n")
+
+	state, err := currentNodeDependencyState(source, "darwin-arm64")
+	require.NoError(t, err)
+	key, err := nodeDependencyCacheKey(source, "darwin-arm64")
+	require.NoError(t, err)
+	require.Equal(t, key, state.Fingerprint)
+	require.Equal(t, "darwin-arm64", state.Platform)
+	require.Len(t, state.Files, 2)
+
+	_, err = currentNodeDependencyState(t.TempDir(), "darwin-arm64")
+	require.Error(t, err)
+}
+
+func TestNodeDependencyStateDriftNamesChangedManifests(t *testing.T) {
+	source := t.TempDir()
+	writeProductionTestFile(t, source, "package.json", `{"dependencies":{"next":"16.0.0"}}`)
+	writeProductionTestFile(t, source, "package-lock.json", `{"lockfileVersion":3}`)
+	recorded, err := currentNodeDependencyState(source, "linux-amd64")
+	require.NoError(t, err)
+
+	current, err := currentNodeDependencyState(source, "linux-amd64")
+	require.NoError(t, err)
+	require.Nil(t, recorded.drift(current))
+
+	writeProductionTestFile(t, source, "package.json", `{"dependencies":{"next":"16.0.0","zod":"4.0.0"}}`)
+	writeProductionTestFile(t, source, ".yarnrc.yml", "nodeLinker: node-modules\n")
+	require.NoError(t, os.Remove(filepath.Join(source, "package-lock.json")))
+	current, err = currentNodeDependencyState(source, "linux-amd64")
+	require.NoError(t, err)
+	require.Equal(t, []string{".yarnrc.yml added", "package-lock.json removed", "package.json changed"}, recorded.drift(current))
+
+	other, err := currentNodeDependencyState(source, "linux-arm64")
+	require.NoError(t, err)
+	require.Equal(t, []string{"platform changed to linux-arm64"}, current.drift(other))
+}
+
+func TestNodeDependencyStateRoundTrips(t *testing.T) {
+	source := t.TempDir()
+	writeProductionTestFile(t, source, "package.json", `{}`)
+	path := nodeDependencyStatePath(source, "linux-amd64")
+	require.Equal(t, filepath.Join(source, ".codefly", "node-dependencies", "linux-amd64.json"), path)
+
+	missing, err := readNodeDependencyState(path)
+	require.NoError(t, err)
+	require.Nil(t, missing, "no record is not an error")
+
+	state, err := currentNodeDependencyState(source, "linux-amd64")
+	require.NoError(t, err)
+	require.NoError(t, state.write(path))
+	read, err := readNodeDependencyState(path)
+	require.NoError(t, err)
+	require.Equal(t, state.Fingerprint, read.Fingerprint)
+	require.Equal(t, state.Files, read.Files)
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o644))
+	_, err = readNodeDependencyState(path)
+	require.Error(t, err)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// nextDiagnostic is one compile or runtime error the running server reported
+// and has not yet recovered from.
+type nextDiagnostic struct {
+	Kind        nextOutputEventKind `json:"kind"`
+	Route       string              `json:"route,omitempty"`
+	File        string              `json:"file,omitempty"`
+	Line        int                 `json:"line,omitempty"`
+	Column      int                 `json:"column,omitempty"`
+	Message     string              `json:"message"`
+	Module      string              `json:"module,omitempty"`
+	Stack       []string            `json:"stack,omitempty"`
+	FirstSeen   time.Time           `json:"first_seen"`
+	LastSeen    time.Time           `json:"last_seen"`
+	Occurrences int                 `json:"occurrences"`
+}
+
+// nextDiagnostics is the current error set of the running server, fed by the
+// output parser. The zero value is ready to use.
+type nextDiagnostics struct {
+	mu      sync.Mutex
+	current map[string]*nextDiagnostic
+}
+
+type nextDiagnosticsReport struct {
+	// Broken is true while any compile or runtime error is outstanding.
+	Broken      bool              `json:"broken"`
+	Diagnostics []*nextDiagnostic `json:"diagnostics"`
+}
+
+// observe records failures and clears them on a successful compile. A
+// compile of one route clears that route's errors and errors Next.js did not
+// attribute to a route; a route-less compile (a hot update) clears all. A
+// server that reports ready has started afresh, which also clears all: under
+// `next start` there are no compiles, so that is the only recovery.
+func (d *nextDiagnostics) observe(event nextOutputEvent, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if event.Kind == nextServerReady {
+		d.current = nil
+		return
+	}
+	if event.Kind == nextCompiled {
+		for key, diagnostic := range d.current {
+			if event.Route == "" || diagnostic.Route == "" || diagnostic.Route == event.Route {
+				delete(d.current, key)
+			}
+		}
+		return
+	}
+	if !event.failed() {
+		return
+	}
+	key := fmt.Sprintf("%s|%s|%s:%d:%d|%s", event.Kind, event.Route, event.File, event.Line, event.Column, event.Message)
+	if existing, ok := d.current[key]; ok {
+		existing.LastSeen = now
+		existing.Occurrences++
+		return
+	}
+	if d.current == nil {
+		d.current = map[string]*nextDiagnostic{}
+	}
+	d.current[key] = &nextDiagnostic{
+		Kind:        event.Kind,
+		Route:       event.Route,
+		File:        event.File,
+		Line:        event.Line,
+		Column:      event.Column,
+		Message:     event.Message,
+		Module:      event.Module,
+		Stack:       event.Stack,
+		FirstSeen:   now,
+		LastSeen:    now,
+		Occurrences: 1,
+	}
+}
+
+// reset forgets everything; a freshly started server has no known errors.
+func (d *nextDiagnostics) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.current = nil
+}
+
+// report returns the outstanding errors, oldest first.
+func (d *nextDiagnostics) report() nextDiagnosticsReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	report := nextDiagnosticsReport{Diagnostics: []*nextDiagnostic{}}
+	for _, diagnostic := range d.current {
+		copied := *diagnostic
+		report.Diagnostics = append(report.Diagnostics, &copied)
+	}
+	sort.Slice(report.Diagnostics, func(i, j int) bool {
+		left, right := report.Diagnostics[i], report.Diagnostics[j]
+		if !left.FirstSeen.Equal(right.FirstSeen) {
+			return left.FirstSeen.Before(right.FirstSeen)
+		}
+		return left.location() < right.location()
+	})
+	report.Broken = len(report.Diagnostics) > 0
+	return report
+}
+
+func (d *nextDiagnostic) location() string {
+	return nextOutputEvent{File: d.File, Line: d.Line, Column: d.Column}.location()
+}
+
+func (r nextDiagnosticsReport) JSON() (string, error) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("encode diagnostics: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnosticsTrackOutstandingErrorsUntilASuccessfulCompile(t *testing.T) {
+	var diagnostics nextDiagnostics
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	missing := nextOutputEvent{
+		Kind: nextModuleNotFound, Route: "/settings", File: "src/app/settings/page.tsx", Line: 3, Column: 1,
+		Message: "Can't resolve '@/components/missing'", Module: "@/components/missing",
+	}
+	crash := nextOutputEvent{Kind: nextRuntimeError, Route: "/profile", Message: "TypeError: boom"}
+
+	diagnostics.observe(missing, start)
+	diagnostics.observe(crash, start.Add(time.Second))
+	diagnostics.observe(missing, start.Add(2*time.Second))
+	diagnostics.observe(nextOutputEvent{Kind: nextCompileStarted, Route: "/settings"}, start.Add(3*time.Second))
+
+	report := diagnostics.report()
+	require.True(t, report.Broken)
+	require.Len(t, report.Diagnostics, 2)
+	require.Equal(t, "src/app/settings/page.tsx", report.Diagnostics[0].File)
+	require.Equal(t, start, report.Diagnostics[0].FirstSeen)
+	require.Equal(t, start.Add(2*time.Second), report.Diagnostics[0].LastSeen)
+	require.Equal(t, 2, report.Diagnostics[0].Occurrences)
+
+	// Compiling another route leaves /settings broken.
+	diagnostics.observe(nextOutputEvent{Kind: nextCompiled, Route: "/about"}, start.Add(4*time.Second))
+	require.Len(t, diagnostics.report().Diagnostics, 2)
+
+	diagnostics.observe(nextOutputEvent{Kind: nextCompiled, Route: "/settings"}, start.Add(5*time.Second))
+	report = diagnostics.report()
+	require.Len(t, report.Diagnostics, 1)
+	require.Equal(t, nextRuntimeError, report.Diagnostics[0].Kind)
+
+	// A route-less hot update recompiled everything.
+	diagnostics.observe(nextOutputEvent{Kind: nextCompiled}, start.Add(6*time.Second))
+	require.False(t, diagnostics.report().Broken)
+}
+
+func TestDiagnosticsClearWhenTheServerIsReady(t *testing.T) {
+	var diagnostics nextDiagnostics
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	diagnostics.observe(nextOutputEvent{Kind: nextRuntimeError, Route: "/profile", Message: "TypeError: boom"}, start)
+	diagnostics.observe(nextOutputEvent{Kind: nextTypeError, File: "src/app/page.tsx", Message: "bad"}, start)
+	require.True(t, diagnostics.report().Broken)
+
+	// `next start` never compiles; a restarted server reporting ready is
+	// the recovery.
+	diagnostics.observe(nextOutputEvent{Kind: nextServerReady, Duration: time.Second}, start.Add(time.Minute))
+	require.False(t, diagnostics.report().Broken)
+
+	diagnostics.observe(nextOutputEvent{Kind: nextRuntimeError, Message: "Error: again"}, start.Add(2*time.Minute))
+	diagnostics.reset()
+	require.False(t, diagnostics.report().Broken)
+}
+
+func TestDiagnosticsReportIsStableJSON(t *testing.T) {
+	var diagnostics nextDiagnostics
+	seen := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	diagnostics.observe(nextOutputEvent{
+		Kind: nextTypeError, File: "src/lib/api.ts", Line: 10, Column: 5, Message: "Property 'id' does not exist",
+	}, seen)
+
+	output, err := diagnostics.report().JSON()
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"broken": true,
+		"diagnostics": [{
+			"kind": "type-error",
+			"file": "src/lib/api.ts",
+			"line": 10,
+			"column": 5,
+			"message": "Property 'id' does not exist",
+			"first_seen": "2026-05-01T12:00:00Z",
+			"last_seen": "2026-05-01T12:00:00Z",
+			"occurrences": 1
+		}]
+	}`, output)
+
+	diagnostics.reset()
+	output, err = diagnostics.report().JSON()
+	require.NoError(t, err)
+	var empty nextDiagnosticsReport
+	require.NoError(t, json.Unmarshal([]byte(output), &empty))
+	require.False(t, empty.Broken)
+	require.NotNil(t, empty.Diagnostics, "an empty report lists no diagnostics rather than null")
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/codefly-dev/core/resources"
+	runners "github.com/codefly-dev/core/runners/base"
+	"github.com/codefly-dev/core/wool"
+)
+
+// E2ESettings choose the server the end-to-end test suites run against.
+type E2ESettings struct {
+	// ProductionServer builds the project into a scratch copy and runs the
+	// suites against its production server on an ephemeral port, instead of
+	// the server `codefly run` started. The --production-server extra
+	// argument turns it on for one run.
+	ProductionServer bool `yaml:"production-server,omitempty"`
+	// Suites it applies to. Default: e2e and smoke.
+	Suites []string `yaml:"suites,omitempty"`
+}
+
+const productionServerArg = "--production-server"
+
+var defaultE2ESuites = []string{"e2e", "smoke"}
+
+// productionServer reports whether the suite runs against an isolated
+// production server, and returns the extra arguments meant for the runner.
+func (e E2ESettings) productionServer(suite string, extraArgs []string) (bool, []string) {
+	requested := slices.Contains(extraArgs, productionServerArg)
+	runnerArgs := slices.DeleteFunc(slices.Clone(extraArgs), func(arg string) bool { return arg == productionServerArg })
+	suites := e.Suites
+	if len(suites) == 0 {
+		suites = defaultE2ESuites
+	}
+	return (e.ProductionServer || requested) && slices.Contains(suites, suite), runnerArgs
+}
+
+// productionServerStage is where the scratch copy is built: the .codefly
+// directory of the service, outside the source tree, so the project's
+// TypeScript, test and lint globs never pick up a second copy of the app.
+// Container runners mount the whole service directory. The stage keeps its
+// .next between runs so builds reuse their cache.
+func productionServerStage(serviceDir string) string {
+	return filepath.Join(serviceDir, ".codefly", "production-server")
+}
+
+// stageProductionSource mirrors the source tree into stage, so `next build`
+// never touches the .next directory of a running dev server. Build output,
+// agent state and VCS metadata are skipped; node_modules directories are
+// linked, not copied.
+func stageProductionSource(sourceDir, stage string) error {
+	entries, err := os.ReadDir(stage)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("read production build stage: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.Name() == ".next" {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(stage, entry.Name())); err != nil {
+			return fmt.Errorf("clear production build stage: %w", err)
+		}
+	}
+	return filepath.WalkDir(sourceDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+		if relative == "." {
+			return os.MkdirAll(stage, 0o755)
+		}
+		destination := filepath.Join(stage, relative)
+		if entry.IsDir() {
+			switch entry.Name() {
+			case ".next", ".codefly", ".git":
+				return filepath.SkipDir
+			case "node_modules":
+				target, err := filepath.Rel(filepath.Dir(destination), path)
+				if err != nil {
+					return err
+				}
+				if err := os.Symlink(target, destination); err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(destination, 0o755)
+		}
+		if entry.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, destination)
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		return copyFile(path, destination)
+	})
+}
+
+// freeLocalPort asks the kernel for a port nothing listens on.
+func freeLocalPort() (uint32, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("find a free port: %w", err)
+	}
+	defer listener.Close()
+	return uint32(listener.Addr().(*net.TCPAddr).Port), nil
+}
+
+// isolatedProductionServer is a production server started for one test run.
+type isolatedProductionServer struct {
+	address string
+	proc    runners.Proc
+}
+
+func (p *isolatedProductionServer) stop(ctx context.Context) error {
+	return p.proc.Stop(ctx)
+}
+
+// startIsolatedProductionServer builds a scratch copy of the project and
+// starts its production server on an ephemeral port. It shares nothing with
+// the running dev server but node_modules; the caller stops it.
+func (s *Runtime) startIsolatedProductionServer(ctx context.Context, manager *nodePackageManager, envs []*resources.EnvironmentVariable) (*isolatedProductionServer, error) {
+	if s.Runtime.IsContainerRuntime() {
+		// The container publishes only the HTTP endpoint's port, chosen at
+		// Init; an ephemeral port picked now is unreachable from the agent.
+		return nil, fmt.Errorf("e2e production-server is not supported in container runtime mode; run the suite natively or with nix, or against the running server")
+	}
+	stage := productionServerStage(s.Location)
+	if err := stageProductionSource(s.sourceLocation, stage); err != nil {
+		return nil, fmt.Errorf("stage production build: %w", err)
+	}
+	// Processes run from the source directory.
+	project, err := filepath.Rel(s.sourceLocation, stage)
+	if err != nil {
+		return nil, fmt.Errorf("locate production build stage: %w", err)
+	}
+	port, err := freeLocalPort()
+	if err != nil {
+		return nil, err
+	}
+	envs = append(slices.Clone(envs),
+		resources.Env("NODE_ENV", "production"),
+		resources.Env("NEXT_TELEMETRY_DISABLED", "1"),
+	)
+
+	s.Wool.Forwardf("building isolated Next.js production server for the test run...")
+	buildCommand, buildArgs := manager.command(manager.inDir(project, manager.runScriptArgs("build")...)...)
+	build, err := s.runnerEnvironment.NewProcess(buildCommand, buildArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("create production build process: %w", err)
+	}
+	build.WithEnvironmentVariables(ctx, envs...)
+	build.WithOutput(s.Logger)
+	if err := build.Run(ctx); err != nil {
+		return nil, fmt.Errorf("build production server: %w", err)
+	}
+
+	launch, err := prepareProductionServer(s.sourceLocation, project, manager, port)
+	if err != nil {
+		return nil, err
+	}
+	proc, err := s.runnerEnvironment.NewProcess(launch.command, launch.args...)
+	if err != nil {
+		return nil, fmt.Errorf("create production server process: %w", err)
+	}
+	proc.WithEnvironmentVariables(ctx, envs...)
+	proc.WithEnvironmentVariables(ctx, launch.environment...)
+	proc.WithOutput(s.Logger)
+	if err := proc.Start(ctx); err != nil {
+		return nil, fmt.Errorf("start production server: %w", err)
+	}
+	server := &isolatedProductionServer{address: fmt.Sprintf("http://localhost:%d", port), proc: proc}
+	if err := s.waitForIsolatedServer(ctx, server.address); err != nil {
+		_ = server.stop(ctx)
+		return nil, fmt.Errorf("production server did not become ready: %w", err)
+	}
+	s.Wool.Info("isolated production server ready", wool.Field("address", server.address))
+	return server, nil
+}
+
+// waitForIsolatedServer applies the readiness contract of `codefly run` with
+// the production timeout.
+func (s *Runtime) waitForIsolatedServer(ctx context.Context, address string) error {
+	contract, err := s.Settings.ReadinessContract()
+	if err != nil {
+		return err
+	}
+	timeout, err := s.Settings.ReadinessTimeoutFor(NextExecutionProduction)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 2 * time.Second}
+	return waitForHTTPReady(ctx, client, address, contract, timeout, 250*time.Millisecond)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestE2EProductionServerAppliesToConfiguredSuites(t *testing.T) {
+	enabled, args := E2ESettings{}.productionServer("e2e", []string{"--headed"})
+	require.False(t, enabled)
+	require.Equal(t, []string{"--headed"}, args)
+
+	enabled, args = E2ESettings{}.productionServer("smoke", []string{"--production-server", "--headed"})
+	require.True(t, enabled)
+	require.Equal(t, []string{"--headed"}, args, "the agent flag never reaches the runner")
+
+	enabled, _ = E2ESettings{ProductionServer: true}.productionServer("e2e", nil)
+	require.True(t, enabled)
+	enabled, _ = E2ESettings{ProductionServer: true}.productionServer("unit", nil)
+	require.False(t, enabled)
+	enabled, _ = E2ESettings{ProductionServer: true, Suites: []string{"checkout"}}.productionServer("checkout", nil)
+	require.True(t, enabled)
+	enabled, args = E2ESettings{ProductionServer: true, Suites: []string{"checkout"}}.productionServer("e2e", []string{"--production-server"})
+	require.False(t, enabled)
+	require.Empty(t, args)
+}
+
+func TestStageProductionSourceMirrorsSourcesAndLinksDependencies(t *testing.T) {
+	service := t.TempDir()
+	source := filepath.Join(service, "code")
+	writeProductionTestFile(t, source, "package.json", `{"scripts":{"build":"next build"}}`)
+	writeProductionTestFile(t, source, "app/page.tsx", "page")
+	writeProductionTestFile(t, source, "node_modules/next/package.json", "next")
+	writeProductionTestFile(t, source, "packages/ui/node_modules/react/package.json", "react")
+	writeProductionTestFile(t, source, ".next/BUILD_ID", "dev")
+	writeProductionTestFile(t, source, ".git/HEAD", "ref")
+	writeProductionTestFile(t, source, ".codefly/visual-baselines/home.png", "png")
+
+	stage := productionServerStage(service)
+	require.Equal(t, filepath.Join(service, ".codefly", "production-server"), stage, "the stage is outside the source tree")
+	writeProductionTestFile(t, stage, ".next/cache/webpack/entry", "cache")
+	writeProductionTestFile(t, stage, "app/removed.tsx", "stale")
+
+	require.NoError(t, stageProductionSource(source, stage))
+	require.FileExists(t, filepath.Join(stage, "package.json"))
+	require.FileExists(t, filepath.Join(stage, "app/page.tsx"))
+	require.NoFileExists(t, filepath.Join(stage, "app/removed.tsx"))
+	require.NoFileExists(t, filepath.Join(stage, ".next/BUILD_ID"), "the dev server's build output is never shared")
+	require.FileExists(t, filepath.Join(stage, ".next/cache/webpack/entry"), "the stage keeps its own build cache")
+	require.NoDirExists(t, filepath.Join(stage, ".git"))
+	require.NoDirExists(t, filepath.Join(stage, ".codefly"))
+
+	link, err := os.Readlink(filepath.Join(stage, "node_modules"))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join("..", "..", "code", "node_modules"), link)
+	require.FileExists(t, filepath.Join(stage, "node_modules/next/package.json"))
+	require.FileExists(t, filepath.Join(stage, "packages/ui/node_modules/react/package.json"))
+
+	require.NoError(t, stageProductionSource(source, stage), "restaging replaces the previous copy")
+	require.FileExists(t, filepath.Join(stage, "app/page.tsx"))
+}
+
+func TestFreeLocalPortCanBeListenedOn(t *testing.T) {
+	port, err := freeLocalPort()
+	require.NoError(t, err)
+	require.NotZero(t, port)
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port))))
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+}
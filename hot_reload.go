@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/codefly-dev/core/wool"
+)
+
+// hotReloadAction is what a watched change needs from the running dev server.
+type hotReloadAction string
+
+const (
+	// hotReloadIgnore leaves the change to Fast Refresh inside `next dev`.
+	hotReloadIgnore hotReloadAction = "ignore"
+	// hotReloadRestart restarts `next dev`, which reads the change on start.
+	hotReloadRestart hotReloadAction = "restart"
+	// hotReloadReinstall reinstalls dependencies before restarting.
+	hotReloadReinstall hotReloadAction = "reinstall"
+)
+
+// restartFiles are read by `next dev` once, at start. Workspace packages have
+// manifests and configurations of their own, so they count at any depth.
+var restartFiles = []string{"package.json", "tsconfig.json", "jsconfig.json"}
+
+// restartModules are compiled separately from the Fast Refresh graph, at the
+// source root or under src/, whatever their extension.
+var restartModules = []string{"middleware", "proxy"}
+
+// generatedSourceDirs hold agent state, build output and installs; writing
+// them must not look like a source change.
+var generatedSourceDirs = []string{".codefly", ".next", "node_modules"}
+
+// classifyHotReloadChange decides what a change to file, relative to the
+// source directory, needs. Source edits are Fast Refresh's; configuration,
+// environment and dependency changes are not.
+func classifyHotReloadChange(file string) hotReloadAction {
+	file = path.Clean(file)
+	segments := strings.Split(file, "/")
+	if slices.ContainsFunc(segments, func(segment string) bool { return slices.Contains(generatedSourceDirs, segment) }) {
+		return hotReloadIgnore
+	}
+	dir, base := path.Split(file)
+	dir = strings.TrimSuffix(dir, "/")
+	module := strings.TrimSuffix(base, path.Ext(base))
+	switch {
+	case dir == "" && (isNodeLockfile(base) || slices.Contains(nodeDependencyInputs, base)):
+		return hotReloadReinstall
+	case slices.Contains(restartFiles, base), strings.HasPrefix(base, "next.config."),
+		base == ".env", strings.HasPrefix(base, ".env."):
+		return hotReloadRestart
+	case (dir == "" || dir == "src") && slices.Contains(restartModules, module):
+		return hotReloadRestart
+	}
+	return hotReloadIgnore
+}
+
+func isNodeLockfile(name string) bool {
+	for _, lockfile := range nodePackageManagerLockfiles {
+		if lockfile.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// applyHotReloadChange restarts the dev server for the changes Fast Refresh
+// cannot apply, reinstalling dependencies first when a lockfile changed.
+func (s *Runtime) applyHotReloadChange(eventPath string) {
+	action := hotReloadRestart
+	if file, ok := s.watchedSourcePath(eventPath); ok {
+		action = classifyHotReloadChange(file)
+	} else if filepath.Base(eventPath) != "service.codefly.yaml" {
+		action = hotReloadIgnore
+	}
+	switch action {
+	case hotReloadIgnore:
+		s.Wool.Debug("change left to Fast Refresh", wool.Field("path", eventPath))
+		return
+	case hotReloadReinstall:
+		// An install takes a while: run it off the event loop, which keeps
+		// taking changes, and restart once it is done. A server start in
+		// between waits for the install on the dependencies lock. A failed
+		// install keeps the running server: restarting it on a broken
+		// node_modules would only trade a stale server for a dead one.
+		s.Wool.Forwardf("dependencies changed (%s): reinstalling before restart", filepath.Base(eventPath))
+		go func() {
+			if err := s.reinstallNodeDependencies(s.Wool.Inject(context.Background())); err != nil {
+				s.Wool.Warn("cannot reinstall Node.js dependencies", wool.ErrField(err))
+				s.Wool.Forwardf("reinstalling Node.js dependencies failed, server not restarted: %v", err)
+				return
+			}
+			s.Wool.Info("detected change requiring re-start", wool.Field("path", eventPath))
+			s.Runtime.DesiredStart()
+		}()
+		return
+	}
+	s.Wool.Info("detected change requiring re-start", wool.Field("path", eventPath))
+	s.Runtime.DesiredStart()
+}
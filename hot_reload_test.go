@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyHotReloadChangeLeavesSourceEditsToFastRefresh(t *testing.T) {
+	for _, file := range []string{
+		"app/page.tsx",
+		"src/components/nav.tsx",
+		"app/globals.css",
+		"src/lib/config.json",
+		"node_modules/next/package.json",
+		"packages/ui/node_modules/react/package.json",
+		".next/server/.env",
+		"src/app/middleware.ts",
+		"src/middleware/auth.ts",
+	} {
+		require.Equal(t, hotReloadIgnore, classifyHotReloadChange(file), file)
+	}
+}
+
+func TestClassifyHotReloadChangeRestartsForConfiguration(t *testing.T) {
+	for _, file := range []string{
+		"next.config.ts",
+		"next.config.mjs",
+		"package.json",
+		"tsconfig.json",
+		".env",
+		".env.local",
+		"middleware.ts",
+		"src/middleware.ts",
+		"src/middleware.mjs",
+		"middleware.tsx",
+		"proxy.ts",
+		"./tsconfig.json",
+		"packages/ui/package.json",
+		"packages/ui/tsconfig.json",
+		"apps/web/.env.local",
+		"apps/web/next.config.js",
+	} {
+		require.Equal(t, hotReloadRestart, classifyHotReloadChange(file), file)
+	}
+}
+
+func TestClassifyHotReloadChangeReinstallsForDependencies(t *testing.T) {
+	for _, file := range []string{"package-lock.json", "pnpm-lock.yaml", "yarn.lock", "bun.lockb", "pnpm-workspace.yaml"} {
+		require.Equal(t, hotReloadReinstall, classifyHotReloadChange(file), file)
+	}
+	require.Equal(t, hotReloadIgnore, classifyHotReloadChange("packages/ui/yarn.lock"))
+}
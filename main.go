@@ -41,6 +41,16 @@ var requirements = builders.NewDependencies(agent.Name,
 	builders.NewDependency("code").WithPathSelect(shared.NewSelect("*.ts", "*.tsx", "*.js", "*.jsx", "*.css")),
 )
 
+// watchRequirements are what hot reload watches: the sources, and the
+// configuration, environment and lockfiles that need a restart of `next dev`.
+var watchRequirements = builders.NewDependencies(agent.Name,
+	builders.NewDependency("service.codefly.yaml"),
+	builders.NewDependency("code").WithPathSelect(shared.NewSelect(
+		"*.ts", "*.tsx", "*.js", "*.jsx", "*.mjs", "*.cjs", "*.mts", "*.css",
+		"*.json", "*.yaml", "*.yml", "*.toml", "*.lock", "*.lockb", ".env", ".env.*",
+	)),
+)
+
 type Settings struct {
 	Mode              string            `yaml:"mode"` // "ssr" (default) or "static"
 	HotReload         bool              `yaml:"hot-reload"`
@@ -51,6 +61,36 @@ type Settings struct {
 	// deadline. Use a Go duration such as "90s" or "3m". Development defaults
 	// longer because the first request can cold-compile the application.
 	ReadinessTimeout string `yaml:"readiness-timeout,omitempty"`
+	// Readiness is the HTTP readiness contract shared by `codefly run` and
+	// the generated Kubernetes probes. See ReadinessSettings for defaults.
+	Readiness ReadinessSettings `yaml:"readiness,omitempty"`
+	// PackageManager overrides lockfile and package.json#packageManager
+	// detection: "npm", "pnpm", "yarn", or "bun", optionally pinned as
+	// "pnpm@9.12.0". Leave empty to detect from the project.
+	PackageManager string `yaml:"package-manager,omitempty"`
+	// BundleBudgets fail Runtime.Build when first-load or total static JS
+	// grows past its limit. See BundleBudgetSettings.
+	BundleBudgets BundleBudgetSettings `yaml:"bundle-budgets,omitempty"`
+	// Perf sets the default routes and thresholds of the `perf` command.
+	Perf PerfSettings `yaml:"perf,omitempty"`
+	// A11y sets extra routes and the failing impact of the `a11y` command
+	// and test suite.
+	A11y A11ySettings `yaml:"a11y,omitempty"`
+	// Visual sets the routes, viewports and tolerance of the `visual`
+	// command and test suite.
+	Visual VisualSettings `yaml:"visual,omitempty"`
+	// E2E runs the e2e and smoke suites against an isolated production
+	// server instead of the running one.
+	E2E E2ESettings `yaml:"e2e,omitempty"`
+	// Test sets the parallelism, retries and coverage thresholds of
+	// Runtime.Test.
+	Test TestSettings `yaml:"test,omitempty"`
+	// Offline installs dependencies only from a local package cache that
+	// the `prefetch` command fills.
+	Offline OfflineSettings `yaml:"offline,omitempty"`
+	// Registry points installs at a private registry with tokens from
+	// workspace configurations. See RegistrySettings.
+	Registry RegistrySettings `yaml:"registry,omitempty"`
 
 	// RuntimeImage overrides the codefly-built runtime image. Format:
 	// "name:tag". :latest and untagged refs are rejected — pinning is
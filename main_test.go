@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
 	"testing"
 	"time"
@@ -125,6 +126,19 @@ func TestInitAppliesRequestedRuntimeContextBeforeNetworkValidation(t *testing.T)
 	require.Equal(t, resources.RuntimeContextContainer, runtime.Runtime.RuntimeContext.Kind)
 }
 
+func TestAutoRuntimeContextLooksUpThePackageManagerToolchain(t *testing.T) {
+	binDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "bun"), []byte("#!/bin/sh\n"), 0o755))
+	t.Setenv("PATH", binDir)
+
+	require.Equal(t, resources.RuntimeContextNative, setNextjsRuntimeContext(nil, "bun").Kind)
+	require.Equal(t, resources.RuntimeContextContainer, setNextjsRuntimeContext(nil, "npm").Kind, "neither npm nor nix is on PATH")
+	require.Equal(t, resources.RuntimeContextNix, setNextjsRuntimeContext(resources.NewRuntimeContextNix(), "bun").Kind)
+
+	pnpm, _ := (&nodePackageManager{Kind: nodePackageManagerPNPM}).command()
+	require.Equal(t, "corepack", pnpm)
+}
+
 func TestSourceOnlyNodeRuntimeInitializesWithoutHTTPEndpointOrInstallingDependencies(t *testing.T) {
 	ctx := context.Background()
 	tmpDir := t.TempDir()
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type nextOutputEventKind string
+
+const (
+	nextCompileStarted nextOutputEventKind = "compile-started"
+	nextCompiled       nextOutputEventKind = "compiled"
+	nextServerReady    nextOutputEventKind = "ready"
+	nextModuleNotFound nextOutputEventKind = "module-not-found"
+	nextTypeError      nextOutputEventKind = "type-error"
+	nextCompileFailed  nextOutputEventKind = "compile-failed"
+	nextRuntimeError   nextOutputEventKind = "runtime-error"
+)
+
+// nextOutputEvent is one typed fact recovered from `next dev` / `next start`
+// output.
+type nextOutputEvent struct {
+	Kind nextOutputEventKind
+	// Route is the compiled or failing route when Next.js names it.
+	Route    string
+	Duration time.Duration
+	Modules  int
+	// File, Line, and Column locate a compile error or the first project
+	// frame of a runtime error, relative to the source directory.
+	File    string
+	Line    int
+	Column  int
+	Message string
+	// Module is the specifier a module-not-found error could not resolve.
+	Module string
+	Stack  []string
+}
+
+// failed reports whether the event is a compile or runtime error.
+func (e nextOutputEvent) failed() bool {
+	switch e.Kind {
+	case nextModuleNotFound, nextTypeError, nextCompileFailed, nextRuntimeError:
+		return true
+	}
+	return false
+}
+
+// location renders file:line:column, omitting unknown parts.
+func (e nextOutputEvent) location() string {
+	switch {
+	case e.File == "":
+		return ""
+	case e.Line == 0:
+		return e.File
+	default:
+		return fmt.Sprintf("%s:%d:%d", e.File, e.Line, e.Column)
+	}
+}
+
+// statusLine is the compact one-line compile status shown in the CLI.
+func (e nextOutputEvent) statusLine() string {
+	route := ""
+	if e.Route != "" {
+		route = " " + e.Route
+	}
+	at := ""
+	if location := e.location(); location != "" {
+		at = " (" + location + ")"
+	}
+	switch e.Kind {
+	case nextCompileStarted:
+		return "… compiling" + route
+	case nextCompiled:
+		line := "✓ compiled" + route
+		if e.Duration > 0 {
+			line += " in " + e.Duration.String()
+		}
+		if e.Modules > 0 {
+			line += fmt.Sprintf(" (%d modules)", e.Modules)
+		}
+		return line
+	case nextServerReady:
+		return "✓ ready in " + e.Duration.String()
+	case nextModuleNotFound:
+		return "✗" + route + " module not found: " + e.Message + at
+	case nextTypeError:
+		return "✗" + route + " type error: " + e.Message + at
+	case nextCompileFailed:
+		return "✗" + route + " compile failed: " + e.Message + at
+	case nextRuntimeError:
+		return "✗" + route + " " + e.Message + at
+	}
+	return string(e.Kind)
+}
+
+var (
+	nextANSI         = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+	nextCompiling    = regexp.MustCompile(`^(?:[○◐◑◒◓]\s+|-\s+wait\s+)?[Cc]ompiling(?:\s+(/\S*))?.*\.\.\.$`)
+	nextCompiledLine = regexp.MustCompile(`^(?:✓\s+|-\s+event\s+)?[Cc]ompiled\s+(?:(/\S*|middleware|instrumentation)\s+)?(?:client and server successfully\s+)?in\s+([\d.]+\s*(?:ms|s|min))(?:\s+\((\d+)\s+modules\))?`)
+	nextReadyLine    = regexp.MustCompile(`^(?:✓\s+|-\s+ready\s+)?Ready in\s+([\d.]+\s*(?:ms|s|min))`)
+	nextLocation     = regexp.MustCompile(`^(?:⨯\s+)?(\.{0,2}/[^\s:]+\.(?:[cm]?[jt]sx?|css|scss|sass|json|mdx))(?::(\d+):(\d+))?$`)
+	nextModuleLine   = regexp.MustCompile(`^Module not found:\s*(?:Error:\s*)?(.*)$`)
+	nextResolve      = regexp.MustCompile(`[Cc]an't resolve '([^']+)'`)
+	nextTypeLine     = regexp.MustCompile(`^Type error:\s*(.*)$`)
+	nextRuntimeLine  = regexp.MustCompile(`^(?:⨯\s+)?(?:(?:unhandledRejection|uncaughtException):?\s+)?\[?((?:[A-Z]\w*)?Error(?::\s*[^\]]*)?)\]?(?:\s*\{.*)?$`)
+	nextStackLine    = regexp.MustCompile(`^at\s+`)
+	nextStackSource  = regexp.MustCompile(`(?:webpack-internal:///(?:\([^)]*\)/)?)?(\./[^\s:()]+):(\d+):(\d+)`)
+	nextRequestLine  = regexp.MustCompile(`^(?:GET|HEAD|POST|PUT|PATCH|DELETE|OPTIONS)\s+(/\S*)\s+(\d{3})\s+in\s+`)
+	nextDurationPart = regexp.MustCompile(`^([\d.]+)\s*(ms|s|min)$`)
+)
+
+// nextOutputParser turns the server's output into typed events. It is an
+// io.Writer so it can sit beside the service logger on the process output;
+// the raw text still reaches the logger unchanged.
+type nextOutputParser struct {
+	emit func(nextOutputEvent)
+
+	mu      sync.Mutex
+	partial string
+	// compiling is the route of the last compile start, attributed to
+	// compile errors that do not name their route.
+	compiling string
+	// location is a compile error's file line, waiting for its message.
+	location *nextOutputEvent
+	// runtime is a runtime error collecting its stack; it is emitted at the
+	// first line that does not continue it, usually the failed request's log
+	// line that names the route.
+	runtime *nextOutputEvent
+}
+
+func newNextOutputParser(emit func(nextOutputEvent)) *nextOutputParser {
+	return &nextOutputParser{emit: emit}
+}
+
+func (p *nextOutputParser) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	lines := strings.Split(p.partial+string(data), "\n")
+	p.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		p.line(line)
+	}
+	return len(data), nil
+}
+
+func (p *nextOutputParser) line(raw string) {
+	line := strings.TrimSpace(nextANSI.ReplaceAllString(strings.TrimRight(raw, "\r"), ""))
+	if line == "" {
+		return
+	}
+
+	if p.runtime != nil {
+		if nextStackLine.MatchString(line) {
+			p.runtime.Stack = append(p.runtime.Stack, line)
+			if p.runtime.File == "" {
+				if match := nextStackSource.FindStringSubmatch(line); match != nil {
+					p.runtime.File = strings.TrimPrefix(match[1], "./")
+					p.runtime.Line, _ = strconv.Atoi(match[2])
+					p.runtime.Column, _ = strconv.Atoi(match[3])
+				}
+			}
+			return
+		}
+		// Next.js 15 prints the error digest object after the stack.
+		if strings.HasPrefix(line, "digest:") || line == "}" {
+			return
+		}
+		if match := nextRequestLine.FindStringSubmatch(line); match != nil && match[2] >= "500" {
+			p.flushRuntime(match[1])
+			return
+		}
+		p.flushRuntime("")
+	}
+
+	if p.location != nil {
+		event := *p.location
+		p.location = nil
+		if match := nextModuleLine.FindStringSubmatch(line); match != nil {
+			event.Kind = nextModuleNotFound
+			event.Message = match[1]
+			if resolve := nextResolve.FindStringSubmatch(match[1]); resolve != nil {
+				event.Module = resolve[1]
+			}
+		} else if match := nextTypeLine.FindStringSubmatch(line); match != nil {
+			event.Kind = nextTypeError
+			event.Message = match[1]
+		} else {
+			event.Kind = nextCompileFailed
+			event.Message = strings.TrimSpace(strings.TrimPrefix(line, "Error:"))
+		}
+		p.emit(event)
+		return
+	}
+
+	switch {
+	case nextCompiledLine.MatchString(line):
+		match := nextCompiledLine.FindStringSubmatch(line)
+		event := nextOutputEvent{Kind: nextCompiled, Route: match[1], Duration: parseNextDuration(match[2])}
+		if event.Route == "" {
+			event.Route = p.compiling
+		}
+		event.Modules, _ = strconv.Atoi(match[3])
+		p.compiling = ""
+		p.emit(event)
+	case nextCompiling.MatchString(line):
+		p.compiling = nextCompiling.FindStringSubmatch(line)[1]
+		p.emit(nextOutputEvent{Kind: nextCompileStarted, Route: p.compiling})
+	case nextReadyLine.MatchString(line):
+		p.emit(nextOutputEvent{Kind: nextServerReady, Duration: parseNextDuration(nextReadyLine.FindStringSubmatch(line)[1])})
+	case nextLocation.MatchString(line):
+		match := nextLocation.FindStringSubmatch(line)
+		event := &nextOutputEvent{Route: p.compiling, File: strings.TrimPrefix(match[1], "./")}
+		event.Line, _ = strconv.Atoi(match[2])
+		event.Column, _ = strconv.Atoi(match[3])
+		p.location = event
+	case nextModuleLine.MatchString(line):
+		match := nextModuleLine.FindStringSubmatch(line)
+		event := nextOutputEvent{Kind: nextModuleNotFound, Route: p.compiling, Message: match[1]}
+		if resolve := nextResolve.FindStringSubmatch(match[1]); resolve != nil {
+			event.Module = resolve[1]
+		}
+		p.emit(event)
+	case nextTypeLine.MatchString(line):
+		p.emit(nextOutputEvent{Kind: nextTypeError, Route: p.compiling, Message: nextTypeLine.FindStringSubmatch(line)[1]})
+	case nextRuntimeLine.MatchString(line):
+		p.runtime = &nextOutputEvent{Kind: nextRuntimeError, Message: nextRuntimeLine.FindStringSubmatch(line)[1]}
+	}
+}
+
+// flush ends the stream once the process is gone. It parses an unterminated
+// last line and emits a runtime error still collecting its stack, so a crash
+// at the very end of the output is not lost.
+func (p *nextOutputParser) flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.partial != "" {
+		line := p.partial
+		p.partial = ""
+		p.line(line)
+	}
+	p.flushRuntime("")
+	p.location = nil
+}
+
+// flushRuntime emits the pending runtime error, attributed to the route of
+// the failed request that followed it when known.
+func (p *nextOutputParser) flushRuntime(route string) {
+	if p.runtime == nil {
+		return
+	}
+	event := *p.runtime
+	p.runtime = nil
+	if route != "" {
+		event.Route = route
+	}
+	p.emit(event)
+}
+
+// parseNextDuration reads Next.js timings such as "3.2s", "250ms", or
+// "300 ms".
+func parseNextDuration(value string) time.Duration {
+	match := nextDurationPart.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0
+	}
+	amount, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0
+	}
+	unit := time.Millisecond
+	switch match[2] {
+	case "s":
+		unit = time.Second
+	case "min":
+		unit = time.Minute
+	}
+	return time.Duration(amount * float64(unit)).Round(time.Millisecond)
+}
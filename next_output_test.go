@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func parseNextOutput(t *testing.T, chunks ...string) []nextOutputEvent {
+	t.Helper()
+	var events []nextOutputEvent
+	parser := newNextOutputParser(func(event nextOutputEvent) {
+		events = append(events, event)
+	})
+	for _, chunk := range chunks {
+		_, err := parser.Write([]byte(chunk))
+		require.NoError(t, err)
+	}
+	return events
+}
+
+func TestNextOutputParserReadsCompileTimings(t *testing.T) {
+	events := parseNextOutput(t,
+		"   ▲ Next.js 15.1.0\n   - Local:        http://localhost:3000\n\n ✓ Ready in 1.4s\n",
+		" ○ Compiling /dashboard ...\n ✓ Compiled /dashboard in 3.2s (1234 mod",
+		"ules)\n \x1b[32m✓\x1b[39m Compiled in 250ms (600 modules)\n",
+		"- wait compiling /page (client and server)...\n- event compiled client and server successfully in 300 ms (20 modules)\n",
+	)
+	require.Equal(t, []nextOutputEvent{
+		{Kind: nextServerReady, Duration: 1400 * time.Millisecond},
+		{Kind: nextCompileStarted, Route: "/dashboard"},
+		{Kind: nextCompiled, Route: "/dashboard", Duration: 3200 * time.Millisecond, Modules: 1234},
+		{Kind: nextCompiled, Duration: 250 * time.Millisecond, Modules: 600},
+		{Kind: nextCompileStarted, Route: "/page"},
+		{Kind: nextCompiled, Route: "/page", Duration: 300 * time.Millisecond, Modules: 20},
+	}, events)
+	require.Equal(t, "✓ compiled /dashboard in 3.2s (1234 modules)", events[2].statusLine())
+}
+
+func TestNextOutputParserLocatesModuleNotFoundAndTypeErrors(t *testing.T) {
+	events := parseNextOutput(t,
+		" ○ Compiling /settings ...\n",
+		" ⨯ ./src/app/settings/page.tsx:3:1\n",
+		"Module not found: Can't resolve '@/components/missing'\n",
+		"\n  1 | import Missing from '@/components/missing';\n",
+		"Failed to compile.\n\n./src/lib/api.ts:10:5\nType error: Property 'id' does not exist on type 'User'.\n",
+		"./src/app/page.tsx\nError:   x Expected ';', got 'foo'\n",
+	)
+	require.Len(t, events, 4)
+	require.Equal(t, nextOutputEvent{
+		Kind: nextModuleNotFound, Route: "/settings", File: "src/app/settings/page.tsx", Line: 3, Column: 1,
+		Message: "Can't resolve '@/components/missing'", Module: "@/components/missing",
+	}, events[1])
+	require.Equal(t, "✗ /settings module not found: Can't resolve '@/components/missing' (src/app/settings/page.tsx:3:1)", events[1].statusLine())
+	require.Equal(t, nextTypeError, events[2].Kind)
+	require.Equal(t, "src/lib/api.ts:10:5", events[2].location())
+	require.Equal(t, "Property 'id' does not exist on type 'User'.", events[2].Message)
+	require.Equal(t, nextOutputEvent{
+		Kind: nextCompileFailed, Route: "/settings", File: "src/app/page.tsx", Message: "x Expected ';', got 'foo'",
+	}, events[3])
+}
+
+func TestNextOutputParserCollectsRuntimeErrorStacks(t *testing.T) {
+	events := parseNextOutput(t,
+		" ⨯ TypeError: Cannot read properties of undefined (reading 'name')\n",
+		"    at Page (webpack-internal:///(rsc)/./src/app/profile/page.tsx:12:9)\n",
+		"    at stringify (<anonymous>)\n",
+		"  digest: \"1234\"\n",
+		" GET /profile 500 in 87ms\n",
+		" ⨯ [Error: boom] { digest: '42' }\n",
+		" GET / 200 in 12ms\n",
+	)
+	require.Len(t, events, 2)
+	require.Equal(t, nextRuntimeError, events[0].Kind)
+	require.Equal(t, "/profile", events[0].Route)
+	require.Equal(t, "TypeError: Cannot read properties of undefined (reading 'name')", events[0].Message)
+	require.Equal(t, "src/app/profile/page.tsx:12:9", events[0].location())
+	require.Len(t, events[0].Stack, 2)
+	require.True(t, events[0].failed())
+
+	require.Equal(t, nextOutputEvent{Kind: nextRuntimeError, Message: "Error: boom"}, events[1])
+}
+
+func TestNextOutputParserFlushesARuntimeErrorAtTheEndOfTheStream(t *testing.T) {
+	var events []nextOutputEvent
+	parser := newNextOutputParser(func(event nextOutputEvent) {
+		events = append(events, event)
+	})
+	_, err := parser.Write([]byte(" ⨯ uncaughtException: RangeError: Maximum call stack size exceeded\n" +
+		"    at loop (webpack-internal:///(rsc)/./src/lib/loop.ts:3:5)\n" +
+		"    at loop (webpack-internal:///(rsc)/./src/lib/loop.ts:3:5)"))
+	require.NoError(t, err)
+	require.Empty(t, events, "the stack may continue until the stream ends")
+
+	parser.flush()
+	require.Len(t, events, 1)
+	require.Equal(t, "RangeError: Maximum call stack size exceeded", events[0].Message)
+	require.Equal(t, "src/lib/loop.ts:3:5", events[0].location())
+	require.Len(t, events[0].Stack, 2)
+
+	parser.flush()
+	require.Len(t, events, 1, "a flushed error is emitted once")
+}
+
+func TestNextOutputParserIgnoresOrdinaryLogLines(t *testing.T) {
+	events := parseNextOutput(t,
+		"rendering ErrorBoundary fallback\n",
+		" GET /api/healthz 200 in 4ms\n",
+		"Compiling is slow on this machine\n",
+	)
+	require.Empty(t, events)
+}
+
+func TestParseNextDuration(t *testing.T) {
+	require.Equal(t, 3200*time.Millisecond, parseNextDuration("3.2s"))
+	require.Equal(t, 300*time.Millisecond, parseNextDuration("300 ms"))
+	require.Equal(t, 90*time.Second, parseNextDuration("1.5min"))
+	require.Zero(t, parseNextDuration("soon"))
+}
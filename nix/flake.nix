@@ -12,7 +12,8 @@
     in
     {
       # devShell exposes nodejs so the codefly NixEnvironment runs the Next.js
-      # service (npm/node) reproducibly — no system node needed.
+      # service (npm/node) reproducibly — no system node needed. pnpm and Yarn
+      # run through the Corepack bundled with nodejs; Bun ships its own binary.
       devShells = forAllSystems (system:
         let
           pkgs = nixpkgs.legacyPackages.${system};
@@ -21,6 +22,7 @@
           default = pkgs.mkShell {
             packages = [
               pkgs.nodejs
+              pkgs.bun
             ];
           };
         });
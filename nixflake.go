@@ -5,7 +5,7 @@ package main
 // In nix mode the agent runs the Next.js service through a NixEnvironment rooted
 // at the service source dir (CreateRunnerEnvironment), which materializes the
 // devShell from a flake.nix there. User projects don't ship one, so this embeds
-// a codefly flake (nodejs) and writes it into the source dir when absent — a
+// a codefly flake (nodejs, bun) and writes it into the source dir when absent — a
 // user-supplied flake.nix is respected (never overwritten).
 
 import (
@@ -21,7 +21,7 @@ var nixFlakeNix string
 //go:embed nix/flake.lock
 var nixFlakeLock string
 
-// ensureNixFlake writes the embedded flake (nodejs) into dir unless a flake.nix
+// ensureNixFlake writes the embedded flake (nodejs, bun) into dir unless a flake.nix
 // already exists there.
 func ensureNixFlake(dir string) error {
 	if _, err := os.Stat(filepath.Join(dir, "flake.nix")); err == nil {
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codefly-dev/core/wool"
+)
+
+// OfflineSettings install dependencies strictly from a local package cache,
+// for machines without registry access. The `prefetch` command fills the
+// cache from the lockfile while online. Only npm projects are supported, and
+// every locked package needs an integrity: git dependencies have none, so
+// they cannot be verified offline and must come from a registry instead.
+type OfflineSettings struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// CacheDir is the package cache, relative to the service directory.
+	// Default: .codefly/package-cache. It lives under the service directory
+	// so native, nix and container runners all see the same files.
+	CacheDir string `yaml:"cache-dir,omitempty"`
+}
+
+const defaultPackageCacheDir = ".codefly/package-cache"
+
+// prefetchBatch bounds the tarballs handed to one `npm cache add`, keeping
+// the argument vector well under the platform limits.
+const prefetchBatch = 64
+
+// validate rejects offline mode for a project it cannot install, so the
+// service fails at Load rather than at its first install.
+func (o OfflineSettings) validate(manager *nodePackageManager) error {
+	if !o.Enabled {
+		return nil
+	}
+	return supportsOfflineInstalls(manager)
+}
+
+func supportsOfflineInstalls(manager *nodePackageManager) error {
+	if manager.Kind != nodePackageManagerNPM {
+		return fmt.Errorf("offline installs support npm projects; this project uses %s", manager.Kind)
+	}
+	if manager.Lockfile == "" {
+		return fmt.Errorf("offline installs need a committed package-lock.json")
+	}
+	return nil
+}
+
+// cacheDir resolves the package cache against the service directory.
+func (o OfflineSettings) cacheDir(serviceDir string) string {
+	dir := filepath.FromSlash(o.CacheDir)
+	if dir == "" {
+		dir = filepath.FromSlash(defaultPackageCacheDir)
+	}
+	if filepath.IsAbs(dir) {
+		return filepath.Clean(dir)
+	}
+	return filepath.Join(serviceDir, dir)
+}
+
+// packageTarball is one registry tarball a lockfile pins.
+type packageTarball struct {
+	Name      string
+	Version   string
+	Resolved  string
+	Integrity string
+}
+
+func (t packageTarball) String() string {
+	return t.Name + "@" + t.Version
+}
+
+// npmLockfileTarballs lists the tarballs of a package-lock.json or
+// npm-shrinkwrap.json. Links, workspace packages and packages bundled inside
+// another tarball have nothing of their own to fetch.
+func npmLockfileTarballs(lockfilePath string) ([]packageTarball, error) {
+	content, err := os.ReadFile(lockfilePath)
+	if err != nil {
+		return nil, err
+	}
+	var lockfile struct {
+		LockfileVersion int `json:"lockfileVersion"`
+		Packages        map[string]struct {
+			Name      string `json:"name"`
+			Version   string `json:"version"`
+			Resolved  string `json:"resolved"`
+			Integrity string `json:"integrity"`
+			Link      bool   `json:"link"`
+			InBundle  bool   `json:"inBundle"`
+		} `json:"packages"`
+	}
+	if err := json.Unmarshal(content, &lockfile); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filepath.Base(lockfilePath), err)
+	}
+	if lockfile.LockfileVersion < 2 {
+		return nil, fmt.Errorf("%s has lockfileVersion %d; offline installs need version 2 or later (npm 7+)", filepath.Base(lockfilePath), lockfile.LockfileVersion)
+	}
+	seen := map[string]bool{}
+	var tarballs []packageTarball
+	for key, entry := range lockfile.Packages {
+		if key == "" || entry.Link || entry.InBundle || entry.Resolved == "" {
+			continue
+		}
+		name := entry.Name
+		if name == "" {
+			name = key
+			if i := strings.LastIndex(key, "node_modules/"); i >= 0 {
+				name = key[i+len("node_modules/"):]
+			}
+		}
+		tarball := packageTarball{Name: name, Version: entry.Version, Resolved: entry.Resolved, Integrity: entry.Integrity}
+		// Hoisting conflicts repeat a tarball under several paths.
+		if id := tarball.Resolved + " " + tarball.Integrity; !seen[id] {
+			seen[id] = true
+			tarballs = append(tarballs, tarball)
+		}
+	}
+	sort.Slice(tarballs, func(i, j int) bool {
+		if tarballs[i].Name != tarballs[j].Name {
+			return tarballs[i].Name < tarballs[j].Name
+		}
+		return tarballs[i].Version < tarballs[j].Version
+	})
+	return tarballs, nil
+}
+
+// npmCacheContentPaths returns where npm's content-addressed cache (cacache)
+// stores a tarball for each hash of an SRI integrity string.
+func npmCacheContentPaths(npmCache, integrity string) []string {
+	var paths []string
+	for _, hash := range strings.Fields(integrity) {
+		algorithm, digest, ok := strings.Cut(hash, "-")
+		if !ok {
+			continue
+		}
+		digest, _, _ = strings.Cut(digest, "?")
+		raw, err := base64.StdEncoding.DecodeString(digest)
+		if err != nil || len(raw) < 3 {
+			continue
+		}
+		hexDigest := hex.EncodeToString(raw)
+		paths = append(paths, filepath.Join(npmCache, "_cacache", "content-v2", algorithm, hexDigest[:2], hexDigest[2:4], hexDigest[4:]))
+	}
+	return paths
+}
+
+// missingTarballs lists the tarballs npmCache cannot serve. A tarball without
+// an integrity, such as a git dependency, cannot be verified offline and is
+// always missing.
+func missingTarballs(npmCache string, tarballs []packageTarball) []packageTarball {
+	var missing []packageTarball
+	for _, tarball := range tarballs {
+		cached := false
+		for _, path := range npmCacheContentPaths(npmCache, tarball.Integrity) {
+			if fileExists(path) {
+				cached = true
+				break
+			}
+		}
+		if !cached {
+			missing = append(missing, tarball)
+		}
+	}
+	return missing
+}
+
+// missingTarballsError names every tarball an offline install would need
+// from the network.
+func missingTarballsError(cacheDir string, missing []packageTarball) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "offline package cache %s is missing %d tarball(s); run the prefetch command while online:", cacheDir, len(missing))
+	unverifiable := false
+	for _, tarball := range missing {
+		fmt.Fprintf(&b, "\n  %s (%s)", tarball, tarball.Resolved)
+		if tarball.Integrity == "" {
+			b.WriteString(" has no integrity and cannot be installed offline")
+			unverifiable = true
+		}
+	}
+	if unverifiable {
+		// Prefetching again cannot help these.
+		b.WriteString("\ndependencies without an integrity, such as git dependencies, must be published to a registry to install offline")
+	}
+	return errors.New(b.String())
+}
+
+// packageCache resolves the offline cache of manager's project and the
+// tarballs its lockfile pins. Only npm lockfiles are supported: their
+// integrities address npm's own cache directly, which is what makes the
+// missing list exact. Load already validated the manager; a lockfile change
+// since may have replaced it.
+func (s *Runtime) packageCache(manager *nodePackageManager) (string, []packageTarball, error) {
+	if err := supportsOfflineInstalls(manager); err != nil {
+		return "", nil, err
+	}
+	cacheDir := s.Settings.Offline.cacheDir(s.Location)
+	if s.Runtime.IsContainerRuntime() {
+		// The container sees the service directory at the same path, and
+		// nothing outside it.
+		if relative, err := filepath.Rel(s.Location, cacheDir); err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			return "", nil, fmt.Errorf("offline cache-dir %s must be inside the service directory to be shared with the container", cacheDir)
+		}
+	}
+	tarballs, err := npmLockfileTarballs(filepath.Join(s.sourceLocation, manager.Lockfile))
+	if err != nil {
+		return "", nil, err
+	}
+	return cacheDir, tarballs, nil
+}
+
+// offlineInstallArgs makes an install read only from the package cache, after
+// checking the cache holds every tarball of the lockfile.
+func (s *Runtime) offlineInstallArgs(manager *nodePackageManager, args []string) ([]string, error) {
+	cacheDir, tarballs, err := s.packageCache(manager)
+	if err != nil {
+		return nil, err
+	}
+	npmCache := filepath.Join(cacheDir, "npm")
+	if missing := missingTarballs(npmCache, tarballs); len(missing) > 0 {
+		return nil, missingTarballsError(cacheDir, missing)
+	}
+	return append(args, "--offline", "--cache="+npmCache), nil
+}
+
+// cmdPrefetch fills the package cache with the tarballs of the lockfile that
+// it does not hold yet.
+func (s *Runtime) cmdPrefetch(ctx context.Context, _ noCommandArgs) (string, error) {
+	if s.runnerEnvironment == nil {
+		return "", fmt.Errorf("runner environment is not initialized")
+	}
+	manager, err := s.resolvePackageManager()
+	if err != nil {
+		return "", err
+	}
+	cacheDir, tarballs, err := s.packageCache(manager)
+	if err != nil {
+		return "", err
+	}
+	registryEnvs, err := s.registryEnvironment(manager)
+	if err != nil {
+		return "", err
+	}
+	npmCache := filepath.Join(cacheDir, "npm")
+	missing := missingTarballs(npmCache, tarballs)
+	var fetch []string
+	for _, tarball := range missing {
+		if tarball.Integrity != "" {
+			fetch = append(fetch, tarball.Resolved)
+		}
+	}
+	for start := 0; start < len(fetch); start += prefetchBatch {
+		batch := fetch[start:min(start+prefetchBatch, len(fetch))]
+		args := append([]string{"cache", "add", "--cache=" + npmCache}, batch...)
+		s.Wool.Info("prefetching packages", wool.Field("count", len(batch)), wool.Field("cache", cacheDir))
+		command, commandArgs := manager.command(args...)
+		proc, err := s.runnerEnvironment.NewProcess(command, commandArgs...)
+		if err != nil {
+			return "", fmt.Errorf("create prefetch process: %w", err)
+		}
+		proc.WithOutput(s.Logger)
+		proc.WithEnvironmentVariables(ctx, registryEnvs...)
+		if err := proc.Run(ctx); err != nil {
+			return "", fmt.Errorf("npm cache add failed: %w", err)
+		}
+	}
+	if still := missingTarballs(npmCache, tarballs); len(still) > 0 {
+		return "", missingTarballsError(cacheDir, still)
+	}
+	return fmt.Sprintf("Prefetched %d tarball(s) into %s; it holds all %d tarballs of %s.",
+		len(fetch), cacheDir, len(tarballs), manager.Lockfile), nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sriSHA512(content string) string {
+	sum := sha512.Sum512([]byte(content))
+	return "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestNpmLockfileTarballsListsFetchablePackages(t *testing.T) {
+	dir := t.TempDir()
+	lockfile := filepath.Join(dir, "package-lock.json")
+	require.NoError(t, os.WriteFile(lockfile, []byte(`{
+	  "lockfileVersion": 3,
+	  "packages": {
+	    "": {"name": "web"},
+	    "node_modules/next": {"version": "16.0.0", "resolved": "https://registry.npmjs.org/next/-/next-16.0.0.tgz", "integrity": "sha512-bmV4dA=="},
+	    "node_modules/@scope/ui": {"version": "1.2.0", "resolved": "https://npm.example.com/@scope/ui/-/ui-1.2.0.tgz", "integrity": "sha512-dWk="},
+	    "node_modules/a/node_modules/next": {"version": "16.0.0", "resolved": "https://registry.npmjs.org/next/-/next-16.0.0.tgz", "integrity": "sha512-bmV4dA=="},
+	    "node_modules/react-19": {"name": "react", "version": "19.0.0", "resolved": "https://registry.npmjs.org/react/-/react-19.0.0.tgz", "integrity": "sha512-cmVhY3Q="},
+	    "node_modules/local": {"resolved": "packages/local", "link": true},
+	    "node_modules/sharp/node_modules/detect-libc": {"version": "2.0.0", "inBundle": true},
+	    "packages/local": {"version": "0.0.1"}
+	  }
+	}`), 0o644))
+
+	tarballs, err := npmLockfileTarballs(lockfile)
+	require.NoError(t, err)
+	require.Equal(t, []packageTarball{
+		{Name: "@scope/ui", Version: "1.2.0", Resolved: "https://npm.example.com/@scope/ui/-/ui-1.2.0.tgz", Integrity: "sha512-dWk="},
+		{Name: "next", Version: "16.0.0", Resolved: "https://registry.npmjs.org/next/-/next-16.0.0.tgz", Integrity: "sha512-bmV4dA=="},
+		{Name: "react", Version: "19.0.0", Resolved: "https://registry.npmjs.org/react/-/react-19.0.0.tgz", Integrity: "sha512-cmVhY3Q="},
+	}, tarballs)
+
+	require.NoError(t, os.WriteFile(lockfile, []byte(`{"lockfileVersion": 1, "dependencies": {}}`), 0o644))
+	_, err = npmLockfileTarballs(lockfile)
+	require.ErrorContains(t, err, "lockfileVersion 1")
+}
+
+func TestNpmCacheContentPathsFollowCacache(t *testing.T) {
+	paths := npmCacheContentPaths("/cache", "sha512-3q2+7w== sha1-AQID?foo bogus")
+	require.Equal(t, []string{
+		filepath.Join("/cache", "_cacache", "content-v2", "sha512", "de", "ad", "beef"),
+		filepath.Join("/cache", "_cacache", "content-v2", "sha1", "01", "02", "03"),
+	}, paths)
+}
+
+func TestMissingTarballsListsWhatTheCacheLacks(t *testing.T) {
+	cache := t.TempDir()
+	cached := packageTarball{Name: "next", Version: "16.0.0", Resolved: "https://registry.npmjs.org/next/-/next-16.0.0.tgz", Integrity: sriSHA512("next")}
+	absent := packageTarball{Name: "react", Version: "19.0.0", Resolved: "https://registry.npmjs.org/react/-/react-19.0.0.tgz", Integrity: sriSHA512("react")}
+	git := packageTarball{Name: "fork", Version: "1.0.0", Resolved: "git+ssh://git@github.com/acme/fork.git#abc"}
+	path := npmCacheContentPaths(cache, cached.Integrity)[0]
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte("next"), 0o644))
+
+	missing := missingTarballs(cache, []packageTarball{cached, absent, git})
+	require.Equal(t, []packageTarball{absent, git}, missing)
+
+	err := missingTarballsError("/svc/.codefly/package-cache", missing)
+	require.EqualError(t, err, "offline package cache /svc/.codefly/package-cache is missing 2 tarball(s); run the prefetch command while online:\n"+
+		"  react@19.0.0 (https://registry.npmjs.org/react/-/react-19.0.0.tgz)\n"+
+		"  fork@1.0.0 (git+ssh://git@github.com/acme/fork.git#abc) has no integrity and cannot be installed offline\n"+
+		"dependencies without an integrity, such as git dependencies, must be published to a registry to install offline")
+}
+
+func TestOfflineSettingsValidateRejectsUnsupportedProjects(t *testing.T) {
+	npm := &nodePackageManager{Kind: nodePackageManagerNPM, Lockfile: "package-lock.json"}
+	pnpm := &nodePackageManager{Kind: nodePackageManagerPNPM, Lockfile: "pnpm-lock.yaml"}
+	require.NoError(t, OfflineSettings{}.validate(pnpm), "offline mode is off")
+	require.NoError(t, OfflineSettings{Enabled: true}.validate(npm))
+	require.EqualError(t, OfflineSettings{Enabled: true}.validate(pnpm), "offline installs support npm projects; this project uses pnpm")
+	require.EqualError(t, OfflineSettings{Enabled: true}.validate(&nodePackageManager{Kind: nodePackageManagerNPM}), "offline installs need a committed package-lock.json")
+}
+
+func TestOfflineSettingsCacheDir(t *testing.T) {
+	require.Equal(t, filepath.Join("/svc", ".codefly", "package-cache"), OfflineSettings{}.cacheDir("/svc"))
+	require.Equal(t, filepath.Join("/svc", "vendor", "npm"), OfflineSettings{CacheDir: "vendor/npm"}.cacheDir("/svc"))
+	require.Equal(t, "/mnt/cache", OfflineSettings{CacheDir: "/mnt/cache/"}.cacheDir("/svc"))
+}
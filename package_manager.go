@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type nodePackageManagerKind string
+
+const (
+	nodePackageManagerNPM  nodePackageManagerKind = "npm"
+	nodePackageManagerPNPM nodePackageManagerKind = "pnpm"
+	nodePackageManagerYarn nodePackageManagerKind = "yarn"
+	nodePackageManagerBun  nodePackageManagerKind = "bun"
+)
+
+// nodePackageManagerLockfiles lists every lockfile this agent understands in
+// detection priority. pnpm and Yarn lockfiles win over a stray
+// package-lock.json because a monorepo migrating away from npm usually keeps
+// the old file around for a while; the newer manager owns the install graph.
+var nodePackageManagerLockfiles = []struct {
+	name    string
+	manager nodePackageManagerKind
+}{
+	{"pnpm-lock.yaml", nodePackageManagerPNPM},
+	{"yarn.lock", nodePackageManagerYarn},
+	{"bun.lock", nodePackageManagerBun},
+	{"bun.lockb", nodePackageManagerBun},
+	{"npm-shrinkwrap.json", nodePackageManagerNPM},
+	{"package-lock.json", nodePackageManagerNPM},
+}
+
+// nodeDependencyInputs are the files besides package.json and the lockfiles
+// that change what an install materializes into node_modules.
+var nodeDependencyInputs = []string{"pnpm-workspace.yaml", ".yarnrc.yml", "bunfig.toml"}
+
+// nodePackageManager is the resolved install/script contract for one Node
+// source tree. Every process that installs dependencies or runs a package
+// script goes through it, so a pnpm workspace never falls back to npm halfway
+// through a lifecycle.
+type nodePackageManager struct {
+	Kind nodePackageManagerKind
+	// Version comes from package.json#packageManager when declared.
+	Version string
+	// Lockfile is the manager's lockfile relative to the source directory, or
+	// empty when the project has not committed one.
+	Lockfile string
+	// Berry distinguishes Yarn 2+ from Yarn classic; their frozen-install
+	// flags differ.
+	Berry bool
+}
+
+// detectNodePackageManager resolves the package manager from, in order, the
+// explicit `package-manager` setting, package.json#packageManager (the field
+// Corepack enforces), and the committed lockfile. Projects with none of these
+// keep the historical npm behavior.
+func detectNodePackageManager(sourceDir, override string, manifest *nodePackageManifest) (*nodePackageManager, error) {
+	manager := &nodePackageManager{Kind: nodePackageManagerNPM}
+	switch {
+	case strings.TrimSpace(override) != "":
+		kind, version, err := parseNodePackageManager(override)
+		if err != nil {
+			return nil, fmt.Errorf("invalid package-manager setting: %w", err)
+		}
+		manager.Kind, manager.Version = kind, version
+	case manifest != nil && strings.TrimSpace(manifest.PackageManager) != "":
+		kind, version, err := parseNodePackageManager(manifest.PackageManager)
+		if err != nil {
+			return nil, fmt.Errorf("invalid package.json packageManager: %w", err)
+		}
+		manager.Kind, manager.Version = kind, version
+	default:
+		for _, lockfile := range nodePackageManagerLockfiles {
+			if fileExists(filepath.Join(sourceDir, lockfile.name)) {
+				manager.Kind = lockfile.manager
+				break
+			}
+		}
+	}
+	for _, lockfile := range nodePackageManagerLockfiles {
+		if lockfile.manager == manager.Kind && fileExists(filepath.Join(sourceDir, lockfile.name)) {
+			manager.Lockfile = lockfile.name
+			break
+		}
+	}
+	if manager.Kind == nodePackageManagerYarn {
+		manager.Berry = yarnBerry(sourceDir, manager.Version)
+	}
+	return manager, nil
+}
+
+// parseNodePackageManager accepts Corepack's `name@version[+hash]` form as
+// well as a bare manager name.
+func parseNodePackageManager(value string) (nodePackageManagerKind, string, error) {
+	name, version, _ := strings.Cut(strings.TrimSpace(value), "@")
+	version, _, _ = strings.Cut(version, "+")
+	switch kind := nodePackageManagerKind(strings.ToLower(name)); kind {
+	case nodePackageManagerNPM, nodePackageManagerPNPM, nodePackageManagerYarn, nodePackageManagerBun:
+		return kind, version, nil
+	default:
+		return "", "", fmt.Errorf("unsupported package manager %q; expected npm, pnpm, yarn, or bun", value)
+	}
+}
+
+// yarnBerry reports whether a Yarn project uses Yarn 2+. The declared version
+// is authoritative; otherwise a .yarnrc.yml or a v2+ lockfile header decides.
+func yarnBerry(sourceDir, version string) bool {
+	if version != "" {
+		return !strings.HasPrefix(version, "1.")
+	}
+	if fileExists(filepath.Join(sourceDir, ".yarnrc.yml")) {
+		return true
+	}
+	lockfile, err := os.ReadFile(filepath.Join(sourceDir, "yarn.lock"))
+	return err == nil && bytes.Contains(lockfile, []byte("__metadata:"))
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// command returns the executable and argument vector for a manager
+// invocation. pnpm and Yarn run through Corepack so the version pinned in
+// package.json is honored in native, nix, and container runners alike without
+// requiring a global install; Bun ships its own binary.
+func (m *nodePackageManager) command(args ...string) (string, []string) {
+	switch m.Kind {
+	case nodePackageManagerPNPM, nodePackageManagerYarn:
+		return "corepack", append([]string{string(m.Kind)}, args...)
+	case nodePackageManagerBun:
+		return "bun", args
+	default:
+		return "npm", args
+	}
+}
+
+// installArgs selects a frozen install whenever a lockfile is committed: a
+// runtime must never rewrite the dependency graph a teammate checked in.
+func (m *nodePackageManager) installArgs() []string {
+	if m.Lockfile == "" {
+		return []string{"install"}
+	}
+	switch m.Kind {
+	case nodePackageManagerYarn:
+		if m.Berry {
+			return []string{"install", "--immutable"}
+		}
+		return []string{"install", "--frozen-lockfile"}
+	case nodePackageManagerPNPM, nodePackageManagerBun:
+		return []string{"install", "--frozen-lockfile"}
+	default:
+		return []string{"ci"}
+	}
+}
+
+// runScriptArgs runs a package.json script with extra arguments forwarded to
+// it. Only npm needs the `--` separator; pnpm, Yarn, and Bun forward trailing
+// arguments to the script as-is.
+func (m *nodePackageManager) runScriptArgs(script string, extra ...string) []string {
+	args := []string{"run", script}
+	if len(extra) == 0 {
+		return args
+	}
+	if m.Kind == nodePackageManagerNPM {
+		args = append(args, "--")
+	}
+	return append(args, extra...)
+}
+
+// inDir runs a manager invocation against the project in dir instead of the
+// working directory.
+func (m *nodePackageManager) inDir(dir string, args ...string) []string {
+	switch m.Kind {
+	case nodePackageManagerPNPM:
+		return append([]string{"--dir", dir}, args...)
+	case nodePackageManagerYarn, nodePackageManagerBun:
+		return append([]string{"--cwd", dir}, args...)
+	default:
+		return append([]string{"--prefix", dir}, args...)
+	}
+}
+
+// execArgs runs a project-local binary without downloading anything.
+func (m *nodePackageManager) execArgs(binary string, args ...string) []string {
+	switch m.Kind {
+	case nodePackageManagerPNPM:
+		return append([]string{"exec", binary}, args...)
+	case nodePackageManagerYarn, nodePackageManagerBun:
+		return append([]string{"run", binary}, args...)
+	default:
+		return append([]string{"exec", "--offline", "--", binary}, args...)
+	}
+}
+
+// describe renders an invocation for logs and error messages.
+func (m *nodePackageManager) describe(args ...string) string {
+	return strings.TrimSpace(string(m.Kind) + " " + strings.Join(args, " "))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectNodePackageManagerFromLockfile(t *testing.T) {
+	tests := []struct {
+		lockfile string
+		kind     nodePackageManagerKind
+		install  []string
+	}{
+		{"package-lock.json", nodePackageManagerNPM, []string{"ci"}},
+		{"pnpm-lock.yaml", nodePackageManagerPNPM, []string{"install", "--frozen-lockfile"}},
+		{"bun.lockb", nodePackageManagerBun, []string{"install", "--frozen-lockfile"}},
+	}
+	for _, test := range tests {
+		t.Run(test.lockfile, func(t *testing.T) {
+			source := t.TempDir()
+			writeProductionTestFile(t, source, test.lockfile, "")
+
+			manager, err := detectNodePackageManager(source, "", &nodePackageManifest{})
+			require.NoError(t, err)
+			require.Equal(t, test.kind, manager.Kind)
+			require.Equal(t, test.lockfile, manager.Lockfile)
+			require.Equal(t, test.install, manager.installArgs())
+		})
+	}
+}
+
+func TestDetectNodePackageManagerDistinguishesYarnBerryFromClassic(t *testing.T) {
+	berry := t.TempDir()
+	writeProductionTestFile(t, berry, "yarn.lock", "__metadata:\n  version: 8\n")
+	manager, err := detectNodePackageManager(berry, "", &nodePackageManifest{})
+	require.NoError(t, err)
+	require.True(t, manager.Berry)
+	require.Equal(t, []string{"install", "--immutable"}, manager.installArgs())
+
+	classic := t.TempDir()
+	writeProductionTestFile(t, classic, "yarn.lock", "# yarn lockfile v1\n")
+	manager, err = detectNodePackageManager(classic, "", &nodePackageManifest{})
+	require.NoError(t, err)
+	require.False(t, manager.Berry)
+	require.Equal(t, []string{"install", "--frozen-lockfile"}, manager.installArgs())
+}
+
+func TestDetectNodePackageManagerPrefersSettingThenPackageManagerField(t *testing.T) {
+	source := t.TempDir()
+	writeProductionTestFile(t, source, "package-lock.json", "{}")
+	writeProductionTestFile(t, source, "pnpm-lock.yaml", "lockfileVersion: '9.0'\n")
+	manifest := &nodePackageManifest{PackageManager: "yarn@4.5.0+sha512.abc"}
+
+	fromField, err := detectNodePackageManager(source, "", manifest)
+	require.NoError(t, err)
+	require.Equal(t, nodePackageManagerYarn, fromField.Kind)
+	require.Equal(t, "4.5.0", fromField.Version)
+	require.True(t, fromField.Berry)
+	require.Empty(t, fromField.Lockfile, "a yarn project without yarn.lock installs unfrozen")
+	require.Equal(t, []string{"install"}, fromField.installArgs())
+
+	fromSetting, err := detectNodePackageManager(source, "pnpm", manifest)
+	require.NoError(t, err)
+	require.Equal(t, nodePackageManagerPNPM, fromSetting.Kind)
+	require.Equal(t, "pnpm-lock.yaml", fromSetting.Lockfile)
+
+	_, err = detectNodePackageManager(source, "deno", manifest)
+	require.ErrorContains(t, err, "unsupported package manager")
+}
+
+func TestDetectNodePackageManagerDefaultsToNPM(t *testing.T) {
+	manager, err := detectNodePackageManager(t.TempDir(), "", nil)
+	require.NoError(t, err)
+	require.Equal(t, nodePackageManagerNPM, manager.Kind)
+	require.Equal(t, []string{"install"}, manager.installArgs())
+}
+
+func TestNodePackageManagerCommandsRouteScriptsAndBinaries(t *testing.T) {
+	npm := &nodePackageManager{Kind: nodePackageManagerNPM}
+	command, args := npm.command(npm.runScriptArgs("test", "--reporter=json")...)
+	require.Equal(t, "npm", command)
+	require.Equal(t, []string{"run", "test", "--", "--reporter=json"}, args)
+	require.Equal(t, []string{"exec", "--offline", "--", "eslint", "--fix"}, npm.execArgs("eslint", "--fix"))
+
+	pnpm := &nodePackageManager{Kind: nodePackageManagerPNPM}
+	command, args = pnpm.command(pnpm.runScriptArgs("test", "--reporter=json")...)
+	require.Equal(t, "corepack", command)
+	require.Equal(t, []string{"pnpm", "run", "test", "--reporter=json"}, args)
+	require.Equal(t, []string{"exec", "playwright", "test"}, pnpm.execArgs("playwright", "test"))
+
+	yarn := &nodePackageManager{Kind: nodePackageManagerYarn, Berry: true}
+	command, args = yarn.command(yarn.runScriptArgs("lint")...)
+	require.Equal(t, "corepack", command)
+	require.Equal(t, []string{"yarn", "run", "lint"}, args)
+
+	bun := &nodePackageManager{Kind: nodePackageManagerBun}
+	command, args = bun.command(bun.runScriptArgs("build")...)
+	require.Equal(t, "bun", command)
+	require.Equal(t, []string{"run", "build"}, args)
+
+	require.Equal(t, []string{"--prefix", "stage", "run", "build"}, npm.inDir("stage", "run", "build"))
+	require.Equal(t, []string{"--dir", "stage", "run", "build"}, pnpm.inDir("stage", "run", "build"))
+	require.Equal(t, []string{"--cwd", "stage", "run", "build"}, yarn.inDir("stage", "run", "build"))
+	require.Equal(t, []string{"--cwd", "stage", "run", "build"}, bun.inDir("stage", "run", "build"))
+}
+
+func TestNodeDependencyCacheKeyTracksEveryPackageManagerLockfile(t *testing.T) {
+	source := t.TempDir()
+	writeProductionTestFile(t, source, "package.json", `{"name":"frontend"}`)
+	writeProductionTestFile(t, source, "pnpm-lock.yaml", "lockfileVersion: '9.0'\n")
+
+	first, err := nodeDependencyCacheKey(source, "linux-amd64")
+	require.NoError(t, err)
+
+	writeProductionTestFile(t, source, "pnpm-lock.yaml", "lockfileVersion: '9.0'\nchanged: true\n")
+	afterLockEdit, err := nodeDependencyCacheKey(source, "linux-amd64")
+	require.NoError(t, err)
+	require.NotEqual(t, first, afterLockEdit)
+
+	writeProductionTestFile(t, source, "pnpm-workspace.yaml", "packages:\n  - packages/*\n")
+	afterWorkspaceEdit, err := nodeDependencyCacheKey(source, "linux-amd64")
+	require.NoError(t, err)
+	require.NotEqual(t, afterLockEdit, afterWorkspaceEdit)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// PerfSettings configures the `perf` command: which routes it audits by
+// default and the thresholds that fail the audit.
+//
+//	perf:
+//	  routes: [/, /dashboard]
+//	  thresholds:
+//	    lcp-ms: 2500
+//	    cls: 0.1
+//	    tbt-ms: 200
+type PerfSettings struct {
+	// Routes are audited when the command names none. Default: /.
+	Routes     []string       `yaml:"routes,omitempty"`
+	Thresholds PerfThresholds `yaml:"thresholds,omitempty"`
+}
+
+// PerfThresholds are upper bounds per route; a zero value is not checked.
+type PerfThresholds struct {
+	TTFBMs     float64 `yaml:"ttfb-ms,omitempty"`
+	LCPMs      float64 `yaml:"lcp-ms,omitempty"`
+	CLS        float64 `yaml:"cls,omitempty"`
+	TBTMs      float64 `yaml:"tbt-ms,omitempty"`
+	INPMs      float64 `yaml:"inp-ms,omitempty"`
+	TransferKB float64 `yaml:"transfer-kb,omitempty"`
+	Requests   int     `yaml:"requests,omitempty"`
+}
+
+// perfResultMarker prefixes the JSON line the audit script prints.
+const perfResultMarker = "CODEFLY_PERF "
+
+// perfRouteReport is the lab measurement of one cold page load. Metrics the
+// browser did not report (no LCP candidate, no interaction for INP) are nil.
+type perfRouteReport struct {
+	Route         string   `json:"route"`
+	Status        int      `json:"status,omitempty"`
+	TTFBMs        *float64 `json:"ttfb_ms,omitempty"`
+	FCPMs         *float64 `json:"fcp_ms,omitempty"`
+	LCPMs         *float64 `json:"lcp_ms,omitempty"`
+	CLS           *float64 `json:"cls,omitempty"`
+	TBTMs         *float64 `json:"tbt_ms,omitempty"`
+	INPMs         *float64 `json:"inp_ms,omitempty"`
+	TransferBytes int64    `json:"transfer_bytes"`
+	Requests      int      `json:"requests"`
+	Error         string   `json:"error,omitempty"`
+}
+
+type perfViolation struct {
+	Route     string  `json:"route"`
+	Metric    string  `json:"metric"`
+	Threshold float64 `json:"threshold"`
+	Actual    float64 `json:"actual"`
+}
+
+type perfReport struct {
+	// Passed is false when a route failed to load or exceeded a threshold.
+	Passed     bool              `json:"passed"`
+	Routes     []perfRouteReport `json:"routes"`
+	Violations []perfViolation   `json:"violations,omitempty"`
+}
+
+// perfRoutes returns the routes to audit: the command's, else the settings',
+// else the root page.
+func (p PerfSettings) perfRoutes(requested []string) ([]string, error) {
+	routes := requested
+	if len(routes) == 0 {
+		routes = p.Routes
+	}
+	if len(routes) == 0 {
+		return []string{"/"}, nil
+	}
+	for _, route := range routes {
+		if !strings.HasPrefix(route, "/") {
+			return nil, fmt.Errorf("perf route %q must be a path starting with /", route)
+		}
+	}
+	return routes, nil
+}
+
+// newPerfReport applies the thresholds to the measured routes.
+func newPerfReport(routes []perfRouteReport, thresholds PerfThresholds) perfReport {
+	report := perfReport{Passed: true, Routes: routes}
+	for _, route := range routes {
+		if route.failed() {
+			report.Passed = false
+			continue
+		}
+		check := func(metric string, threshold float64, actual *float64) {
+			if threshold > 0 && actual != nil && *actual > threshold {
+				report.Violations = append(report.Violations, perfViolation{
+					Route: route.Route, Metric: metric, Threshold: threshold, Actual: *actual,
+				})
+			}
+		}
+		transferKB := float64(route.TransferBytes) / 1000
+		requests := float64(route.Requests)
+		check("ttfb-ms", thresholds.TTFBMs, route.TTFBMs)
+		check("lcp-ms", thresholds.LCPMs, route.LCPMs)
+		check("cls", thresholds.CLS, route.CLS)
+		check("tbt-ms", thresholds.TBTMs, route.TBTMs)
+		check("inp-ms", thresholds.INPMs, route.INPMs)
+		check("transfer-kb", thresholds.TransferKB, &transferKB)
+		check("requests", float64(thresholds.Requests), &requests)
+	}
+	if len(report.Violations) > 0 {
+		report.Passed = false
+	}
+	return report
+}
+
+func (r perfReport) loadFailures() int {
+	failures := 0
+	for _, route := range r.Routes {
+		if route.failed() {
+			failures++
+		}
+	}
+	return failures
+}
+
+// failed reports a route that did not load: a navigation error or an HTTP
+// error status, whose metrics would measure an error page.
+func (r perfRouteReport) failed() bool {
+	return r.Error != "" || r.Status >= 400
+}
+
+// parsePerfOutput extracts the audit result from the script's output.
+func parsePerfOutput(output string) ([]perfRouteReport, error) {
+	var routes []perfRouteReport
+	if err := parseBrowserResult(output, perfResultMarker, &routes); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+func (r perfReport) JSON() (string, error) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("encode performance report: %w", err)
+	}
+	return string(data), nil
+}
+
+func (r perfReport) text() string {
+	var out strings.Builder
+	table := tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "Route\tStatus\tTTFB\tFCP\tLCP\tCLS\tTBT\tINP\tTransfer\tRequests")
+	for _, route := range r.Routes {
+		if route.Error != "" {
+			fmt.Fprintf(table, "%s\tERROR: %s\n", route.Route, route.Error)
+			continue
+		}
+		fmt.Fprintf(table, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\n", route.Route, route.Status,
+			formatPerfMs(route.TTFBMs), formatPerfMs(route.FCPMs), formatPerfMs(route.LCPMs),
+			formatPerfScore(route.CLS), formatPerfMs(route.TBTMs), formatPerfMs(route.INPMs),
+			formatKilobytes(route.TransferBytes), route.Requests)
+	}
+	_ = table.Flush()
+	for _, violation := range r.Violations {
+		fmt.Fprintf(&out, "OVER THRESHOLD: %s %s %g > %g\n", violation.Route, violation.Metric, violation.Actual, violation.Threshold)
+	}
+	return strings.TrimRight(out.String(), "\n")
+}
+
+func formatPerfMs(value *float64) string {
+	if value == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.0fms", *value)
+}
+
+func formatPerfScore(value *float64) string {
+	if value == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.3f", *value)
+}
+
+// perfAuditScript loads each route in a fresh headless Chromium context, so
+// every load is cold, and reads the Web Vitals the page itself observed. It
+// takes its request from CODEFLY_PERF_REQUEST and requires the project's own
+// Playwright. TBT sums the blocking part (beyond 50ms) of long tasks during
+// the load; INP needs a real interaction and is usually absent in a lab run.
+const perfAuditScript = `const { chromium } = require('playwright');
+const request = JSON.parse(process.env.CODEFLY_PERF_REQUEST);
+const observe = () => {
+  const perf = (window.__codeflyPerf = { fcp: null, lcp: null, cls: 0, tbt: 0, inp: null });
+  const watch = (type, callback, options) => {
+    try {
+      new PerformanceObserver((list) => list.getEntries().forEach(callback)).observe({ type, buffered: true, ...options });
+    } catch (_) {}
+  };
+  watch('paint', (entry) => { if (entry.name === 'first-contentful-paint') perf.fcp = entry.startTime; });
+  watch('largest-contentful-paint', (entry) => { perf.lcp = entry.renderTime || entry.startTime; });
+  watch('layout-shift', (entry) => { if (!entry.hadRecentInput) perf.cls += entry.value; });
+  watch('longtask', (entry) => { perf.tbt += Math.max(0, entry.duration - 50); });
+  watch('event', (entry) => { if (entry.interactionId) perf.inp = Math.max(perf.inp || 0, entry.duration); }, { durationThreshold: 16 });
+};
+const measure = () => {
+  const perf = window.__codeflyPerf;
+  const navigation = performance.getEntriesByType('navigation')[0];
+  const resources = performance.getEntriesByType('resource');
+  return {
+    ttfb_ms: navigation ? navigation.responseStart : null,
+    fcp_ms: perf.fcp,
+    lcp_ms: perf.lcp,
+    cls: perf.cls,
+    tbt_ms: perf.tbt,
+    inp_ms: perf.inp,
+    transfer_bytes: (navigation ? navigation.transferSize : 0) + resources.reduce((sum, entry) => sum + (entry.transferSize || 0), 0),
+    requests: 1 + resources.length,
+  };
+};
+(async () => {
+  const browser = await chromium.launch();
+  const results = [];
+  try {
+    for (const route of request.routes) {
+      const context = await browser.newContext();
+      const page = await context.newPage();
+      await page.addInitScript(observe);
+      const result = { route };
+      try {
+        const response = await page.goto(new URL(route, request.baseURL).href, { waitUntil: 'load', timeout: request.timeoutMs });
+        result.status = response ? response.status() : 0;
+        await page.waitForLoadState('networkidle', { timeout: request.timeoutMs }).catch(() => {});
+        Object.assign(result, await page.evaluate(measure));
+      } catch (error) {
+        result.error = String(error && error.message ? error.message : error).split('\n')[0];
+      }
+      results.push(result);
+      await context.close();
+    }
+  } finally {
+    await browser.close();
+  }
+  console.log('` + perfResultMarker + `' + JSON.stringify(results));
+})().catch((error) => {
+  console.error(error);
+  process.exit(1);
+});
+`
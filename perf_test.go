@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerfRoutesPreferTheCommandThenSettings(t *testing.T) {
+	settings := PerfSettings{Routes: []string{"/", "/dashboard"}}
+	routes, err := settings.perfRoutes([]string{"/pricing"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"/pricing"}, routes)
+
+	routes, err = settings.perfRoutes(nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/", "/dashboard"}, routes)
+
+	routes, err = PerfSettings{}.perfRoutes(nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/"}, routes)
+
+	_, err = settings.perfRoutes([]string{"https://example.com"})
+	require.ErrorContains(t, err, "must be a path")
+}
+
+func TestPerfReportAppliesThresholdsToMeasuredRoutes(t *testing.T) {
+	// The script prints its result as one line among other output.
+	result := strings.ReplaceAll(`[
+		{"route": "/", "status": 200, "ttfb_ms": 42.4, "fcp_ms": 310, "lcp_ms": 3120.7, "cls": 0.02, "tbt_ms": 80, "transfer_bytes": 412000, "requests": 31},
+		{"route": "/slow", "status": 200, "ttfb_ms": 900, "lcp_ms": null, "cls": 0.25, "tbt_ms": 0, "transfer_bytes": 1000, "requests": 3},
+		{"route": "/missing", "status": 404, "transfer_bytes": 900, "requests": 1},
+		{"route": "/down", "error": "page.goto: net::ERR_CONNECTION_REFUSED"}
+	]`, "\n", "")
+	output := "Next.js noise\n" + perfResultMarker + result + "\n"
+	routes, err := parsePerfOutput(output)
+	require.NoError(t, err)
+	require.Len(t, routes, 4)
+	require.Nil(t, routes[1].LCPMs, "an unreported metric stays unmeasured rather than zero")
+
+	report := newPerfReport(routes, PerfThresholds{LCPMs: 2500, CLS: 0.1, TTFBMs: 800, TransferKB: 400, Requests: 40})
+	require.False(t, report.Passed)
+	require.Equal(t, []perfViolation{
+		{Route: "/", Metric: "lcp-ms", Threshold: 2500, Actual: 3120.7},
+		{Route: "/", Metric: "transfer-kb", Threshold: 400, Actual: 412},
+		{Route: "/slow", Metric: "ttfb-ms", Threshold: 800, Actual: 900},
+		{Route: "/slow", Metric: "cls", Threshold: 0.1, Actual: 0.25},
+	}, report.Violations)
+	require.Equal(t, 2, report.loadFailures())
+
+	text := report.text()
+	require.Regexp(t, `/\s+200\s+42ms\s+310ms\s+3121ms\s+0\.020\s+80ms\s+-\s+412\.0 kB\s+31`, text)
+	require.Contains(t, text, "/down     ERROR: page.goto: net::ERR_CONNECTION_REFUSED")
+	require.Contains(t, text, "OVER THRESHOLD: /slow cls 0.25 > 0.1")
+
+	passing := newPerfReport(routes[:1], PerfThresholds{})
+	require.True(t, passing.Passed, "no thresholds, no failures")
+}
+
+func TestParsePerfOutputRequiresAResult(t *testing.T) {
+	_, err := parsePerfOutput("Error: browserType.launch: Executable doesn't exist\n")
+	require.ErrorContains(t, err, "browser audit printed no result")
+}
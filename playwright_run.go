@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	runtimev0 "github.com/codefly-dev/core/generated/go/codefly/services/runtime/v0"
+)
+
+// playwrightRun is the structured result of the `playwright` command. Counts,
+// duration, failures and the verdict come from the run core parses out of
+// Playwright's JSON reporter, as for the e2e suite of Runtime.Test. The tests
+// are read here only for what core does not carry: their retries and the
+// artifacts they attached (traces, videos, screenshots), which are copied out
+// of Playwright's output directory, which the next run wipes, into
+// .codefly/playwright-artifacts/<run-id>.
+type playwrightRun struct {
+	RunID        string             `json:"run_id"`
+	Passed       bool               `json:"passed"`
+	Summary      string             `json:"summary,omitempty"`
+	Stats        playwrightRunStats `json:"stats"`
+	Failures     []string           `json:"failures,omitempty"`
+	Tests        []playwrightTest   `json:"tests"`
+	ArtifactsDir string             `json:"artifacts_dir,omitempty"`
+}
+
+type playwrightRunStats struct {
+	Total      int   `json:"total"`
+	Passed     int   `json:"passed"`
+	Failed     int   `json:"failed"`
+	Flaky      int   `json:"flaky"`
+	Skipped    int   `json:"skipped"`
+	DurationMs int64 `json:"duration_ms"`
+}
+
+// playwrightTest is one test in one project. Status is passed, failed, flaky
+// (failed, then passed on a retry) or skipped.
+type playwrightTest struct {
+	Title     string               `json:"title"`
+	File      string               `json:"file,omitempty"`
+	Project   string               `json:"project,omitempty"`
+	Status    string               `json:"status"`
+	Retries   int                  `json:"retries"`
+	Artifacts []playwrightArtifact `json:"artifacts,omitempty"`
+}
+
+// playwrightArtifact is a file attachment. Path is where Playwright wrote it
+// until collectArtifacts moves it under the run's artifact directory.
+type playwrightArtifact struct {
+	Name        string `json:"name"`
+	Kind        string `json:"kind"`
+	ContentType string `json:"content_type,omitempty"`
+	Path        string `json:"path"`
+}
+
+// playwrightJSONSuite is the subset of Playwright's JSON reporter output
+// readPlaywrightTests needs.
+type playwrightJSONSuite struct {
+	Title string `json:"title"`
+	File  string `json:"file"`
+	Specs []struct {
+		Title string `json:"title"`
+		File  string `json:"file"`
+		Tests []struct {
+			ProjectName string `json:"projectName"`
+			Status      string `json:"status"`
+			Results     []struct {
+				Retry       int `json:"retry"`
+				Attachments []struct {
+					Name        string `json:"name"`
+					ContentType string `json:"contentType"`
+					Path        string `json:"path"`
+				} `json:"attachments"`
+			} `json:"results"`
+		} `json:"tests"`
+	} `json:"specs"`
+	Suites []playwrightJSONSuite `json:"suites"`
+}
+
+// newPlaywrightRunID names a run's artifact directory; IDs sort by start time.
+func newPlaywrightRunID(started time.Time) string {
+	return started.UTC().Format("20060102-150405.000")
+}
+
+// newPlaywrightRun builds the command result from the response of the run
+// core parsed and the tests read from the same report.
+func newPlaywrightRun(runID string, response *runtimev0.TestResponse, tests []playwrightTest) playwrightRun {
+	counts := response.GetCounts()
+	run := playwrightRun{
+		RunID:  runID,
+		Passed: response.GetResult().GetState() == runtimev0.TestRunResult_PASSED,
+		Stats: playwrightRunStats{
+			Total:      int(counts.GetTotal()),
+			Passed:     int(counts.GetPassed()),
+			Failed:     int(counts.GetFailed()),
+			Skipped:    int(counts.GetSkipped()),
+			DurationMs: response.GetRun().GetDuration().AsDuration().Milliseconds(),
+		},
+		Failures: response.GetFailures(),
+		Tests:    append([]playwrightTest{}, tests...),
+	}
+	for _, test := range tests {
+		if test.Status == "flaky" {
+			run.Stats.Flaky++
+		}
+	}
+	return run
+}
+
+// readPlaywrightTests reads the tests of a JSON reporter file with their
+// retries and attachments. Relative attachment paths are resolved against the
+// source directory.
+func readPlaywrightTests(sourceDir string, data []byte) ([]playwrightTest, error) {
+	var report struct {
+		Suites []playwrightJSONSuite `json:"suites"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("parse Playwright JSON report: %w", err)
+	}
+	var tests []playwrightTest
+	for _, suite := range report.Suites {
+		tests = appendPlaywrightSuite(tests, suite, nil, sourceDir)
+	}
+	return tests, nil
+}
+
+func appendPlaywrightSuite(tests []playwrightTest, suite playwrightJSONSuite, titles []string, sourceDir string) []playwrightTest {
+	// Top-level suites are files; their title is the path, not a describe.
+	if suite.File == "" || suite.Title != suite.File {
+		titles = append(titles, suite.Title)
+	}
+	for _, spec := range suite.Specs {
+		for _, test := range spec.Tests {
+			result := playwrightTest{
+				Title:   strings.Join(append(append([]string(nil), titles...), spec.Title), " › "),
+				File:    spec.File,
+				Project: test.ProjectName,
+				Status:  playwrightTestStatus(test.Status),
+			}
+			for _, attempt := range test.Results {
+				result.Retries = max(result.Retries, attempt.Retry)
+				for _, attachment := range attempt.Attachments {
+					if attachment.Path == "" {
+						continue
+					}
+					path := attachment.Path
+					if !filepath.IsAbs(path) {
+						path = filepath.Join(sourceDir, path)
+					}
+					result.Artifacts = append(result.Artifacts, playwrightArtifact{
+						Name:        attachment.Name,
+						Kind:        playwrightArtifactKind(attachment.Name, attachment.ContentType),
+						ContentType: attachment.ContentType,
+						Path:        path,
+					})
+				}
+			}
+			tests = append(tests, result)
+		}
+	}
+	for _, child := range suite.Suites {
+		tests = appendPlaywrightSuite(tests, child, titles, sourceDir)
+	}
+	return tests
+}
+
+// playwrightTestStatus maps Playwright's outcome against the expected status.
+func playwrightTestStatus(outcome string) string {
+	switch outcome {
+	case "expected":
+		return "passed"
+	case "unexpected":
+		return "failed"
+	default:
+		return outcome
+	}
+}
+
+func playwrightArtifactKind(name, contentType string) string {
+	switch {
+	case name == "trace" || contentType == "application/zip":
+		return "trace"
+	case strings.HasPrefix(contentType, "video/"):
+		return "video"
+	case strings.HasPrefix(contentType, "image/"):
+		return "screenshot"
+	default:
+		return "attachment"
+	}
+}
+
+// collectArtifacts copies every attachment into dir, keeping the per-test
+// directory name Playwright chose, and points the run at the copies. A missing
+// file is reported rather than failing the run.
+func (r *playwrightRun) collectArtifacts(dir string) error {
+	var missing []string
+	taken := map[string]bool{}
+	for i := range r.Tests {
+		for j := range r.Tests[i].Artifacts {
+			artifact := &r.Tests[i].Artifacts[j]
+			destination := filepath.Join(dir, filepath.Base(filepath.Dir(artifact.Path)), filepath.Base(artifact.Path))
+			extension := filepath.Ext(destination)
+			for n := 2; taken[destination]; n++ {
+				destination = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(destination, extension), n, extension)
+			}
+			if err := copyFile(artifact.Path, destination); err != nil {
+				missing = append(missing, artifact.Path)
+				continue
+			}
+			taken[destination] = true
+			artifact.Path = destination
+		}
+	}
+	if len(taken) > 0 {
+		r.ArtifactsDir = dir
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("cannot collect Playwright artifacts: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (r playwrightRun) JSON() (string, error) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	runtimev0 "github.com/codefly-dev/core/generated/go/codefly/services/runtime/v0"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const playwrightReportFixture = `{
+  "suites": [{
+    "title": "checkout.spec.ts",
+    "file": "checkout.spec.ts",
+    "specs": [{
+      "title": "shows the cart",
+      "file": "checkout.spec.ts",
+      "line": 4,
+      "tests": [{
+        "projectName": "chromium",
+        "status": "expected",
+        "results": [{"retry": 0, "status": "passed", "duration": 812.4, "attachments": []}]
+      }]
+    }],
+    "suites": [{
+      "title": "payment",
+      "file": "checkout.spec.ts",
+      "specs": [{
+        "title": "pays by card",
+        "file": "checkout.spec.ts",
+        "line": 12,
+        "tests": [{
+          "projectName": "webkit",
+          "status": "unexpected",
+          "results": [
+            {"retry": 0, "status": "failed", "duration": 1500, "error": {"message": "first"}, "attachments": [
+              {"name": "trace", "contentType": "application/zip", "path": "test-results/payment-webkit/trace.zip"}
+            ]},
+            {"retry": 1, "status": "timedOut", "duration": 30000, "errors": [{"message": "Test timeout of 30000ms exceeded."}], "attachments": [
+              {"name": "screenshot", "contentType": "image/png", "path": "test-results/payment-webkit-retry1/test-failed-1.png"},
+              {"name": "video", "contentType": "video/webm", "path": "test-results/payment-webkit-retry1/video.webm"},
+              {"name": "stdout", "contentType": "text/plain", "body": "aGk="}
+            ]}
+          ]
+        }, {
+          "projectName": "chromium",
+          "status": "flaky",
+          "results": [
+            {"retry": 0, "status": "failed", "duration": 900, "error": {"message": "flake"}},
+            {"retry": 1, "status": "passed", "duration": 700}
+          ]
+        }, {
+          "projectName": "firefox",
+          "status": "skipped",
+          "results": []
+        }]
+      }]
+    }]
+  }],
+  "errors": [],
+  "stats": {"duration": 33012.7, "expected": 1, "unexpected": 1, "flaky": 1, "skipped": 1}
+}`
+
+func TestReadPlaywrightTestsKeepsRetriesAndArtifacts(t *testing.T) {
+	tests, err := readPlaywrightTests("/src", []byte(playwrightReportFixture))
+	require.NoError(t, err)
+	require.Len(t, tests, 4)
+
+	require.Equal(t, playwrightTest{
+		Title: "shows the cart", File: "checkout.spec.ts", Project: "chromium", Status: "passed",
+	}, tests[0])
+
+	failed := tests[1]
+	require.Equal(t, "payment › pays by card", failed.Title)
+	require.Equal(t, "failed", failed.Status)
+	require.Equal(t, 1, failed.Retries)
+	require.Equal(t, []playwrightArtifact{
+		{Name: "trace", Kind: "trace", ContentType: "application/zip", Path: "/src/test-results/payment-webkit/trace.zip"},
+		{Name: "screenshot", Kind: "screenshot", ContentType: "image/png", Path: "/src/test-results/payment-webkit-retry1/test-failed-1.png"},
+		{Name: "video", Kind: "video", ContentType: "video/webm", Path: "/src/test-results/payment-webkit-retry1/video.webm"},
+	}, failed.Artifacts)
+
+	require.Equal(t, "flaky", tests[2].Status)
+	require.Equal(t, 1, tests[2].Retries)
+	require.Equal(t, "skipped", tests[3].Status)
+
+	_, err = readPlaywrightTests("/src", []byte("Error: no tests found"))
+	require.ErrorContains(t, err, "parse Playwright JSON report")
+}
+
+func TestNewPlaywrightRunTakesTheVerdictFromTheParsedRun(t *testing.T) {
+	tests, err := readPlaywrightTests("/src", []byte(playwrightReportFixture))
+	require.NoError(t, err)
+	response := &runtimev0.TestResponse{
+		Result:   &runtimev0.TestRunResult{State: runtimev0.TestRunResult_FAILED},
+		Run:      &runtimev0.TestRun{Duration: durationpb.New(33012 * time.Millisecond)},
+		Counts:   &runtimev0.TestCounts{Total: 4, Passed: 2, Failed: 1, Skipped: 1},
+		Failures: []string{"payment › pays by card: Test timeout of 30000ms exceeded."},
+	}
+	run := newPlaywrightRun("run-1", response, tests)
+	require.False(t, run.Passed)
+	require.Equal(t, playwrightRunStats{Total: 4, Passed: 2, Failed: 1, Flaky: 1, Skipped: 1, DurationMs: 33012}, run.Stats)
+	require.Equal(t, response.Failures, run.Failures)
+	require.Equal(t, tests, run.Tests)
+
+	empty := newPlaywrightRun("run-2", &runtimev0.TestResponse{
+		Result: &runtimev0.TestRunResult{State: runtimev0.TestRunResult_PASSED},
+	}, nil)
+	require.True(t, empty.Passed)
+	require.NotNil(t, empty.Tests, "an empty run still encodes tests as a list")
+}
+
+func TestCollectPlaywrightArtifactsCopiesOutOfTheOutputDirectory(t *testing.T) {
+	source := t.TempDir()
+	for _, file := range []string{"payment-webkit/trace.zip", "payment-webkit-retry1/test-failed-1.png", "payment-webkit-retry1/video.webm"} {
+		path := filepath.Join(source, "test-results", file)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(file), 0o644))
+	}
+	tests, err := readPlaywrightTests(source, []byte(playwrightReportFixture))
+	require.NoError(t, err)
+	run := newPlaywrightRun("run-1", &runtimev0.TestResponse{}, tests)
+
+	dir := filepath.Join(source, ".codefly", "playwright-artifacts", "run-1")
+	require.NoError(t, run.collectArtifacts(dir))
+	require.Equal(t, dir, run.ArtifactsDir)
+	var paths []string
+	for _, artifact := range run.Tests[1].Artifacts {
+		paths = append(paths, artifact.Path)
+		data, err := os.ReadFile(artifact.Path)
+		require.NoError(t, err)
+		require.True(t, strings.HasSuffix(artifact.Path, string(data)))
+	}
+	require.Equal(t, []string{
+		filepath.Join(dir, "payment-webkit", "trace.zip"),
+		filepath.Join(dir, "payment-webkit-retry1", "test-failed-1.png"),
+		filepath.Join(dir, "payment-webkit-retry1", "video.webm"),
+	}, paths)
+
+	require.NoError(t, os.Remove(filepath.Join(source, "test-results", "payment-webkit", "trace.zip")))
+	tests, err = readPlaywrightTests(source, []byte(playwrightReportFixture))
+	require.NoError(t, err)
+	again := newPlaywrightRun("run-2", &runtimev0.TestResponse{}, tests)
+	err = again.collectArtifacts(filepath.Join(source, ".codefly", "playwright-artifacts", "run-2"))
+	require.ErrorContains(t, err, "trace.zip")
+	require.Equal(t, filepath.Join(source, "test-results", "payment-webkit", "trace.zip"), again.Tests[1].Artifacts[0].Path)
+
+	encoded, err := again.JSON()
+	require.NoError(t, err)
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal([]byte(encoded), &decoded))
+	require.Equal(t, "run-2", decoded["run_id"])
+}
+
+func TestPlaywrightRunIDsSortByStartTime(t *testing.T) {
+	first := newPlaywrightRunID(time.Date(2026, 3, 9, 14, 5, 1, 20_000_000, time.UTC))
+	second := newPlaywrightRunID(time.Date(2026, 3, 9, 14, 5, 1, 300_000_000, time.UTC))
+	require.Equal(t, "20260309-140501.020", first)
+	require.Less(t, first, second)
+}
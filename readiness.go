@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// defaultReadinessPath is the scaffolded App Router health route
+// (src/app/api/healthz/route.ts). The server-rendered root page is not a
+// readiness signal: it can fail on an upstream while the server is healthy,
+// and a broken page still answers with an HTTP response.
+const defaultReadinessPath = "/api/healthz"
+
+const maximumReadinessSuccesses = 10
+
+// maximumReadinessBody bounds how much of a health response is read for the
+// JSON body assertion.
+const maximumReadinessBody = 64 << 10
+
+// ReadinessSettings is the service readiness contract. `codefly run` waits on
+// it and the generated Kubernetes startup/readiness probes execute the same
+// contract inside the image, so local and cluster readiness agree.
+//
+//	readiness:
+//	  path: /api/healthz
+//	  status-codes: [200]
+//	  body: {status: ok}
+//	  successes: 2
+type ReadinessSettings struct {
+	// Path is probed on the service's HTTP endpoint. Default: /api/healthz.
+	Path string `yaml:"path,omitempty"`
+	// StatusCodes lists the accepted HTTP statuses. Default: any 2xx.
+	StatusCodes []int `yaml:"status-codes,omitempty"`
+	// Body optionally asserts a JSON subset of the response body: every key
+	// listed here must be present with an equal value.
+	Body map[string]any `yaml:"body,omitempty"`
+	// Successes is the number of consecutive passing probes required before
+	// the service is ready. Default: 1.
+	Successes int `yaml:"successes,omitempty"`
+}
+
+// readinessContract is the validated form of ReadinessSettings. It is also
+// the JSON document baked into the production image for the Kubernetes
+// probes, so its field names are part of that script's contract.
+type readinessContract struct {
+	Path        string         `json:"path"`
+	StatusCodes []int          `json:"statusCodes,omitempty"`
+	Body        map[string]any `json:"body,omitempty"`
+	Successes   int            `json:"successes"`
+}
+
+// ReadinessContract validates the readiness settings and applies defaults.
+func (s *Settings) ReadinessContract() (readinessContract, error) {
+	contract := readinessContract{
+		Path:        strings.TrimSpace(s.Readiness.Path),
+		StatusCodes: s.Readiness.StatusCodes,
+		Successes:   s.Readiness.Successes,
+	}
+	if contract.Path == "" {
+		contract.Path = defaultReadinessPath
+	}
+	if !strings.HasPrefix(contract.Path, "/") || strings.ContainsAny(contract.Path, " \t\n#") {
+		return readinessContract{}, fmt.Errorf("invalid readiness path %q: expected an absolute URL path such as %s", contract.Path, defaultReadinessPath)
+	}
+	for _, code := range contract.StatusCodes {
+		if code < 100 || code > 599 {
+			return readinessContract{}, fmt.Errorf("invalid readiness status code %d", code)
+		}
+	}
+	if contract.Successes == 0 {
+		contract.Successes = 1
+	}
+	if contract.Successes < 1 || contract.Successes > maximumReadinessSuccesses {
+		return readinessContract{}, fmt.Errorf(
+			"invalid readiness successes %d: expected a value between 1 and %d",
+			contract.Successes,
+			maximumReadinessSuccesses,
+		)
+	}
+	if len(s.Readiness.Body) > 0 {
+		// YAML decodes integers as int and nested maps with any keys; a JSON
+		// round trip normalizes the assertion to what a decoded body looks like.
+		normalized, err := normalizeReadinessJSON(s.Readiness.Body)
+		if err != nil {
+			return readinessContract{}, fmt.Errorf("invalid readiness body assertion: %w", err)
+		}
+		contract.Body = normalized.(map[string]any)
+	}
+	return contract, nil
+}
+
+// url resolves the probe URL against the endpoint address.
+func (c readinessContract) url(address string) (string, error) {
+	base, err := url.Parse(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid readiness address %q: %w", address, err)
+	}
+	probe, err := url.Parse(c.Path)
+	if err != nil {
+		return "", fmt.Errorf("invalid readiness path %q: %w", c.Path, err)
+	}
+	return base.ResolveReference(probe).String(), nil
+}
+
+// check validates one probe response against the contract.
+func (c readinessContract) check(response *http.Response) error {
+	if response.StatusCode == http.StatusNotFound && !c.accepts(response.StatusCode) {
+		return fmt.Errorf(
+			"%s returned HTTP 404: add a GET route handler at src/app%s/route.ts or set readiness.path",
+			c.Path,
+			c.Path,
+		)
+	}
+	if !c.accepts(response.StatusCode) {
+		return fmt.Errorf("%s returned HTTP %d", c.Path, response.StatusCode)
+	}
+	if len(c.Body) == 0 {
+		return nil
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, maximumReadinessBody))
+	if err != nil {
+		return fmt.Errorf("read %s body: %w", c.Path, err)
+	}
+	var body any
+	if err := json.Unmarshal(data, &body); err != nil {
+		return fmt.Errorf("%s did not return JSON: %w", c.Path, err)
+	}
+	if !jsonSubset(c.Body, body) {
+		expected, _ := json.Marshal(c.Body)
+		return fmt.Errorf("%s body %s does not match %s", c.Path, bytes.TrimSpace(data), expected)
+	}
+	return nil
+}
+
+func (c readinessContract) accepts(status int) bool {
+	if len(c.StatusCodes) == 0 {
+		return status >= 200 && status < 300
+	}
+	for _, code := range c.StatusCodes {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+// script renders the contract as the JSON literal embedded in the image's
+// probe script.
+func (c readinessContract) script() (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("encode readiness contract: %w", err)
+	}
+	return string(data), nil
+}
+
+func normalizeReadinessJSON(value any) (any, error) {
+	data, err := json.Marshal(stringKeys(value))
+	if err != nil {
+		return nil, err
+	}
+	var normalized any
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+func stringKeys(value any) any {
+	switch typed := value.(type) {
+	case map[string]any:
+		converted := make(map[string]any, len(typed))
+		for key, item := range typed {
+			converted[key] = stringKeys(item)
+		}
+		return converted
+	case map[any]any:
+		converted := make(map[string]any, len(typed))
+		for key, item := range typed {
+			converted[fmt.Sprint(key)] = stringKeys(item)
+		}
+		return converted
+	case []any:
+		converted := make([]any, len(typed))
+		for i, item := range typed {
+			converted[i] = stringKeys(item)
+		}
+		return converted
+	default:
+		return value
+	}
+}
+
+// jsonSubset reports whether every object key in expected is present in
+// actual with a matching value. Arrays and scalars compare exactly.
+func jsonSubset(expected, actual any) bool {
+	expectedObject, ok := expected.(map[string]any)
+	if !ok {
+		return reflect.DeepEqual(expected, actual)
+	}
+	actualObject, ok := actual.(map[string]any)
+	if !ok {
+		return false
+	}
+	for key, value := range expectedObject {
+		item, present := actualObject[key]
+		if !present || !jsonSubset(value, item) {
+			return false
+		}
+	}
+	return true
+}
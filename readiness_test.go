@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestReadinessContractDefaultsToTheScaffoldedHealthRoute(t *testing.T) {
+	contract, err := (&Settings{}).ReadinessContract()
+	require.NoError(t, err)
+	require.Equal(t, readinessContract{Path: "/api/healthz", Successes: 1}, contract)
+	require.True(t, contract.accepts(204))
+	require.False(t, contract.accepts(301))
+
+	probe, err := contract.url("http://localhost:3000/")
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:3000/api/healthz", probe)
+}
+
+func TestReadinessContractRejectsInvalidSettings(t *testing.T) {
+	for name, readiness := range map[string]ReadinessSettings{
+		"relative path":   {Path: "api/healthz"},
+		"fragment":        {Path: "/api/healthz#ok"},
+		"status code":     {StatusCodes: []int{42}},
+		"successes":       {Successes: maximumReadinessSuccesses + 1},
+		"negative streak": {Successes: -1},
+	} {
+		_, err := (&Settings{Readiness: readiness}).ReadinessContract()
+		require.Error(t, err, name)
+	}
+}
+
+func TestReadinessContractNormalizesTheYAMLBodyAssertion(t *testing.T) {
+	var settings Settings
+	require.NoError(t, yaml.Unmarshal([]byte(`
+readiness:
+  path: /api/status
+  status-codes: [200, 299]
+  body:
+    status: ok
+    checks:
+      db: 1
+  successes: 2
+`), &settings))
+	contract, err := settings.ReadinessContract()
+	require.NoError(t, err)
+
+	var healthy, degraded any
+	require.NoError(t, json.Unmarshal([]byte(`{"status":"ok","version":"1.2.0","checks":{"db":1,"cache":0}}`), &healthy))
+	require.NoError(t, json.Unmarshal([]byte(`{"status":"ok","checks":{"db":0}}`), &degraded))
+	require.True(t, jsonSubset(contract.Body, healthy))
+	require.False(t, jsonSubset(contract.Body, degraded))
+
+	script, err := contract.script()
+	require.NoError(t, err)
+	require.JSONEq(t, `{"path":"/api/status","statusCodes":[200,299],"body":{"status":"ok","checks":{"db":1}},"successes":2}`, script)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	basev0 "github.com/codefly-dev/core/generated/go/codefly/base/v0"
+	"github.com/codefly-dev/core/resources"
+)
+
+// RegistrySettings point dependency installs at a private registry. Tokens
+// come from workspace configurations, for runtime installs and image builds
+// alike; the generated .npmrc never holds one on disk in the source tree, and
+// image builds receive it as a BuildKit secret, never a layer.
+type RegistrySettings struct {
+	// URL is the default registry, e.g. https://npm.example.com/.
+	URL string `yaml:"url,omitempty"`
+	// Scopes send package scopes to their own registry, e.g.
+	// "@acme": https://npm.pkg.github.com/.
+	Scopes map[string]string `yaml:"scopes,omitempty"`
+	// Auth lists the registries that need a token and where it comes from.
+	Auth []RegistryAuth `yaml:"auth,omitempty"`
+}
+
+// RegistryAuth maps a registry to the workspace configuration value holding
+// its token.
+type RegistryAuth struct {
+	// Registry defaults to the registry URL.
+	Registry string `yaml:"registry,omitempty"`
+	// Configuration is the workspace configuration holding the token.
+	Configuration string `yaml:"configuration"`
+	// Key of the token in that configuration, and the environment variable
+	// installs read it from. Default: NPM_TOKEN.
+	Key string `yaml:"key,omitempty"`
+}
+
+const defaultRegistryTokenKey = "NPM_TOKEN"
+
+var registryTokenKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (r RegistrySettings) configured() bool {
+	return r.URL != "" || len(r.Scopes) > 0 || len(r.Auth) > 0
+}
+
+func (a RegistryAuth) key() string {
+	if a.Key == "" {
+		return defaultRegistryTokenKey
+	}
+	return a.Key
+}
+
+func (a RegistryAuth) registry(settings RegistrySettings) string {
+	if a.Registry == "" {
+		return settings.URL
+	}
+	return a.Registry
+}
+
+// validate rejects settings the generated .npmrc cannot express. Only npm
+// and pnpm read it; Yarn Berry and Bun keep registries in their own files.
+func (r RegistrySettings) validate(manager nodePackageManagerKind) error {
+	if manager != nodePackageManagerNPM && manager != nodePackageManagerPNPM {
+		return fmt.Errorf("registry settings apply to npm and pnpm projects; configure the %s registry in its own configuration", manager)
+	}
+	if r.URL != "" {
+		if err := validateRegistryURL(r.URL); err != nil {
+			return err
+		}
+	}
+	for scope, registry := range r.Scopes {
+		if !strings.HasPrefix(scope, "@") || strings.ContainsAny(scope, "/ \n") {
+			return fmt.Errorf("registry scope %q must look like @scope", scope)
+		}
+		if err := validateRegistryURL(registry); err != nil {
+			return err
+		}
+	}
+	for _, auth := range r.Auth {
+		registry := auth.registry(r)
+		if registry == "" {
+			return fmt.Errorf("registry auth from configuration %q needs a registry", auth.Configuration)
+		}
+		if err := validateRegistryURL(registry); err != nil {
+			return err
+		}
+		if auth.Configuration == "" {
+			return fmt.Errorf("registry auth for %s needs a configuration", registry)
+		}
+		if !registryTokenKey.MatchString(auth.key()) {
+			return fmt.Errorf("registry auth key %q must be an environment variable name", auth.key())
+		}
+	}
+	return nil
+}
+
+func validateRegistryURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" || parsed.User != nil {
+		return fmt.Errorf("registry %q must be an http(s) URL without credentials", raw)
+	}
+	return nil
+}
+
+// registryAuthPrefix is npm's per-registry key for credentials: the URL
+// without its scheme, ending in a slash.
+func registryAuthPrefix(registry string) string {
+	parsed, _ := url.Parse(registry)
+	return "//" + parsed.Host + strings.TrimSuffix(parsed.Path, "/") + "/"
+}
+
+// npmrc renders the registry settings as an .npmrc. token returns what to
+// write for each auth entry: an ${ENV} reference npm expands at install
+// time, or the token itself for a build secret.
+func (r RegistrySettings) npmrc(token func(RegistryAuth) (string, error)) (string, error) {
+	var b strings.Builder
+	if r.URL != "" {
+		fmt.Fprintf(&b, "registry=%s\n", r.URL)
+	}
+	scopes := make([]string, 0, len(r.Scopes))
+	for scope := range r.Scopes {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	for _, scope := range scopes {
+		fmt.Fprintf(&b, "%s:registry=%s\n", scope, r.Scopes[scope])
+	}
+	for _, auth := range r.Auth {
+		value, err := token(auth)
+		if err != nil {
+			return "", err
+		}
+		// A line break would let a token write arbitrary .npmrc settings.
+		if strings.ContainsAny(value, "\r\n") {
+			return "", fmt.Errorf("registry token %s contains a line break", auth.key())
+		}
+		fmt.Fprintf(&b, "%s:_authToken=%s\n", registryAuthPrefix(auth.registry(r)), value)
+	}
+	return b.String(), nil
+}
+
+// registryTokenReference leaves the token to the install process environment.
+func registryTokenReference(auth RegistryAuth) (string, error) {
+	return "${" + auth.key() + "}", nil
+}
+
+// workspaceConfigurationValue finds key in the workspace configuration name.
+func workspaceConfigurationValue(configs []*basev0.Configuration, name, key string) (string, bool) {
+	for _, conf := range configs {
+		if conf == nil {
+			continue
+		}
+		for _, info := range conf.Infos {
+			if info == nil || info.Name != name {
+				continue
+			}
+			for _, val := range info.ConfigurationValues {
+				if val != nil && val.Key == key {
+					return val.Value, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// registryTokenFrom resolves each token from its workspace configuration.
+func registryTokenFrom(configs []*basev0.Configuration, settings RegistrySettings) func(RegistryAuth) (string, error) {
+	return func(auth RegistryAuth) (string, error) {
+		token, ok := workspaceConfigurationValue(configs, auth.Configuration, auth.key())
+		if !ok {
+			return "", fmt.Errorf("registry auth for %s: workspace configuration %q has no %s", auth.registry(settings), auth.Configuration, auth.key())
+		}
+		return token, nil
+	}
+}
+
+// registryEnvironment generates the source directory's .codefly/npmrc and
+// returns the environment an install needs to use it.
+func (s *Runtime) registryEnvironment(manager *nodePackageManager) ([]*resources.EnvironmentVariable, error) {
+	registry := s.Settings.Registry
+	if !registry.configured() {
+		return nil, nil
+	}
+	if err := registry.validate(manager.Kind); err != nil {
+		return nil, err
+	}
+	return registry.installEnvironment(filepath.Join(s.sourceLocation, ".codefly", "npmrc"), s.workspaceConfigs)
+}
+
+// installEnvironment writes the .npmrc to path and returns the file as npm's
+// user configuration, and each token from its workspace configuration. The
+// file only references the tokens, so it is safe on disk; the tokens exist
+// only in the install process environment.
+func (r RegistrySettings) installEnvironment(path string, configs []*basev0.Configuration) ([]*resources.EnvironmentVariable, error) {
+	content, err := r.npmrc(registryTokenReference)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		return nil, fmt.Errorf("write generated .npmrc: %w", err)
+	}
+	envs := []*resources.EnvironmentVariable{resources.Env("NPM_CONFIG_USERCONFIG", path)}
+	token := registryTokenFrom(configs, r)
+	seen := map[string]bool{}
+	for _, auth := range r.Auth {
+		if seen[auth.key()] {
+			continue
+		}
+		seen[auth.key()] = true
+		value, err := token(auth)
+		if err != nil {
+			return nil, err
+		}
+		envs = append(envs, resources.Env(auth.key(), value))
+	}
+	return envs, nil
+}
+
+// buildWithRegistrySecret builds the image through the docker CLI, which
+// hands BuildKit the rendered .npmrc as the npmrc secret. It is mounted for
+// the install step only and removed from disk when the build ends.
+func (s *Builder) buildWithRegistrySecret(ctx context.Context, image *resources.DockerImage) error {
+	secret, err := s.Settings.Registry.writeBuildSecret(s.workspaceConfigs)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(secret)
+	// BuildKit reads the ignore file beside the Dockerfile.
+	ignore, err := os.ReadFile(s.Local("%s", "builder/dockerignore"))
+	if err != nil {
+		return err
+	}
+	ignorefile := s.Local("%s", "builder/Dockerfile.dockerignore")
+	if err := os.WriteFile(ignorefile, ignore, 0o644); err != nil {
+		return err
+	}
+	defer os.Remove(ignorefile)
+
+	cmd := exec.CommandContext(ctx, "docker", registryBuildArgs(s.Local("%s", "builder/Dockerfile"), secret, image.FullName(), s.Location)...)
+	cmd.Env = append(os.Environ(), "DOCKER_BUILDKIT=1")
+	cmd.Stdout, cmd.Stderr = s.Logger, s.Logger
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("docker build: %w", err)
+	}
+	return nil
+}
+
+// writeBuildSecret renders the .npmrc with the tokens of the workspace
+// configurations into a private temporary file, which the caller removes.
+func (r RegistrySettings) writeBuildSecret(configs []*basev0.Configuration) (string, error) {
+	npmrc, err := r.npmrc(registryTokenFrom(configs, r))
+	if err != nil {
+		return "", err
+	}
+	secret, err := os.CreateTemp("", "codefly-npmrc-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = secret.WriteString(npmrc)
+	if closeErr := secret.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(secret.Name())
+		return "", fmt.Errorf("write registry secret: %w", err)
+	}
+	return secret.Name(), nil
+}
+
+// registryBuildArgs is the docker build command line mounting secret as the
+// npmrc BuildKit secret. Only its path reaches the arguments.
+func registryBuildArgs(dockerfile, secret, tag, buildContext string) []string {
+	return []string{"build",
+		"--file", dockerfile,
+		"--secret", "id=npmrc,src=" + secret,
+		"--tag", tag,
+		buildContext,
+	}
+}
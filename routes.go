@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+type nextRouteKind string
+
+const (
+	nextRoutePage       nextRouteKind = "page"
+	nextRouteHandler    nextRouteKind = "route-handler"
+	nextRouteLayout     nextRouteKind = "layout"
+	nextRouteMiddleware nextRouteKind = "middleware"
+)
+
+const (
+	nextRenderingStatic  = "static"
+	nextRenderingDynamic = "dynamic"
+)
+
+// nextRouteExtensions are the default Next.js pageExtensions plus MDX.
+var nextRouteExtensions = []string{".tsx", ".ts", ".jsx", ".js", ".mdx"}
+
+// nextRoute is one entry of the route table.
+type nextRoute struct {
+	// Pattern is the URL pattern with Next.js dynamic segments, e.g.
+	// /blog/[slug] or /docs/[[...path]].
+	Pattern string        `json:"pattern"`
+	Kind    nextRouteKind `json:"kind"`
+	// Router is "app" or "pages"; middleware belongs to neither.
+	Router string `json:"router,omitempty"`
+	// File is relative to the Node source directory.
+	File    string           `json:"file"`
+	Methods []string         `json:"methods,omitempty"`
+	Params  []nextRouteParam `json:"params,omitempty"`
+	// Groups are the route groups, e.g. (marketing), the file sits in.
+	Groups []string `json:"groups,omitempty"`
+	// Slot names the parallel route (@slot) rendering this file.
+	Slot string `json:"slot,omitempty"`
+	// Intercepts is the interception marker, e.g. (.) or (..), when this
+	// route intercepts another.
+	Intercepts string `json:"intercepts,omitempty"`
+	// Rendering is a static analysis hint, "static" or "dynamic", with the
+	// reason; empty when the source does not decide it.
+	Rendering       string `json:"rendering,omitempty"`
+	RenderingReason string `json:"rendering_reason,omitempty"`
+}
+
+type nextRouteParam struct {
+	Name     string `json:"name"`
+	CatchAll bool   `json:"catch_all,omitempty"`
+	Optional bool   `json:"optional,omitempty"`
+}
+
+var errNoNextRouter = errors.New("no app/ or pages/ directory found")
+
+var (
+	nextInterceptPrefix = regexp.MustCompile(`^(\(\.\)|\(\.\.\.\)|(?:\(\.\.\))+)`)
+	nextDynamicSegment  = regexp.MustCompile(`^\[(\[)?(\.\.\.)?([^\[\]]+)\]?\]$`)
+	nextHTTPMethods     = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	nextMethodExport    = regexp.MustCompile(`export\s+(?:async\s+)?(?:function\s*\*?\s*|(?:const|let|var)\s+)(GET|HEAD|POST|PUT|PATCH|DELETE|OPTIONS)\b`)
+	nextExportList      = regexp.MustCompile(`export\s*\{([^}]*)\}`)
+	nextSegmentConfig   = regexp.MustCompile(`export\s+const\s+dynamic\s*=\s*["']([\w-]+)["']`)
+	nextRevalidate      = regexp.MustCompile(`export\s+const\s+revalidate\s*=\s*(\d+|false)`)
+	nextDynamicAPIs     = regexp.MustCompile(`\b(cookies|headers|draftMode|connection|unstable_noStore)\s*\(`)
+)
+
+// analyzeNextRoutes walks a Next.js source directory and returns its route
+// table. Like Next.js, it uses app/ and pages/ at the source root and falls
+// back to src/app and src/pages only when neither exists there.
+func analyzeNextRoutes(sourceDir string) ([]nextRoute, error) {
+	base := ""
+	if !dirExists(filepath.Join(sourceDir, "app")) && !dirExists(filepath.Join(sourceDir, "pages")) {
+		base = "src"
+		if !dirExists(filepath.Join(sourceDir, base, "app")) && !dirExists(filepath.Join(sourceDir, base, "pages")) {
+			return nil, fmt.Errorf("%w in %s", errNoNextRouter, sourceDir)
+		}
+	}
+	var routes []nextRoute
+	if dir := filepath.Join(base, "app"); dirExists(filepath.Join(sourceDir, dir)) {
+		app, err := analyzeAppRouter(sourceDir, dir)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, app...)
+	}
+	if dir := filepath.Join(base, "pages"); dirExists(filepath.Join(sourceDir, dir)) {
+		pages, err := analyzePagesRouter(sourceDir, dir)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, pages...)
+	}
+	for _, name := range []string{"middleware", "proxy"} {
+		for _, extension := range []string{".ts", ".js"} {
+			file := filepath.ToSlash(filepath.Join(base, name+extension))
+			if fileExists(filepath.Join(sourceDir, file)) {
+				routes = append(routes, nextRoute{Pattern: "/*", Kind: nextRouteMiddleware, File: file})
+			}
+		}
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		if routes[i].Kind != routes[j].Kind {
+			return routes[i].Kind < routes[j].Kind
+		}
+		return routes[i].File < routes[j].File
+	})
+	return routes, nil
+}
+
+func analyzeAppRouter(sourceDir, appDir string) ([]nextRoute, error) {
+	var routes []nextRoute
+	err := filepath.WalkDir(filepath.Join(sourceDir, appDir), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			// Private folders (_components) and dependencies never route.
+			if name == "node_modules" || (strings.HasPrefix(name, "_") && path != filepath.Join(sourceDir, appDir)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		extension := filepath.Ext(name)
+		if !nextRouteExtension(extension) {
+			return nil
+		}
+		var kind nextRouteKind
+		switch strings.TrimSuffix(name, extension) {
+		case "page":
+			kind = nextRoutePage
+		case "route":
+			kind = nextRouteHandler
+		case "layout":
+			kind = nextRouteLayout
+		default:
+			return nil
+		}
+		relative, err := filepath.Rel(filepath.Join(sourceDir, appDir), filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		route := nextRoute{Kind: kind, Router: "app", File: filepath.ToSlash(filepath.Join(appDir, relative, name))}
+		var segments []string
+		for _, segment := range strings.Split(filepath.ToSlash(relative), "/") {
+			switch {
+			case segment == "." || segment == "":
+			case strings.HasPrefix(segment, "@"):
+				route.Slot = strings.TrimPrefix(segment, "@")
+			case strings.HasPrefix(segment, "(") && strings.HasSuffix(segment, ")") && !nextInterceptPrefix.MatchString(segment):
+				route.Groups = append(route.Groups, segment)
+			default:
+				if marker := nextInterceptPrefix.FindString(segment); marker != "" {
+					route.Intercepts = marker
+					segment = strings.TrimPrefix(segment, marker)
+				}
+				if param, ok := parseNextDynamicSegment(segment); ok {
+					route.Params = append(route.Params, param)
+				}
+				segments = append(segments, segment)
+			}
+		}
+		route.Pattern = "/" + strings.Join(segments, "/")
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", route.File, err)
+		}
+		if kind == nextRouteHandler {
+			route.Methods = nextRouteMethods(string(source))
+		}
+		if kind != nextRouteLayout {
+			route.Rendering, route.RenderingReason = appRenderingHint(route, string(source))
+		}
+		routes = append(routes, route)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("analyze %s: %w", appDir, err)
+	}
+	return routes, nil
+}
+
+func analyzePagesRouter(sourceDir, pagesDir string) ([]nextRoute, error) {
+	var routes []nextRoute
+	err := filepath.WalkDir(filepath.Join(sourceDir, pagesDir), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == "node_modules" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		extension := filepath.Ext(entry.Name())
+		stem := strings.TrimSuffix(entry.Name(), extension)
+		// _app, _document, and _error customize rendering; they are not routes.
+		if !nextRouteExtension(extension) || strings.HasPrefix(stem, "_") {
+			return nil
+		}
+		relative, err := filepath.Rel(filepath.Join(sourceDir, pagesDir), path)
+		if err != nil {
+			return err
+		}
+		relative = filepath.ToSlash(strings.TrimSuffix(relative, extension))
+		route := nextRoute{Kind: nextRoutePage, Router: "pages", File: filepath.ToSlash(filepath.Join(pagesDir, filepath.FromSlash(relative)+extension))}
+		var segments []string
+		for _, segment := range strings.Split(relative, "/") {
+			if param, ok := parseNextDynamicSegment(segment); ok {
+				route.Params = append(route.Params, param)
+			}
+			segments = append(segments, segment)
+		}
+		if segments[len(segments)-1] == "index" {
+			segments = segments[:len(segments)-1]
+		}
+		route.Pattern = "/" + strings.Join(segments, "/")
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", route.File, err)
+		}
+		if len(segments) > 0 && segments[0] == "api" {
+			// Pages API routes receive every method in one handler.
+			route.Kind = nextRouteHandler
+			route.Rendering, route.RenderingReason = nextRenderingDynamic, "pages API route"
+		} else {
+			route.Rendering, route.RenderingReason = pagesRenderingHint(route, string(source))
+		}
+		routes = append(routes, route)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("analyze %s: %w", pagesDir, err)
+	}
+	return routes, nil
+}
+
+func nextRouteExtension(extension string) bool {
+	for _, candidate := range nextRouteExtensions {
+		if extension == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNextDynamicSegment recognizes [param], [...param], and [[...param]].
+func parseNextDynamicSegment(segment string) (nextRouteParam, bool) {
+	match := nextDynamicSegment.FindStringSubmatch(segment)
+	if match == nil {
+		return nextRouteParam{}, false
+	}
+	optional := match[1] != ""
+	if optional != strings.HasSuffix(segment, "]]") {
+		return nextRouteParam{}, false
+	}
+	return nextRouteParam{Name: match[3], CatchAll: match[2] != "", Optional: optional}, true
+}
+
+// nextRouteMethods lists the HTTP methods a route handler exports, whether
+// declared inline or through an export list (`export { handler as GET }`).
+func nextRouteMethods(source string) []string {
+	exported := map[string]bool{}
+	for _, match := range nextMethodExport.FindAllStringSubmatch(source, -1) {
+		exported[match[1]] = true
+	}
+	for _, match := range nextExportList.FindAllStringSubmatch(source, -1) {
+		for _, item := range strings.Split(match[1], ",") {
+			fields := strings.Fields(item)
+			if len(fields) > 0 {
+				exported[fields[len(fields)-1]] = true
+			}
+		}
+	}
+	var methods []string
+	for _, method := range nextHTTPMethods {
+		if exported[method] {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// appRenderingHint reads the route segment config and dynamic API usage.
+// It is a hint: the build output (`build-manifest`) is authoritative.
+func appRenderingHint(route nextRoute, source string) (string, string) {
+	if match := nextSegmentConfig.FindStringSubmatch(source); match != nil {
+		switch match[1] {
+		case "force-dynamic":
+			return nextRenderingDynamic, "dynamic = 'force-dynamic'"
+		case "force-static", "error":
+			return nextRenderingStatic, fmt.Sprintf("dynamic = '%s'", match[1])
+		}
+	}
+	if match := nextRevalidate.FindStringSubmatch(source); match != nil {
+		if match[1] == "0" {
+			return nextRenderingDynamic, "revalidate = 0"
+		}
+		return nextRenderingStatic, "revalidate = " + match[1]
+	}
+	if match := nextDynamicAPIs.FindStringSubmatch(source); match != nil {
+		return nextRenderingDynamic, "calls " + match[1] + "()"
+	}
+	if route.Kind == nextRouteHandler {
+		for _, method := range route.Methods {
+			if method != "GET" && method != "HEAD" && method != "OPTIONS" {
+				return nextRenderingDynamic, "exports " + method
+			}
+		}
+		return "", ""
+	}
+	if strings.Contains(source, "searchParams") {
+		return nextRenderingDynamic, "reads searchParams"
+	}
+	if len(route.Params) > 0 {
+		if strings.Contains(source, "generateStaticParams") {
+			return nextRenderingStatic, "generateStaticParams"
+		}
+		return nextRenderingDynamic, "dynamic segment without generateStaticParams"
+	}
+	return nextRenderingStatic, "no dynamic APIs"
+}
+
+func pagesRenderingHint(route nextRoute, source string) (string, string) {
+	switch {
+	case strings.Contains(source, "getServerSideProps"):
+		return nextRenderingDynamic, "getServerSideProps"
+	case strings.Contains(source, "getStaticProps"):
+		return nextRenderingStatic, "getStaticProps"
+	case strings.Contains(source, "getInitialProps"):
+		return nextRenderingDynamic, "getInitialProps"
+	case len(route.Params) > 0:
+		return nextRenderingDynamic, "dynamic segment without getStaticPaths"
+	}
+	return nextRenderingStatic, "automatic static optimization"
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// formatNextRoutesJSON renders the route table for tools.
+func formatNextRoutesJSON(routes []nextRoute) (string, error) {
+	if routes == nil {
+		routes = []nextRoute{}
+	}
+	data, err := json.MarshalIndent(routes, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("encode routes: %w", err)
+	}
+	return string(data), nil
+}
+
+// formatNextRoutesText renders the route table for people.
+func formatNextRoutesText(routes []nextRoute) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "Routes (%d):\n", len(routes))
+	table := tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+	for _, route := range routes {
+		details := []string{}
+		if len(route.Methods) > 0 {
+			details = append(details, strings.Join(route.Methods, ","))
+		}
+		if route.Slot != "" {
+			details = append(details, "@"+route.Slot)
+		}
+		if route.Intercepts != "" {
+			details = append(details, "intercepts "+route.Intercepts)
+		}
+		if route.Rendering != "" {
+			details = append(details, fmt.Sprintf("%s (%s)", route.Rendering, route.RenderingReason))
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", route.Pattern, route.Kind, route.File, strings.Join(details, "; "))
+	}
+	_ = table.Flush()
+	return strings.TrimRight(out.String(), "\n")
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func findRoute(t *testing.T, routes []nextRoute, file string) nextRoute {
+	t.Helper()
+	for _, route := range routes {
+		if route.File == file {
+			return route
+		}
+	}
+	t.Fatalf("no route for %s in %+v", file, routes)
+	return nextRoute{}
+}
+
+func TestAnalyzeNextRoutesUnderstandsAppRouterConventions(t *testing.T) {
+	source := t.TempDir()
+	for name, content := range map[string]string{
+		"src/app/layout.tsx":                          "export default function RootLayout() {}",
+		"src/app/page.tsx":                            "export default function Home() {}",
+		"src/app/(marketing)/about/page.mdx":          "# About",
+		"src/app/blog/[slug]/page.jsx":                "export async function generateStaticParams() {}\nexport default function Post() {}",
+		"src/app/docs/[[...path]]/page.js":            "export default function Docs() {}",
+		"src/app/shop/[...rest]/page.tsx":             "import { cookies } from 'next/headers';\nexport default function Shop() { cookies(); }",
+		"src/app/api/healthz/route.ts":                "export const dynamic = \"force-static\";\nexport function GET() {}",
+		"src/app/api/users/[id]/route.ts":             "export async function GET() {}\nexport const DELETE = async () => {};\nconst handler = () => {};\nexport { handler as PATCH };",
+		"src/app/@modal/(.)photo/[id]/page.tsx":       "export default function PhotoModal() {}",
+		"src/app/feed/@analytics/page.tsx":            "export default function Analytics() {}",
+		"src/app/_components/button/page.tsx":         "export default function NotARoute() {}",
+		"src/app/dashboard/(..)(..)settings/page.tsx": "export default function Intercepted() {}",
+		"src/app/search/page.tsx":                     "export default function Search({ searchParams }) {}",
+		"src/app/components.tsx":                      "export const notARoute = true;",
+		"src/middleware.ts":                           "export function middleware() {}",
+	} {
+		writeProductionTestFile(t, source, name, content)
+	}
+
+	routes, err := analyzeNextRoutes(source)
+	require.NoError(t, err)
+
+	home := findRoute(t, routes, "src/app/page.tsx")
+	require.Equal(t, nextRoute{
+		Pattern: "/", Kind: nextRoutePage, Router: "app", File: "src/app/page.tsx",
+		Rendering: nextRenderingStatic, RenderingReason: "no dynamic APIs",
+	}, home)
+	require.Equal(t, nextRouteLayout, findRoute(t, routes, "src/app/layout.tsx").Kind)
+
+	about := findRoute(t, routes, "src/app/(marketing)/about/page.mdx")
+	require.Equal(t, "/about", about.Pattern)
+	require.Equal(t, []string{"(marketing)"}, about.Groups)
+
+	post := findRoute(t, routes, "src/app/blog/[slug]/page.jsx")
+	require.Equal(t, "/blog/[slug]", post.Pattern)
+	require.Equal(t, []nextRouteParam{{Name: "slug"}}, post.Params)
+	require.Equal(t, nextRenderingStatic, post.Rendering)
+
+	docs := findRoute(t, routes, "src/app/docs/[[...path]]/page.js")
+	require.Equal(t, []nextRouteParam{{Name: "path", CatchAll: true, Optional: true}}, docs.Params)
+	require.Equal(t, "dynamic segment without generateStaticParams", docs.RenderingReason)
+
+	shop := findRoute(t, routes, "src/app/shop/[...rest]/page.tsx")
+	require.Equal(t, []nextRouteParam{{Name: "rest", CatchAll: true}}, shop.Params)
+	require.Equal(t, "calls cookies()", shop.RenderingReason)
+
+	health := findRoute(t, routes, "src/app/api/healthz/route.ts")
+	require.Equal(t, nextRouteHandler, health.Kind)
+	require.Equal(t, []string{"GET"}, health.Methods)
+	require.Equal(t, nextRenderingStatic, health.Rendering)
+
+	users := findRoute(t, routes, "src/app/api/users/[id]/route.ts")
+	require.Equal(t, []string{"GET", "PATCH", "DELETE"}, users.Methods)
+	require.Equal(t, "exports PATCH", users.RenderingReason)
+
+	modal := findRoute(t, routes, "src/app/@modal/(.)photo/[id]/page.tsx")
+	require.Equal(t, "/photo/[id]", modal.Pattern)
+	require.Equal(t, "modal", modal.Slot)
+	require.Equal(t, "(.)", modal.Intercepts)
+
+	analytics := findRoute(t, routes, "src/app/feed/@analytics/page.tsx")
+	require.Equal(t, "/feed", analytics.Pattern)
+	require.Equal(t, "analytics", analytics.Slot)
+
+	intercepted := findRoute(t, routes, "src/app/dashboard/(..)(..)settings/page.tsx")
+	require.Equal(t, "/dashboard/settings", intercepted.Pattern)
+	require.Equal(t, "(..)(..)", intercepted.Intercepts)
+
+	require.Equal(t, "reads searchParams", findRoute(t, routes, "src/app/search/page.tsx").RenderingReason)
+	require.Equal(t, nextRouteMiddleware, findRoute(t, routes, "src/middleware.ts").Kind)
+
+	for _, route := range routes {
+		require.NotContains(t, route.File, "_components")
+		require.NotEqual(t, "src/app/components.tsx", route.File)
+	}
+	require.Len(t, routes, 13)
+}
+
+func TestAnalyzeNextRoutesUnderstandsThePagesRouterWithoutSrc(t *testing.T) {
+	source := t.TempDir()
+	for name, content := range map[string]string{
+		"pages/_app.tsx":           "export default function App() {}",
+		"pages/index.tsx":          "export default function Home() {}",
+		"pages/posts/[id].tsx":     "export async function getServerSideProps() {}",
+		"pages/docs/index.js":      "export async function getStaticProps() {}",
+		"pages/api/hello.ts":       "export default function handler() {}",
+		"src/app/ignored/page.tsx": "export default function Ignored() {}",
+		"app/dashboard/page.tsx":   "export default function Dashboard() {}",
+		"pages/blog/[...slug].jsx": "export default function Blog() {}",
+	} {
+		writeProductionTestFile(t, source, name, content)
+	}
+
+	routes, err := analyzeNextRoutes(source)
+	require.NoError(t, err)
+
+	require.Equal(t, "/", findRoute(t, routes, "pages/index.tsx").Pattern)
+	posts := findRoute(t, routes, "pages/posts/[id].tsx")
+	require.Equal(t, "/posts/[id]", posts.Pattern)
+	require.Equal(t, "getServerSideProps", posts.RenderingReason)
+	require.Equal(t, "/docs", findRoute(t, routes, "pages/docs/index.js").Pattern)
+	hello := findRoute(t, routes, "pages/api/hello.ts")
+	require.Equal(t, nextRouteHandler, hello.Kind)
+	require.Equal(t, "/api/hello", hello.Pattern)
+	require.Equal(t, "/dashboard", findRoute(t, routes, "app/dashboard/page.tsx").Pattern)
+	for _, route := range routes {
+		require.NotEqual(t, "pages/_app.tsx", route.File)
+		require.NotEqual(t, "src/app/ignored/page.tsx", route.File, "root app/ and pages/ take precedence over src/")
+	}
+}
+
+func TestAnalyzeNextRoutesReportsAMissingRouter(t *testing.T) {
+	_, err := analyzeNextRoutes(t.TempDir())
+	require.ErrorIs(t, err, errNoNextRouter)
+}
+
+func TestFormatNextRoutesAsJSONAndText(t *testing.T) {
+	routes := []nextRoute{
+		{Pattern: "/", Kind: nextRoutePage, Router: "app", File: "src/app/page.tsx", Rendering: nextRenderingStatic, RenderingReason: "no dynamic APIs"},
+		{Pattern: "/api/users/[id]", Kind: nextRouteHandler, Router: "app", File: "src/app/api/users/[id]/route.ts", Methods: []string{"GET", "DELETE"}, Params: []nextRouteParam{{Name: "id"}}},
+	}
+
+	encoded, err := formatNextRoutesJSON(routes)
+	require.NoError(t, err)
+	var decoded []map[string]any
+	require.NoError(t, json.Unmarshal([]byte(encoded), &decoded))
+	require.Equal(t, "route-handler", decoded[1]["kind"])
+	require.Equal(t, []any{"GET", "DELETE"}, decoded[1]["methods"])
+
+	empty, err := formatNextRoutesJSON(nil)
+	require.NoError(t, err)
+	require.Equal(t, "[]", empty)
+
+	text := formatNextRoutesText(routes)
+	require.Contains(t, text, "Routes (2):\n/ ")
+	require.Contains(t, text, "static (no dynamic APIs)")
+	require.Regexp(t, `/api/users/\[id\]\s+route-handler\s+src/app/api/users/\[id\]/route.ts\s+GET,DELETE`, text)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"crypto/sha256"
 	"encoding/json"
@@ -13,7 +14,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
-	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -40,13 +41,24 @@ type Runtime struct {
 
 	// internal
 	runnerEnvironment runners.RunnerEnvironment
-	runner            runners.Proc
+	server            serverProcess
+	supervisor        *serverSupervisor
+	diagnostics       nextDiagnostics
 	workspaceConfigs  []*basev0.Configuration
 	dependenciesMu    sync.Mutex
 	executionProfile  NextExecutionProfile
 	readinessTimeout  time.Duration
-	packageManifest   *nodePackageManifest
-	projectKind       nodeProjectKind
+	// packageMu guards packageManifest and packageManager, which a dependency
+	// refresh may replace while other RPCs and commands read them.
+	packageMu       sync.RWMutex
+	packageManifest *nodePackageManifest
+	packageManager  *nodePackageManager
+	projectKind     nodeProjectKind
+	// playwrightInstallMu serializes browser recovery across parallel shards,
+	// and flakeHistoryMu their updates of the flake history.
+	playwrightInstallMu sync.Mutex
+	flakeHistoryMu      sync.Mutex
+	testWatcher         *testWatcher
 }
 
 func NewRuntime(service *Service) *Runtime {
@@ -57,20 +69,42 @@ func NewRuntime(service *Service) *Runtime {
 // toolchains, falling back to container mode when the preferred mode is
 // unavailable. Mirrors the go-grpc/python pattern so mode selection is
 // consistent across all three codefly-ecosystem runtimes.
-func (s *Runtime) SetRuntimeContext(_ context.Context, runtimeContext *basev0.RuntimeContext) error {
-	s.Runtime.RuntimeContext = setNextjsRuntimeContext(runtimeContext)
+func (s *Runtime) SetRuntimeContext(ctx context.Context, runtimeContext *basev0.RuntimeContext) error {
+	s.Runtime.RuntimeContext = setNextjsRuntimeContext(runtimeContext, s.nativeToolchain(ctx))
 	return nil
 }
 
+// nativeToolchain is the binary a native run of the project's package manager
+// needs on PATH. Before Load it detects the manager from the source tree, and
+// falls back to npm when that cannot be resolved yet.
+func (s *Runtime) nativeToolchain(ctx context.Context) string {
+	s.packageMu.RLock()
+	manager := s.packageManager
+	s.packageMu.RUnlock()
+	if manager == nil {
+		if location, err := s.resolveSourceLocation(ctx); err == nil {
+			manifest, _ := readNodePackageManifest(location)
+			manager, _ = detectNodePackageManager(location, s.Settings.PackageManager, manifest)
+		}
+	}
+	if manager == nil {
+		return "npm"
+	}
+	binary, _ := manager.command()
+	return binary
+}
+
 // setNextjsRuntimeContext resolves the runtime mode. An explicit Nix or
 // Container request is honored as-is. Otherwise (Native / Free / nil — the
 // AUTO case) it picks the best available environment: run LOCAL if it can,
-// then NIX, then DOCKER. Local wins when the npm toolchain is on PATH; nix
-// when the nix CLI is available; container is the universal fallback.
+// then NIX, then DOCKER. Local wins when toolchain, the binary of the
+// project's package manager (npm, corepack for pnpm and Yarn, bun), is on
+// PATH; nix when the nix CLI is available; container is the universal
+// fallback.
 //
 // A nil argument is treated as AUTO so a missing SetRuntimeContext call never
 // panics here — an agent must never panic on host input.
-func setNextjsRuntimeContext(runtimeContext *basev0.RuntimeContext) *basev0.RuntimeContext {
+func setNextjsRuntimeContext(runtimeContext *basev0.RuntimeContext, toolchain string) *basev0.RuntimeContext {
 	kind := resources.RuntimeContextFree
 	if runtimeContext != nil {
 		kind = runtimeContext.Kind
@@ -82,7 +116,7 @@ func setNextjsRuntimeContext(runtimeContext *basev0.RuntimeContext) *basev0.Runt
 		return resources.NewRuntimeContextContainer()
 	}
 	// AUTO: local → nix → docker.
-	if _, err := exec.LookPath("npm"); err == nil {
+	if _, err := exec.LookPath(toolchain); err == nil {
 		return resources.NewRuntimeContextNative()
 	}
 	if _, err := exec.LookPath("nix"); err == nil {
@@ -100,7 +134,7 @@ func (s *Runtime) CreateRunnerEnvironment(ctx context.Context) error {
 	// than letting the mode dispatch below nil-dereference. An agent must never
 	// panic on missing host input.
 	if s.Runtime.RuntimeContext == nil {
-		s.Runtime.RuntimeContext = setNextjsRuntimeContext(nil)
+		s.Runtime.RuntimeContext = setNextjsRuntimeContext(nil, s.nativeToolchain(ctx))
 		s.Wool.Info("no runtime context provided — auto-resolved",
 			wool.Field("mode", s.Runtime.RuntimeContext.Kind))
 	}
@@ -151,7 +185,7 @@ func (s *Runtime) CreateRunnerEnvironment(ctx context.Context) error {
 		// container running the same checkout.
 		dependencyCacheKey, err := nodeDependencyCacheKey(
 			s.sourceLocation,
-			"linux-"+runtime.GOARCH,
+			s.dependencyPlatform(),
 		)
 		if err != nil {
 			return s.Wool.Wrapf(err, "cannot fingerprint Node dependencies")
@@ -217,11 +251,24 @@ func (s *Runtime) Load(ctx context.Context, req *runtimev0.LoadRequest) (*runtim
 		return s.Runtime.LoadErrorf(err, "creating source location")
 	}
 	s.setSourceLocation(sourceLocation)
-	s.packageManifest, err = readNodePackageManifest(sourceLocation)
+	manifest, err := readNodePackageManifest(sourceLocation)
 	if err != nil {
 		return s.Runtime.LoadErrorf(err, "loading Node.js package manifest")
 	}
-	s.projectKind = s.packageManifest.projectKind()
+	s.projectKind = manifest.projectKind()
+	manager, err := detectNodePackageManager(sourceLocation, s.Settings.PackageManager, manifest)
+	if err != nil {
+		return s.Runtime.LoadErrorf(err, "resolving Node.js package manager")
+	}
+	s.packageMu.Lock()
+	s.packageManifest, s.packageManager = manifest, manager
+	s.packageMu.Unlock()
+	if err := s.Settings.BundleBudgets.validate(); err != nil {
+		return s.Runtime.LoadErrorf(err, "invalid bundle-budgets settings")
+	}
+	if err := s.Settings.Offline.validate(manager); err != nil {
+		return s.Runtime.LoadErrorf(err, "invalid offline settings")
+	}
 	if s.projectKind == nodeProjectNextJS {
 		s.executionProfile, err = s.Settings.ExecutionProfileFor(req.GetEnvironment().GetName())
 		if err != nil {
@@ -236,6 +283,7 @@ func (s *Runtime) Load(ctx context.Context, req *runtimev0.LoadRequest) (*runtim
 			wool.Field("environment", req.GetEnvironment().GetName()),
 			wool.Field("profile", s.executionProfile),
 			wool.Field("readiness_timeout", s.readinessTimeout),
+			wool.Field("package_manager", manager.Kind),
 		)
 	} else {
 		// Generic Node.js packages use this agent for typed Code/Runtime
@@ -347,8 +395,15 @@ func (s *Runtime) Init(ctx context.Context, req *runtimev0.InitRequest) (*runtim
 		return s.Runtime.InitError(err)
 	}
 
-	if s.Settings.HotReload && s.executionProfile == NextExecutionDevelopment {
-		dependencies := requirements.Clone()
+	// Test watch outlives this call. It needs the hot-reload file watcher,
+	// which it turns on by itself.
+	if s.executionProfile == NextExecutionDevelopment {
+		if err := s.startTestWatch(context.WithoutCancel(ctx)); err != nil {
+			s.Wool.Warn("cannot start test watch", wool.ErrField(err))
+		}
+	}
+	if (s.Settings.HotReload || s.testWatcher != nil) && s.executionProfile == NextExecutionDevelopment {
+		dependencies := watchRequirements.Clone()
 		dependencies.Localize(s.Location)
 		conf := services.NewWatchConfiguration(dependencies)
 		if err := s.SetupWatcher(ctx, conf, s.EventHandler); err != nil {
@@ -373,11 +428,9 @@ func (s *Runtime) Start(ctx context.Context, req *runtimev0.StartRequest) (*runt
 	)
 
 	// Stop existing runner
-	if s.runner != nil {
-		err := s.runner.Stop(ctx)
-		if err != nil {
-			return s.Runtime.StartError(err)
-		}
+	s.stopSupervisor()
+	if err := s.server.stop(ctx); err != nil {
+		return s.Runtime.StartError(err)
 	}
 
 	// Get port
@@ -457,6 +510,10 @@ func (s *Runtime) Start(ctx context.Context, req *runtimev0.StartRequest) (*runt
 	if err := s.ensureNodeDependencies(ctx); err != nil {
 		return s.Runtime.StartErrorf(err, "preparing Node.js dependencies")
 	}
+	manager, err := s.resolvePackageManager()
+	if err != nil {
+		return s.Runtime.StartErrorf(err, "resolving Node.js package manager")
+	}
 	commonRuntimeEnvs := []*resources.EnvironmentVariable{
 		resources.Env("UV_THREADPOOL_SIZE", "2"),
 		resources.Env("NODE_OPTIONS", "--max-old-space-size=2048"),
@@ -464,7 +521,8 @@ func (s *Runtime) Start(ctx context.Context, req *runtimev0.StartRequest) (*runt
 	}
 	if s.executionProfile == NextExecutionProduction {
 		commonRuntimeEnvs = append(commonRuntimeEnvs, resources.Env("NODE_ENV", "production"))
-		build, buildErr := s.runnerEnvironment.NewProcess("npm", "run", "build")
+		buildCommand, buildArgs := manager.command(manager.runScriptArgs("build")...)
+		build, buildErr := s.runnerEnvironment.NewProcess(buildCommand, buildArgs...)
 		if buildErr != nil {
 			return s.Runtime.StartErrorf(buildErr, "cannot create Next.js production build process")
 		}
@@ -478,16 +536,9 @@ func (s *Runtime) Start(ctx context.Context, req *runtimev0.StartRequest) (*runt
 		}
 	}
 
-	command := "npm"
-	commandArgs := []string{
-		"run",
-		"dev",
-		"--",
-		"-p",
-		fmt.Sprintf("%d", net.Port),
-	}
+	command, commandArgs := manager.command(manager.runScriptArgs("dev", "-p", fmt.Sprintf("%d", net.Port))...)
 	if s.executionProfile == NextExecutionProduction {
-		launch, launchErr := prepareProductionServer(s.sourceLocation, net.Port)
+		launch, launchErr := prepareProductionServer(s.sourceLocation, "", manager, net.Port)
 		if launchErr != nil {
 			return s.Runtime.StartErrorf(launchErr, "preparing Next.js production server")
 		}
@@ -495,24 +546,35 @@ func (s *Runtime) Start(ctx context.Context, req *runtimev0.StartRequest) (*runt
 		commandArgs = launch.args
 		commonRuntimeEnvs = append(commonRuntimeEnvs, launch.environment...)
 	}
-	proc, err := s.runnerEnvironment.NewProcess(command, commandArgs...)
-	if err != nil {
-		return s.Runtime.StartErrorf(err, "cannot create npm process")
-	}
-	proc.WithEnvironmentVariables(ctx, allEnvs...)
-	proc.WithEnvironmentVariables(ctx, browserEnvs...)
-	// Cap process fan-out. Next.js development otherwise spawns jest-worker
-	// pools for SWC transform + type-check, a webpack worker pool, and
-	// node's libuv threadpool. The same bounds keep local production builds
-	// from exhausting a multi-service workstation.
-	proc.WithEnvironmentVariables(ctx, commonRuntimeEnvs...)
-	proc.WithOutput(s.Logger)
-
-	s.runner = proc
+	tail := newLogTail(defaultSupervisorConfig.TailLines)
+	output := newNextOutputParser(s.reportNextOutput)
 	runningContext := s.Wool.Inject(context.Background())
-	err = s.runner.Start(runningContext)
-	if err != nil {
-		return s.Runtime.StartErrorf(err, "starting Next.js %s server", s.executionProfile)
+	// startServer is also the supervisor's restart path, so a restarted
+	// server gets exactly the command and environment of the first one.
+	startServer := func(ctx context.Context) error {
+		// The errors of a previous process died with it.
+		s.diagnostics.reset()
+		proc, err := s.runnerEnvironment.NewProcess(command, commandArgs...)
+		if err != nil {
+			return fmt.Errorf("cannot create %s process: %w", manager.Kind, err)
+		}
+		proc.WithEnvironmentVariables(ctx, allEnvs...)
+		proc.WithEnvironmentVariables(ctx, browserEnvs...)
+		// Cap process fan-out. Next.js development otherwise spawns jest-worker
+		// pools for SWC transform + type-check, a webpack worker pool, and
+		// node's libuv threadpool. The same bounds keep local production builds
+		// from exhausting a multi-service workstation.
+		proc.WithEnvironmentVariables(ctx, commonRuntimeEnvs...)
+		proc.WithOutput(io.MultiWriter(s.Logger, tail, output))
+
+		s.server.replace(proc, output)
+		if err := proc.Start(runningContext); err != nil {
+			return fmt.Errorf("starting Next.js %s server: %w", s.executionProfile, err)
+		}
+		return nil
+	}
+	if err := startServer(ctx); err != nil {
+		return s.Runtime.StartError(err)
 	}
 
 	// Wait for ready
@@ -521,13 +583,16 @@ func (s *Runtime) Start(ctx context.Context, req *runtimev0.StartRequest) (*runt
 		// The dev server was Started above; stop it before bailing so a
 		// readiness timeout doesn't leave an orphaned next.js process
 		// holding the port.
-		_ = s.runner.Stop(ctx)
-		s.runner = nil
+		_ = s.server.stop(ctx)
 		return s.Runtime.StartError(err)
 	}
 
 	s.Wool.Forwardf("Next.js %s server running on port %d", s.executionProfile, net.Port)
 
+	if err := s.startSupervisor(runningContext, net, startServer, tail); err != nil {
+		return s.Runtime.StartError(err)
+	}
+
 	return s.Runtime.StartResponse()
 }
 
@@ -542,18 +607,18 @@ type productionServerLaunch struct {
 // projects Next emits a self-contained server, but its static and public
 // assets still need to be staged beside that server just as the deployment
 // Dockerfile does.
-func prepareProductionServer(sourceLocation string, port uint32) (productionServerLaunch, error) {
-	fallback := productionServerLaunch{
-		command: "npm",
-		args: []string{
-			"run",
-			"start",
-			"--",
-			"-p",
-			fmt.Sprintf("%d", port),
-		},
+//
+// Processes run from sourceLocation; project is the built Next.js project
+// relative to it, or empty for sourceLocation itself.
+func prepareProductionServer(sourceLocation, project string, manager *nodePackageManager, port uint32) (productionServerLaunch, error) {
+	var fallback productionServerLaunch
+	startArgs := manager.runScriptArgs("start", "-p", fmt.Sprintf("%d", port))
+	if project != "" {
+		startArgs = manager.inDir(project, startArgs...)
 	}
+	fallback.command, fallback.args = manager.command(startArgs...)
 
+	sourceLocation = filepath.Join(sourceLocation, project)
 	manifestPath := filepath.Join(sourceLocation, ".next", "required-server-files.json")
 	content, err := os.ReadFile(manifestPath)
 	if errors.Is(err, os.ErrNotExist) {
@@ -599,7 +664,7 @@ func prepareProductionServer(sourceLocation string, port uint32) (productionServ
 
 	return productionServerLaunch{
 		command: "node",
-		args:    []string{filepath.ToSlash(filepath.Join(".next", "standalone", "server.js"))},
+		args:    []string{filepath.ToSlash(filepath.Join(project, ".next", "standalone", "server.js"))},
 		environment: []*resources.EnvironmentVariable{
 			resources.Env("PORT", fmt.Sprintf("%d", port)),
 			resources.Env("HOSTNAME", "0.0.0.0"),
@@ -626,6 +691,10 @@ func (s *Runtime) WaitForReady(ctx context.Context, net *basev0.NetworkInstance)
 	defer s.Wool.Catch()
 	ctx = s.Wool.Inject(ctx)
 
+	contract, err := s.Settings.ReadinessContract()
+	if err != nil {
+		return s.Wool.Wrapf(err, "resolving Next.js readiness contract")
+	}
 	address := net.Address
 	timeout := s.readinessTimeout
 	if timeout <= 0 {
@@ -638,11 +707,12 @@ func (s *Runtime) WaitForReady(ctx context.Context, net *basev0.NetworkInstance)
 	s.Wool.Debug(
 		"waiting for Next.js to be ready",
 		wool.Field("address", address),
+		wool.Field("path", contract.Path),
 		wool.Field("timeout", timeout),
 	)
 
 	client := &http.Client{Timeout: 2 * time.Second}
-	if err := waitForHTTPReady(ctx, client, address, timeout, 250*time.Millisecond); err != nil {
+	if err := waitForHTTPReady(ctx, client, address, contract, timeout, 250*time.Millisecond); err != nil {
 		return s.Wool.Wrapf(err, "Next.js readiness probe failed")
 	}
 	s.Wool.Debug("Next.js is ready!")
@@ -653,6 +723,7 @@ func waitForHTTPReady(
 	ctx context.Context,
 	client *http.Client,
 	address string,
+	contract readinessContract,
 	timeout time.Duration,
 	pollInterval time.Duration,
 ) error {
@@ -665,24 +736,38 @@ func waitForHTTPReady(
 	if pollInterval <= 0 {
 		return errors.New("readiness poll interval must be greater than zero")
 	}
+	if contract.Successes <= 0 {
+		contract.Successes = 1
+	}
+	probeURL, err := contract.url(address)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL, nil)
+	if err != nil {
+		return fmt.Errorf("build readiness request: %w", err)
+	}
 
 	timer := time.NewTimer(timeout)
 	defer timer.Stop()
 	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
 
+	// Any HTTP response is not enough: a server-rendered error page still
+	// answers. Readiness requires the contract to pass on consecutive probes.
 	var lastErr error
+	consecutive := 0
 	for {
-		request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
-		if err != nil {
-			return fmt.Errorf("build readiness request: %w", err)
-		}
-		response, err := client.Do(request)
+		err := probeHTTPReady(client, request, contract)
 		if err == nil {
-			_ = response.Body.Close()
-			return nil
+			consecutive++
+			if consecutive >= contract.Successes {
+				return nil
+			}
+		} else {
+			consecutive = 0
+			lastErr = err
 		}
-		lastErr = err
 
 		select {
 		case <-ctx.Done():
@@ -694,25 +779,152 @@ func waitForHTTPReady(
 	}
 }
 
+// reportNextOutput turns a parsed server output event into a typed wool log
+// entry and, for compiles and failures, the compact compile-status line.
+func (s *Runtime) reportNextOutput(event nextOutputEvent) {
+	s.diagnostics.observe(event, time.Now())
+	fields := []*wool.LogField{
+		wool.Field("next.event", string(event.Kind)),
+		wool.Field("next.route", event.Route),
+	}
+	if event.Duration > 0 {
+		fields = append(fields, wool.Field("next.duration", event.Duration))
+	}
+	if event.Modules > 0 {
+		fields = append(fields, wool.Field("next.modules", event.Modules))
+	}
+	if event.File != "" {
+		fields = append(fields,
+			wool.Field("next.file", event.File),
+			wool.Field("next.line", event.Line),
+			wool.Field("next.column", event.Column),
+		)
+	}
+	if event.Module != "" {
+		fields = append(fields, wool.Field("next.module", event.Module))
+	}
+	if len(event.Stack) > 0 {
+		fields = append(fields, wool.Field("next.stack", strings.Join(event.Stack, "\n")))
+	}
+	switch {
+	case event.failed():
+		s.Wool.Warn(event.Message, fields...)
+		s.Wool.Forwardf("%s", event.statusLine())
+	case event.Kind == nextCompiled:
+		s.Wool.Info("compiled", fields...)
+		s.Wool.Forwardf("%s", event.statusLine())
+	default:
+		s.Wool.Debug(string(event.Kind), fields...)
+	}
+}
+
+// startSupervisor watches the ready server until Stop. A process that exits
+// or fails its health probes is restarted through startServer with
+// exponential backoff, up to the crash-loop limit.
+func (s *Runtime) startSupervisor(
+	ctx context.Context,
+	net *basev0.NetworkInstance,
+	startServer func(context.Context) error,
+	tail *logTail,
+) error {
+	contract, err := s.Settings.ReadinessContract()
+	if err != nil {
+		return s.Wool.Wrapf(err, "resolving Next.js readiness contract")
+	}
+	probeURL, err := contract.url(net.Address)
+	if err != nil {
+		return err
+	}
+	// A health check is a single probe; the consecutive-successes streak
+	// only gates startup.
+	contract.Successes = 1
+	client := &http.Client{Timeout: 2 * time.Second}
+	supervisor := &serverSupervisor{
+		config: defaultSupervisorConfig,
+		tail:   tail,
+		probe: func(ctx context.Context) error {
+			request, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL, nil)
+			if err != nil {
+				return err
+			}
+			return probeHTTPReady(client, request, contract)
+		},
+		restart: func(ctx context.Context) error {
+			_ = s.server.stop(ctx)
+			if err := startServer(ctx); err != nil {
+				return err
+			}
+			return s.WaitForReady(ctx, net)
+		},
+		transition: func(from, to serverState, cause error) {
+			switch to {
+			case serverHealthy:
+				s.Wool.Info("Next.js server healthy", wool.Field("from", from))
+			case serverCrashLoop:
+				s.Wool.Forwardf("%v", cause)
+			default:
+				s.Wool.Warn("Next.js server "+string(to), wool.Field("from", from), wool.ErrField(cause))
+			}
+		},
+	}
+	if _, ok := s.server.current().(runningProcess); ok {
+		supervisor.alive = func(ctx context.Context) (bool, error) {
+			// The runner is replaced on restart; check the current one.
+			current, ok := s.server.current().(runningProcess)
+			if !ok {
+				return true, nil
+			}
+			return current.IsRunning(ctx)
+		}
+	}
+	s.supervisor = supervisor
+	supervisor.start(ctx)
+	return nil
+}
+
+func (s *Runtime) stopSupervisor() {
+	if s.supervisor != nil {
+		s.supervisor.stop()
+	}
+}
+
+// probeHTTPReady runs one readiness probe against the contract.
+func probeHTTPReady(client *http.Client, request *http.Request, contract readinessContract) error {
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	return contract.check(response)
+}
+
+// Information reports the supervisor state, when a server is supervised,
+// beside the core runtime information.
 func (s *Runtime) Information(ctx context.Context, req *runtimev0.InformationRequest) (*runtimev0.InformationResponse, error) {
-	return s.Runtime.InformationResponse(ctx, req)
+	response, err := s.Runtime.InformationResponse(ctx, req)
+	if err != nil || response == nil || s.supervisor == nil {
+		return response, err
+	}
+	if err := annotateInformation(response, s.supervisor.status().annotations()); err != nil {
+		s.Wool.Warn("cannot report supervisor state", wool.ErrField(err))
+	}
+	return response, nil
 }
 
 func (s *Runtime) Stop(ctx context.Context, req *runtimev0.StopRequest) (*runtimev0.StopResponse, error) {
 	defer s.Wool.Catch()
 	ctx = s.Wool.Inject(ctx)
 
-	if s.runner != nil {
-		err := s.runner.Stop(ctx)
-		if err != nil {
-			return s.Runtime.StopError(err)
-		}
+	s.stopSupervisor()
+	if err := s.server.stop(ctx); err != nil {
+		return s.Runtime.StopError(err)
 	}
 
 	// Cancel the watcher and let its Start goroutine's deferred close of Events
 	// run exactly once — Stop/Destroy must not close Events itself, or it races
 	// that goroutine into a "close of closed channel" panic.
 	s.Base.StopWatcher()
+	s.stopTestWatch()
 
 	return s.Runtime.StopResponse()
 }
@@ -729,10 +941,9 @@ func (s *Runtime) Destroy(ctx context.Context, req *runtimev0.DestroyRequest) (*
 	// run exactly once — Stop/Destroy must not close Events itself, or it races
 	// that goroutine into a "close of closed channel" panic.
 	s.Base.StopWatcher()
-	if s.runner != nil {
-		_ = s.runner.Stop(ctx)
-		s.runner = nil
-	}
+	s.stopTestWatch()
+	s.stopSupervisor()
+	_ = s.server.stop(ctx)
 	if s.runnerEnvironment != nil {
 		if err := s.runnerEnvironment.Shutdown(ctx); err != nil {
 			return s.Runtime.DestroyError(err)
@@ -749,6 +960,12 @@ func (s *Runtime) Test(ctx context.Context, req *runtimev0.TestRequest) (*runtim
 	if req == nil {
 		req = &runtimev0.TestRequest{}
 	}
+	switch req.Suite {
+	case "a11y":
+		return s.testA11y(ctx, req)
+	case "visual":
+		return s.testVisual(ctx, req)
+	}
 
 	// Map suite to the package-owned npm script, then derive the runner from
 	// package.json. Source workspaces route every Node/TypeScript code unit
@@ -767,7 +984,7 @@ func (s *Runtime) Test(ctx context.Context, req *runtimev0.TestRequest) (*runtim
 	default:
 		npmScript = "test:" + req.Suite
 	}
-	manifest := s.packageManifest
+	manifest := s.cachedPackageManifest()
 	if manifest == nil {
 		var err error
 		manifest, err = readNodePackageManifest(s.sourceLocation)
@@ -782,6 +999,10 @@ func (s *Runtime) Test(ctx context.Context, req *runtimev0.TestRequest) (*runtim
 	if err := s.ensureNodeDependencies(ctx); err != nil {
 		return s.Runtime.TestErrorf(err, "preparing Node.js dependencies")
 	}
+	manager, err := s.resolvePackageManager()
+	if err != nil {
+		return s.Runtime.TestErrorf(err, "resolving Node.js package manager")
+	}
 
 	// Allocate a JSON output file under the project's .codefly cache.
 	// Both vitest and playwright support writing JSON to disk via a
@@ -792,10 +1013,8 @@ func (s *Runtime) Test(ctx context.Context, req *runtimev0.TestRequest) (*runtim
 		return s.Runtime.TestErrorf(err, "creating test cache dir")
 	}
 	jsonFile := filepath.Join(cacheDir, fmt.Sprintf("test-%d.json", time.Now().UnixNano()))
-	defer os.Remove(jsonFile)
-
-	runnerArgs, reporterEnvs := nodeTestReporterConfiguration(runnerKind, jsonFile)
 
+	var runnerArgs []string
 	if pat := combineRegex(req.Filters); pat != "" {
 		switch runnerKind {
 		case nodeTestPlaywright:
@@ -820,35 +1039,214 @@ func (s *Runtime) Test(ctx context.Context, req *runtimev0.TestRequest) (*runtim
 		}
 	}
 
-	if req.Coverage {
-		if runnerKind == nodeTestGeneric {
-			return s.Runtime.TestErrorf(fmt.Errorf("test script %q has no recognized runner", npmScript), "cannot apply typed coverage")
+	// Coverage goes to an agent-owned directory in istanbul's json-summary
+	// and lcov formats, which the agent parses itself. Configured thresholds
+	// collect it on every run whose runner can report it, so the gate is
+	// never skipped because the caller did not ask for coverage.
+	collectCoverage := req.Coverage
+	if !collectCoverage && s.Settings.Test.Coverage.configured() {
+		if _, err := coverageArgs(runnerKind, ""); err == nil {
+			collectCoverage = true
+		} else {
+			s.Wool.Forwardf("test.coverage thresholds not checked: %v", err)
 		}
-		runnerArgs = append(runnerArgs, "--coverage")
 	}
-
-	runnerArgs = append(runnerArgs, req.ExtraArgs...)
-	args := []string{"run", npmScript}
-	if len(runnerArgs) > 0 {
-		args = append(args, "--")
-		args = append(args, runnerArgs...)
+	var coverageDir string
+	if collectCoverage {
+		coverageDir = filepath.Join(s.Service.sourceLocation, ".codefly", "coverage", cmp.Or(req.Suite, "default"))
+		args, err := coverageArgs(runnerKind, coverageDir)
+		if err != nil {
+			return s.Runtime.TestErrorf(err, "cannot apply typed coverage")
+		}
+		if err := os.RemoveAll(coverageDir); err != nil {
+			return s.Runtime.TestErrorf(err, "clearing previous coverage report")
+		}
+		runnerArgs = append(runnerArgs, args...)
 	}
 
-	s.Wool.Info("running Node.js tests",
-		wool.Field("suite", req.Suite),
-		wool.Field("runner", runnerKind),
-		wool.Field("script", npmScript),
-		wool.Field("args", args))
+	productionServer, extraArgs := s.Settings.E2E.productionServer(req.Suite, req.ExtraArgs)
+	shards, extraArgs, err := planTestShards(extraArgs, s.Settings.Test.Parallelism)
+	if err != nil {
+		return s.Runtime.TestErrorf(err, "planning test shards")
+	}
+	retries, explicitRetries, extraArgs, err := testRetries(extraArgs, s.Settings.Test.Retries)
+	if err != nil {
+		return s.Runtime.TestErrorf(err, "reading test retries")
+	}
+	switch runnerKind {
+	case nodeTestVitest, nodeTestJest:
+	case nodeTestPlaywright:
+		// Playwright retries failed tests itself and reports them flaky.
+		if retries > 0 {
+			extraArgs = append(extraArgs, fmt.Sprintf("--retries=%d", retries))
+		}
+		retries = 0
+	default:
+		if explicitRetries && retries > 0 {
+			return s.Runtime.TestErrorf(fmt.Errorf("test script %q has no recognized runner", npmScript), "cannot retry failed tests")
+		}
+		retries = 0
+	}
+	since, changedFiles, extraArgs, err := testSelectionRequest(extraArgs)
+	if err != nil {
+		return s.Runtime.TestErrorf(err, "reading test selection")
+	}
+	// --since and --changed narrow the run to the tests the changed files
+	// affect; the response reports the strategy and what triggered each test.
+	var selection *testSelection
+	if since != "" || len(changedFiles) > 0 {
+		if since != "" {
+			fromGit, err := s.gitChangedFiles(ctx, since)
+			if err != nil {
+				return s.Runtime.TestErrorf(err, "listing changed files")
+			}
+			for _, file := range fromGit {
+				if !slices.Contains(changedFiles, file) {
+					changedFiles = append(changedFiles, file)
+				}
+			}
+		}
+		planned, err := planTestSelection(runnerKind, s.sourceLocation, since, changedFiles)
+		if err != nil {
+			return s.Runtime.TestErrorf(err, "selecting tests by changed files")
+		}
+		s.Wool.Forwardf("%s", planned.text())
+		if planned.Strategy == selectNone {
+			return noSelectedTestsResponse(runnerKind, req.Suite, planned), nil
+		}
+		selection = &planned
+	}
+	if len(shards) > 1 && collectCoverage {
+		err := fmt.Errorf("coverage reports of concurrent shards would overwrite each other")
+		if !req.Coverage {
+			return s.Runtime.TestErrorf(err, "test.coverage thresholds need coverage, which cannot be combined with --parallel")
+		}
+		return s.Runtime.TestErrorf(err, "cannot combine coverage with --parallel")
+	}
+	runnerArgs = append(runnerArgs, extraArgs...)
+
+	// Every shard gets its own JSON report; an unsharded run is one
+	// invocation without a shard argument.
+	invocations := []nodeTestInvocation{{jsonFile: jsonFile}}
+	if len(shards) > 0 {
+		invocations = invocations[:0]
+		for _, shard := range shards {
+			selectionArgs, err := shardArgs(runnerKind, shard, len(shards) > 1)
+			if err != nil {
+				return s.Runtime.TestErrorf(err, "cannot apply test shards")
+			}
+			invocations = append(invocations, nodeTestInvocation{
+				shard:     shard,
+				jsonFile:  strings.TrimSuffix(jsonFile, ".json") + fmt.Sprintf("-shard-%d.json", shard.Index),
+				shardArgs: selectionArgs,
+			})
+		}
+	}
+	// Retries rerun only the failed cases, by exact name, without the shard
+	// selection or the request's filters they already passed.
+	rerunArgs := func(jsonFile, namePattern string) []string {
+		reporterArgs, _ := nodeTestReporterConfiguration(runnerKind, jsonFile)
+		return manager.runScriptArgs(npmScript, slices.Concat(reporterArgs, []string{"--testNamePattern", namePattern}, extraArgs)...)
+	}
+	for i := range invocations {
+		invocation := &invocations[i]
+		defer os.Remove(invocation.jsonFile)
+		reporterArgs, reporterEnvs := nodeTestReporterConfiguration(runnerKind, invocation.jsonFile)
+		invocation.args = selectedTestCommand(manager, npmScript, selection, slices.Concat(reporterArgs, runnerArgs, invocation.shardArgs))
+		invocation.reporterEnvs = reporterEnvs
+		invocation.retries = retries
+		invocation.rerunArgs = rerunArgs
+		invocation.coverageDir = coverageDir
+		s.Wool.Info("running Node.js tests",
+			wool.Field("suite", req.Suite),
+			wool.Field("runner", runnerKind),
+			wool.Field("package_manager", manager.Kind),
+			wool.Field("script", npmScript),
+			wool.Field("args", invocation.args))
+	}
 
 	testEnvs, err := s.EnvironmentVariables.All()
 	if err != nil {
 		return s.Runtime.TestErrorf(err, "getting environment variables")
 	}
+	if productionServer {
+		server, err := s.startIsolatedProductionServer(ctx, manager, testEnvs)
+		if err != nil {
+			return s.Runtime.TestErrorf(err, "starting isolated Next.js production server")
+		}
+		defer func() {
+			if err := server.stop(context.Background()); err != nil {
+				s.Wool.Warn("cannot stop isolated production server", wool.ErrField(err))
+			}
+		}()
+		testEnvs = append(testEnvs,
+			resources.Env("BASE_URL", server.address),
+			resources.Env("PLAYWRIGHT_BASE_URL", server.address),
+		)
+	}
+	if len(invocations) == 1 {
+		response, err := s.runNodeTestInvocation(ctx, req.Suite, runnerKind, manager, testEnvs, invocations[0])
+		if response != nil && selection != nil {
+			appendTestOutput(response, selection.text())
+		}
+		return response, err
+	}
+
+	// Local shards run concurrently and merge into one response that
+	// attributes each failure to its shard.
+	s.Wool.Forwardf("running %d test shards in parallel", len(invocations))
+	started := time.Now()
+	outcomes := make([]shardOutcome, len(invocations))
+	var wg sync.WaitGroup
+	for i, invocation := range invocations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := s.runNodeTestInvocation(ctx, req.Suite, runnerKind, manager, testEnvs, invocation)
+			outcomes[i] = shardOutcome{shard: invocation.shard, response: response, err: err}
+		}()
+	}
+	wg.Wait()
+	response := mergeShardResponses(outcomes, time.Since(started))
+	if selection != nil {
+		appendTestOutput(response, selection.text())
+	}
+	s.Wool.Forwardf("Tests: %s", response.GetResult().GetMessage())
+	return completedTestRPCResult(response, nil)
+}
+
+// nodeTestInvocation is one execution of the test script: the whole run, or
+// one shard of it.
+type nodeTestInvocation struct {
+	shard        testShard
+	shardArgs    []string
+	jsonFile     string
+	args         []string
+	reporterEnvs []*resources.EnvironmentVariable
+	// retries and rerunArgs rerun failed Vitest and Jest cases.
+	retries   int
+	rerunArgs func(jsonFile, namePattern string) []string
+	// coverageDir receives the coverage reports when coverage is collected.
+	coverageDir string
+}
+
+// runNodeTestInvocation runs the test script once, recovering missing
+// Playwright browsers, and returns the typed response parsed from its JSON
+// report.
+func (s *Runtime) runNodeTestInvocation(
+	ctx context.Context,
+	suite string,
+	runnerKind nodeTestRunner,
+	manager *nodePackageManager,
+	testEnvs []*resources.EnvironmentVariable,
+	invocation nodeTestInvocation,
+) (*runtimev0.TestResponse, error) {
+	args, jsonFile := invocation.args, invocation.jsonFile
 	// Reporter output is an agent-owned evidence path. Append it after project
 	// env so a stale user value cannot redirect or discard the current run.
-	testEnvs = append(testEnvs, reporterEnvs...)
+	testEnvs = append(slices.Clone(testEnvs), invocation.reporterEnvs...)
 	started := time.Now()
-	attempt, err := s.runNodeTestAttempt(ctx, args, testEnvs, jsonFile)
+	attempt, err := s.runNodeTestAttempt(ctx, manager, args, testEnvs, jsonFile)
 	if err != nil {
 		return s.Runtime.TestErrorf(err, "starting Node.js test runner")
 	}
@@ -856,13 +1254,17 @@ func (s *Runtime) Test(ctx context.Context, req *runtimev0.TestRequest) (*runtim
 	if runnerKind == nodeTestPlaywright && attempt.runErr != nil {
 		browsers := missingPlaywrightBrowsers(attempt.jsonBytes)
 		if len(browsers) > 0 {
+			// Concurrent shards miss the same browsers; install them once.
+			s.playwrightInstallMu.Lock()
 			s.Wool.Info("recovering missing Playwright browser assets",
 				wool.Field("browsers", browsers))
-			if err := s.installPlaywrightBrowsers(ctx, browsers); err != nil {
+			err := s.installPlaywrightBrowsers(ctx, browsers)
+			s.playwrightInstallMu.Unlock()
+			if err != nil {
 				recoveryErr = err
 				s.Wool.Warn("automatic Playwright browser recovery failed", wool.ErrField(err))
 			} else {
-				attempt, err = s.runNodeTestAttempt(ctx, args, testEnvs, jsonFile)
+				attempt, err = s.runNodeTestAttempt(ctx, manager, args, testEnvs, jsonFile)
 				if err != nil {
 					return s.Runtime.TestErrorf(err, "restarting Node.js test runner after Playwright recovery")
 				}
@@ -878,7 +1280,17 @@ func (s *Runtime) Test(ctx context.Context, req *runtimev0.TestRequest) (*runtim
 	// produces non-zero exit code AND a complete JSON file; the
 	// structured response carries the per-case detail.
 	if len(bytes.TrimSpace(jsonBytes)) == 0 {
-		return s.completedConsoleTestResult(req.Suite, runnerKind, args, consoleOutput, duration, runErr)
+		return s.completedConsoleTestResult(suite, runnerKind, manager, args, consoleOutput, duration, runErr)
+	}
+	var flaky []flakyTest
+	switch runnerKind {
+	case nodeTestPlaywright:
+		flaky = playwrightFlakyTests(jsonBytes)
+	case nodeTestVitest, nodeTestJest:
+		if invocation.retries > 0 && runErr != nil {
+			jsonBytes, flaky = s.retryFailedCases(ctx, manager, testEnvs, invocation, jsonBytes)
+			duration = time.Since(started)
+		}
 	}
 	var run *javascript.StructuredTestRun
 	switch runnerKind {
@@ -893,17 +1305,150 @@ func (s *Runtime) Test(ctx context.Context, req *runtimev0.TestRequest) (*runtim
 		// setup/global failures. The native summary remains authoritative enough
 		// to preserve discovery and failure counts instead of laundering an
 		// executed red suite into a zero-test UNKNOWN response.
-		return s.completedConsoleTestResult(req.Suite, runnerKind, args, consoleOutput, duration, runErr)
+		return s.completedConsoleTestResult(suite, runnerKind, manager, args, consoleOutput, duration, runErr)
 	}
 
 	s.Wool.Forwardf("Tests: %s", run.LegacyTestSummary().SummaryLine())
-	response := run.ToProtoResponse(string(runnerKind), req.Suite, duration)
+	response := run.ToProtoResponse(string(runnerKind), suite, duration)
 	if recoveryErr != nil {
 		response.Output = fmt.Sprintf("automatic Playwright browser recovery failed: %v", recoveryErr)
 	}
+	if len(flaky) > 0 {
+		s.reportFlakes(suite, response, flaky)
+	}
+	if invocation.coverageDir != "" {
+		s.reportCoverage(response, invocation.coverageDir)
+	}
 	return completedTestRPCResult(response, runErr)
 }
 
+// reportCoverage replaces the coverage the runner summarized with the one read
+// from its istanbul reports, writes the typed per-file report next to them and
+// fails the run when it misses a threshold of test.coverage.
+func (s *Runtime) reportCoverage(response *runtimev0.TestResponse, coverageDir string) {
+	report, err := readCoverageReport(coverageDir, s.sourceLocation)
+	if err != nil {
+		s.Wool.Warn("cannot read coverage report", wool.ErrField(err))
+		appendTestOutput(response, fmt.Sprintf("coverage unavailable: %v", err))
+		if s.Settings.Test.Coverage.configured() {
+			// Thresholds that cannot be checked are not met.
+			failTestResponse(response, fmt.Sprintf("coverage thresholds not checked: %v", err))
+		}
+		return
+	}
+	response.CoveragePct = float32(report.Total.Lines.Pct())
+	reportPath := filepath.Join(coverageDir, coverageReportFile)
+	if data, err := json.MarshalIndent(report, "", "  "); err == nil {
+		if err := os.WriteFile(reportPath, data, 0o644); err != nil {
+			s.Wool.Warn("cannot write typed coverage report", wool.ErrField(err))
+			reportPath = ""
+		}
+	}
+	s.Wool.Forwardf("Coverage: %s", report.Total)
+	appendTestOutput(response, report.text(reportPath))
+
+	violations := s.Settings.Test.Coverage.check(report)
+	if len(violations) == 0 {
+		return
+	}
+	for _, violation := range violations {
+		response.Failures = append(response.Failures, violation.String())
+	}
+	message := failTestResponse(response, fmt.Sprintf("%d coverage threshold(s) not met", len(violations)))
+	s.Wool.Forwardf("%s", message)
+}
+
+// failTestResponse fails a run for reason, keeping a worse result the runner
+// already reported, and returns the combined message.
+func failTestResponse(response *runtimev0.TestResponse, reason string) string {
+	message := reason
+	state := runtimev0.TestRunResult_FAILED
+	if result := response.GetResult(); result != nil && result.GetState() != runtimev0.TestRunResult_PASSED {
+		message = result.GetMessage() + "; " + message
+		if testRunStateRank(result.GetState()) > testRunStateRank(state) {
+			state = result.GetState()
+		}
+	}
+	response.Result = &runtimev0.TestRunResult{State: state, Message: message}
+	response.Status = &runtimev0.TestStatus{State: runtimev0.TestStatus_ERROR, Message: message}
+	return message
+}
+
+func appendTestOutput(response *runtimev0.TestResponse, text string) {
+	if response.Output != "" {
+		response.Output += "\n\n"
+	}
+	response.Output += text
+}
+
+// retryFailedCases reruns the failed cases of a Vitest or Jest report up to
+// invocation.retries times and returns the report with the cases that passed
+// on a retry marked as such. A retry that produces no report ends retrying;
+// the first run's evidence is never lost.
+func (s *Runtime) retryFailedCases(
+	ctx context.Context,
+	manager *nodePackageManager,
+	testEnvs []*resources.EnvironmentVariable,
+	invocation nodeTestInvocation,
+	report []byte,
+) ([]byte, []flakyTest) {
+	var flaky []flakyTest
+	for attempt := 1; attempt <= invocation.retries; attempt++ {
+		failed, err := failedJestCases(report)
+		if err != nil || len(failed) == 0 {
+			break
+		}
+		s.Wool.Forwardf("retrying %d failed test(s), attempt %d of %d", len(failed), attempt, invocation.retries)
+		jsonFile := strings.TrimSuffix(invocation.jsonFile, ".json") + fmt.Sprintf("-retry-%d.json", attempt)
+		rerun, err := s.runNodeTestAttempt(ctx, manager, invocation.rerunArgs(jsonFile, retryNamePattern(failed)), testEnvs, jsonFile)
+		_ = os.Remove(jsonFile)
+		if err != nil || len(bytes.TrimSpace(rerun.jsonBytes)) == 0 {
+			s.Wool.Warn("retry produced no test report", wool.ErrField(errors.Join(err, rerun.runErr)))
+			break
+		}
+		merged, recovered, err := applyJestRetry(report, rerun.jsonBytes, attempt)
+		if err != nil {
+			s.Wool.Warn("cannot merge retried tests", wool.ErrField(err))
+			break
+		}
+		report = merged
+		flaky = append(flaky, recovered...)
+	}
+	return report, flaky
+}
+
+// reportFlakes records flaky tests in the flake history and reports them,
+// with repeat offenders, in the response.
+func (s *Runtime) reportFlakes(suite string, response *runtimev0.TestResponse, flaky []flakyTest) {
+	for i := range flaky {
+		if relative, err := filepath.Rel(s.sourceLocation, flaky[i].File); err == nil && filepath.IsAbs(flaky[i].File) {
+			flaky[i].File = relative
+		}
+	}
+	s.flakeHistoryMu.Lock()
+	records, err := recordFlakes(filepath.Join(s.sourceLocation, flakeHistoryFile), suite, flaky, time.Now())
+	s.flakeHistoryMu.Unlock()
+	if err != nil {
+		s.Wool.Warn("cannot update flake history", wool.ErrField(err))
+	}
+	report := flakeReport(flaky, records)
+	s.Wool.Forwardf("%s", report)
+	appendTestOutput(response, report)
+	noteFlakyTests(response, len(flaky))
+}
+
+// noteFlakyTests adds the flaky count to the status and result messages; the
+// counts contract has no field for it.
+func noteFlakyTests(response *runtimev0.TestResponse, count int) {
+	note := fmt.Sprintf("%d flaky", count)
+	if response.Status != nil {
+		response.Status.Message = strings.TrimSpace(response.Status.Message + " (" + note + ")")
+	}
+	if response.Result != nil {
+		response.Result.Message = strings.TrimSpace(response.Result.Message + " (" + note + ")")
+	}
+}
+
 // completedConsoleTestResult preserves the typed TestResponse contract when a
 // package-owned runner cannot provide per-case JSON. Aggregates are still real
 // execution evidence: callers must receive Counts and Result, not the legacy
@@ -911,6 +1456,7 @@ func (s *Runtime) Test(ctx context.Context, req *runtimev0.TestRequest) (*runtim
 func (s *Runtime) completedConsoleTestResult(
 	suite string,
 	runnerKind nodeTestRunner,
+	manager *nodePackageManager,
 	args []string,
 	consoleOutput string,
 	duration time.Duration,
@@ -936,7 +1482,7 @@ func (s *Runtime) completedConsoleTestResult(
 	if state != runtimev0.TestRunResult_PASSED {
 		statusState = runtimev0.TestStatus_ERROR
 	}
-	diagnostics := llmout.Compress("npm", args, consoleOutput)
+	diagnostics := llmout.Compress(string(manager.Kind), args, consoleOutput)
 	failures := []string(nil)
 	if state != runtimev0.TestRunResult_PASSED && strings.TrimSpace(diagnostics) != "" {
 		failures = append(failures, diagnostics)
@@ -979,6 +1525,7 @@ type nodeTestAttempt struct {
 // the exact same typed request, environment, and reporter contract.
 func (s *Runtime) runNodeTestAttempt(
 	ctx context.Context,
+	manager *nodePackageManager,
 	args []string,
 	envs []*resources.EnvironmentVariable,
 	jsonFile string,
@@ -986,7 +1533,8 @@ func (s *Runtime) runNodeTestAttempt(
 	if err := os.Remove(jsonFile); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return nodeTestAttempt{}, fmt.Errorf("clear previous test report: %w", err)
 	}
-	testProc, err := s.runnerEnvironment.NewProcess("npm", args...)
+	command, commandArgs := manager.command(args...)
+	testProc, err := s.runnerEnvironment.NewProcess(command, commandArgs...)
 	if err != nil {
 		return nodeTestAttempt{}, fmt.Errorf("create test process: %w", err)
 	}
@@ -1024,6 +1572,78 @@ func nodeTestReporterConfiguration(runner nodeTestRunner, jsonFile string) ([]st
 	}
 }
 
+// testA11y runs the accessibility suite: an axe-core audit of the running
+// frontend, one test per route. A route fails on a violation at or above
+// a11y.fail-on, and its Failures entry lists each one with its selector.
+// The suite's target, when set, is the single route to audit.
+func (s *Runtime) testA11y(ctx context.Context, req *runtimev0.TestRequest) (*runtimev0.TestResponse, error) {
+	if !s.server.running() {
+		return s.Runtime.TestErrorf(fmt.Errorf("frontend is not running"), "the a11y suite audits the running frontend")
+	}
+	var requested []string
+	if req.Target != "" {
+		requested = []string{req.Target}
+	}
+	started := time.Now()
+	report, err := s.runA11yAudit(ctx, requested)
+	if err != nil {
+		return s.Runtime.TestErrorf(err, "running accessibility audit")
+	}
+	return browserAuditTestResponse("axe-core", "a11y", len(report.Routes), report.evidence(), report.summary(), report.text(), time.Since(started)), nil
+}
+
+// testVisual runs the visual regression suite: one test per route and
+// viewport, compared against .codefly/visual-baselines. Passing --update in
+// the extra arguments accepts the new screenshots as baselines instead.
+func (s *Runtime) testVisual(ctx context.Context, req *runtimev0.TestRequest) (*runtimev0.TestResponse, error) {
+	if !s.server.running() {
+		return s.Runtime.TestErrorf(fmt.Errorf("frontend is not running"), "the visual suite screenshots the running frontend")
+	}
+	var requested []string
+	if req.Target != "" {
+		requested = []string{req.Target}
+	}
+	started := time.Now()
+	report, err := s.runVisual(ctx, requested, slices.Contains(req.ExtraArgs, "--update"))
+	if err != nil {
+		return s.Runtime.TestErrorf(err, "running visual regression suite")
+	}
+	return browserAuditTestResponse("playwright-screenshot", "visual", len(report.Results), report.evidence(), report.summary(), report.text(), time.Since(started)), nil
+}
+
+// browserAuditTestResponse reports an agent-run browser suite with one test
+// per audited check; each failure entry is that check's evidence. message is
+// the suite's own summary of the run.
+func browserAuditTestResponse(runner, suite string, checks int, failures []string, message, output string, duration time.Duration) *runtimev0.TestResponse {
+	total := int32(checks)
+	failed := int32(len(failures))
+	state := runtimev0.TestRunResult_PASSED
+	statusState := runtimev0.TestStatus_SUCCESS
+	if failed > 0 {
+		state = runtimev0.TestRunResult_FAILED
+		statusState = runtimev0.TestStatus_ERROR
+	}
+	return &runtimev0.TestResponse{
+		Status: &runtimev0.TestStatus{State: statusState, Message: message},
+		Run: &runtimev0.TestRun{
+			Runner:    runner,
+			SuiteName: suite,
+			Duration:  durationpb.New(duration),
+		},
+		Result: &runtimev0.TestRunResult{State: state, Message: message},
+		Counts: &runtimev0.TestCounts{
+			Total:  total,
+			Passed: total - failed,
+			Failed: failed,
+		},
+		Output:      output,
+		TestsRun:    total,
+		TestsPassed: total - failed,
+		TestsFailed: failed,
+		Failures:    failures,
+	}
+}
+
 func completedTestRPCResult(
 	response *runtimev0.TestResponse,
 	executionErr error,
@@ -1036,20 +1656,27 @@ func completedTestRPCResult(
 
 // Lint owns the JavaScript/TypeScript static-lint phase for every service made
 // from this generic Next.js agent. CI only dispatches this RPC; it never needs
-// to know that the current implementation uses an npm script.
+// to know that the current implementation uses a package script.
 func (s *Runtime) Lint(ctx context.Context, req *runtimev0.LintRequest) (*runtimev0.LintResponse, error) {
 	defer s.Wool.Catch()
 	ctx = s.Wool.Inject(ctx)
 	if req == nil {
 		req = &runtimev0.LintRequest{}
 	}
-	args := []string{"run", "lint"}
+	// Install first: a stale lockfile may change the package manager.
+	if err := s.ensureNodeDependencies(ctx); err != nil {
+		return s.Runtime.LintErrorf(err, "preparing Node.js dependencies")
+	}
+	manager, err := s.resolvePackageManager()
+	if err != nil {
+		return s.Runtime.LintErrorf(err, "resolving Node.js package manager")
+	}
+	args := manager.runScriptArgs("lint")
 	if req.Target != "" {
-		args = append(args, "--")
-		args = append(args, req.Target)
+		args = manager.runScriptArgs("lint", req.Target)
 	}
-	output, err := s.runNPM(ctx, args...)
-	compressed := llmout.Compress("npm", args, output)
+	output, err := s.runPackageManager(ctx, manager, args...)
+	compressed := llmout.Compress(string(manager.Kind), args, output)
 	if err != nil {
 		return s.Runtime.LintErrorf(err, "lint failed:\n%s", compressed)
 	}
@@ -1062,7 +1689,7 @@ func (s *Runtime) Build(ctx context.Context, _ *runtimev0.BuildRequest) (*runtim
 	defer s.Wool.Catch()
 	ctx = s.Wool.Inject(ctx)
 
-	manifest := s.packageManifest
+	manifest := s.cachedPackageManifest()
 	if manifest == nil {
 		var err error
 		manifest, err = readNodePackageManifest(s.sourceLocation)
@@ -1078,14 +1705,50 @@ func (s *Runtime) Build(ctx context.Context, _ *runtimev0.BuildRequest) (*runtim
 		)
 	}
 
+	budgeted := !s.Settings.BundleBudgets.empty()
+	if budgeted && !slices.Contains(scripts, "build") {
+		return s.Runtime.BuildErrorf(
+			fmt.Errorf("bundle-budgets are configured but package.json declares no build script"),
+			"checking bundle budgets",
+		)
+	}
+
+	// Install first: a stale lockfile may change the package manager.
+	if err := s.ensureNodeDependencies(ctx); err != nil {
+		return s.Runtime.BuildErrorf(err, "preparing Node.js dependencies")
+	}
+	manager, err := s.resolvePackageManager()
+	if err != nil {
+		return s.Runtime.BuildErrorf(err, "resolving Node.js package manager")
+	}
+
 	var outputs []string
 	for _, script := range scripts {
-		args := []string{"run", script}
-		output, err := s.runNPM(ctx, args...)
-		compressed := llmout.Compress("npm", args, output)
+		args := manager.runScriptArgs(script)
+		output, err := s.runPackageManager(ctx, manager, args...)
+		compressed := llmout.Compress(string(manager.Kind), args, output)
 		outputs = append(outputs, compressed)
 		if err != nil {
-			return s.Runtime.BuildErrorf(err, "native build failed during npm %s:\n%s", strings.Join(args, " "), compressed)
+			return s.Runtime.BuildErrorf(err, "native build failed during %s:\n%s", manager.describe(args...), compressed)
+		}
+		if script != "build" {
+			continue
+		}
+		// The build leaves its route table behind; report it so callers see
+		// what was prerendered and what each route ships to the browser.
+		built, err := readNextBuildManifest(s.sourceLocation)
+		if err != nil {
+			if budgeted {
+				return s.Runtime.BuildErrorf(err, "reading Next.js build manifests for bundle budgets")
+			}
+			s.Wool.Warn("cannot read Next.js build manifests", wool.ErrField(err))
+			continue
+		}
+		outputs = append(outputs, built.text())
+		if budgeted {
+			if err := s.Settings.BundleBudgets.check(built); err != nil {
+				return s.Runtime.BuildErrorf(err, "bundle budgets exceeded:\n%s", built.text())
+			}
 		}
 	}
 	return s.Runtime.BuildResponse(strings.Join(outputs, "\n"))
@@ -1097,40 +1760,135 @@ func (s *Runtime) ensureNodeDependencies(ctx context.Context) error {
 	if s.runnerEnvironment == nil {
 		return fmt.Errorf("runner environment is not initialized")
 	}
-	if s.nodeDependenciesPresent(ctx) {
+	if !s.nodeDependenciesPresent(ctx) {
+		return s.installNodeDependencies(ctx)
+	}
+	stale, err := s.staleNodeDependencies()
+	if err != nil {
+		return err
+	}
+	if stale == "" {
 		return nil
 	}
-	args := []string{"install"}
-	if _, err := os.Stat(filepath.Join(s.sourceLocation, "package-lock.json")); err == nil {
-		args = []string{"ci"}
+	s.Wool.Forwardf("Node.js dependencies are stale (%s): reinstalling", stale)
+	if err := s.refreshPackageManifest(); err != nil {
+		return err
+	}
+	return s.installNodeDependencies(ctx)
+}
+
+// reinstallNodeDependencies installs again after the lockfile changed, which
+// may also have changed the package manager.
+func (s *Runtime) reinstallNodeDependencies(ctx context.Context) error {
+	s.dependenciesMu.Lock()
+	defer s.dependenciesMu.Unlock()
+	if s.runnerEnvironment == nil {
+		return fmt.Errorf("runner environment is not initialized")
+	}
+	if err := s.refreshPackageManifest(); err != nil {
+		return err
+	}
+	return s.installNodeDependencies(ctx)
+}
+
+// refreshPackageManifest rereads package.json and drops the resolved manager,
+// since a changed lockfile may have changed it.
+func (s *Runtime) refreshPackageManifest() error {
+	manifest, err := readNodePackageManifest(s.sourceLocation)
+	if err != nil {
+		return err
+	}
+	s.packageMu.Lock()
+	s.packageManifest, s.packageManager = manifest, nil
+	s.packageMu.Unlock()
+	return nil
+}
+
+// cachedPackageManifest returns the package.json read at Load or by the last
+// dependency refresh, or nil when neither has run.
+func (s *Runtime) cachedPackageManifest() *nodePackageManifest {
+	s.packageMu.RLock()
+	defer s.packageMu.RUnlock()
+	return s.packageManifest
+}
+
+// installNodeDependencies runs the frozen install; the caller holds
+// dependenciesMu.
+func (s *Runtime) installNodeDependencies(ctx context.Context) error {
+	manager, err := s.resolvePackageManager()
+	if err != nil {
+		return err
+	}
+	args := manager.installArgs()
+	if s.Settings.Offline.Enabled {
+		if args, err = s.offlineInstallArgs(manager, args); err != nil {
+			return err
+		}
 	}
-	s.Wool.Info("installing Node.js dependencies", wool.Field("command", "npm "+strings.Join(args, " ")))
-	proc, err := s.runnerEnvironment.NewProcess("npm", args...)
+	registryEnvs, err := s.registryEnvironment(manager)
 	if err != nil {
-		return fmt.Errorf("create npm dependency process: %w", err)
+		return err
+	}
+	s.Wool.Info("installing Node.js dependencies", wool.Field("command", manager.describe(args...)))
+	command, commandArgs := manager.command(args...)
+	proc, err := s.runnerEnvironment.NewProcess(command, commandArgs...)
+	if err != nil {
+		return fmt.Errorf("create %s dependency process: %w", manager.Kind, err)
 	}
 	proc.WithOutput(s.Logger)
+	proc.WithEnvironmentVariables(ctx, registryEnvs...)
 	if err := proc.Run(ctx); err != nil {
-		return fmt.Errorf("npm %s failed: %w", strings.Join(args, " "), err)
+		return fmt.Errorf("%s failed: %w", manager.describe(args...), err)
 	}
+	s.recordNodeDependencies()
 	return nil
 }
 
+// resolvePackageManager returns the manager resolved at Load, detecting it on
+// demand for runtimes driven without a Load.
+func (s *Runtime) resolvePackageManager() (*nodePackageManager, error) {
+	s.packageMu.RLock()
+	manager := s.packageManager
+	s.packageMu.RUnlock()
+	if manager != nil {
+		return manager, nil
+	}
+	s.packageMu.Lock()
+	defer s.packageMu.Unlock()
+	if s.packageManager != nil {
+		return s.packageManager, nil
+	}
+	manager, err := detectNodePackageManager(s.sourceLocation, s.Settings.PackageManager, s.packageManifest)
+	if err != nil {
+		return nil, err
+	}
+	s.packageManager = manager
+	return manager, nil
+}
+
 // installPlaywrightBrowsers materializes only the engines proved missing by a
 // structured Playwright report. Browser binaries are intentionally recovered
 // from Test rather than eagerly downloading every engine during Runtime.Init.
 func (s *Runtime) installPlaywrightBrowsers(ctx context.Context, browsers []string) error {
-	args := append([]string{"exec", "--offline", "--", "playwright", "install"}, browsers...)
+	if s.Settings.Offline.Enabled {
+		return fmt.Errorf("Playwright browsers %s are missing and cannot be downloaded in offline mode", strings.Join(browsers, ", "))
+	}
+	manager, err := s.resolvePackageManager()
+	if err != nil {
+		return err
+	}
+	args := manager.execArgs("playwright", append([]string{"install"}, browsers...)...)
 	s.Wool.Info("materializing Playwright browser assets",
 		wool.Field("browsers", browsers),
-		wool.Field("command", "npm "+strings.Join(args, " ")))
-	proc, err := s.runnerEnvironment.NewProcess("npm", args...)
+		wool.Field("command", manager.describe(args...)))
+	command, commandArgs := manager.command(args...)
+	proc, err := s.runnerEnvironment.NewProcess(command, commandArgs...)
 	if err != nil {
 		return fmt.Errorf("create Playwright browser install process: %w", err)
 	}
 	proc.WithOutput(s.Logger)
 	if err := proc.Run(ctx); err != nil {
-		return fmt.Errorf("npm %s failed: %w", strings.Join(args, " "), err)
+		return fmt.Errorf("%s failed: %w", manager.describe(args...), err)
 	}
 	return nil
 }
@@ -1200,40 +1958,70 @@ func nodeDependencyCacheKey(sourceLocation, executionPlatform string) (string, e
 	if strings.TrimSpace(executionPlatform) == "" {
 		return "", fmt.Errorf("Node dependency execution platform is required")
 	}
-	hash := sha256.New()
-	_, _ = hash.Write([]byte(executionPlatform))
-	_, _ = hash.Write([]byte{0})
-	found := false
-	for _, name := range []string{"package.json", "npm-shrinkwrap.json", "package-lock.json"} {
+	manifests, err := readNodeDependencyManifests(sourceLocation)
+	if err != nil {
+		return "", err
+	}
+	return nodeDependencyFingerprint(manifests, executionPlatform), nil
+}
+
+// nodeDependencyManifest is one present file that shapes node_modules.
+type nodeDependencyManifest struct {
+	name    string
+	content []byte
+}
+
+// readNodeDependencyManifests reads package.json, every lockfile and the
+// other dependency inputs present in sourceLocation, in a stable order.
+func readNodeDependencyManifests(sourceLocation string) ([]nodeDependencyManifest, error) {
+	// Read every lockfile rather than only the detected manager's: switching
+	// managers must never reuse a node_modules tree laid out by another one.
+	names := []string{"package.json"}
+	for _, lockfile := range nodePackageManagerLockfiles {
+		names = append(names, lockfile.name)
+	}
+	names = append(names, nodeDependencyInputs...)
+	var manifests []nodeDependencyManifest
+	for _, name := range names {
 		content, err := os.ReadFile(filepath.Join(sourceLocation, name))
 		if os.IsNotExist(err) {
 			continue
 		}
 		if err != nil {
-			return "", fmt.Errorf("read %s: %w", name, err)
+			return nil, fmt.Errorf("read %s: %w", name, err)
 		}
-		found = true
-		_, _ = hash.Write([]byte(name))
+		manifests = append(manifests, nodeDependencyManifest{name: name, content: content})
+	}
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("package.json or a package manager lockfile is required")
+	}
+	return manifests, nil
+}
+
+func nodeDependencyFingerprint(manifests []nodeDependencyManifest, executionPlatform string) string {
+	hash := sha256.New()
+	_, _ = hash.Write([]byte(executionPlatform))
+	_, _ = hash.Write([]byte{0})
+	for _, manifest := range manifests {
+		_, _ = hash.Write([]byte(manifest.name))
 		_, _ = hash.Write([]byte{0})
-		_, _ = hash.Write(content)
+		_, _ = hash.Write(manifest.content)
 		_, _ = hash.Write([]byte{0})
 	}
-	if !found {
-		return "", fmt.Errorf("package.json or npm lockfile is required")
-	}
-	return fmt.Sprintf("node-modules-%x", hash.Sum(nil)[:12]), nil
+	return fmt.Sprintf("node-modules-%x", hash.Sum(nil)[:12])
 }
 
-func (s *Runtime) runNPM(ctx context.Context, args ...string) (string, error) {
+func (s *Runtime) runPackageManager(ctx context.Context, manager *nodePackageManager, args ...string) (string, error) {
 	if s.runnerEnvironment == nil {
 		return "", fmt.Errorf("runner environment is not initialized")
 	}
 	if err := s.ensureNodeDependencies(ctx); err != nil {
 		return "", fmt.Errorf("prepare Node.js dependencies: %w", err)
 	}
-	proc, err := s.runnerEnvironment.NewProcess("npm", args...)
+	command, commandArgs := manager.command(args...)
+	proc, err := s.runnerEnvironment.NewProcess(command, commandArgs...)
 	if err != nil {
-		return "", fmt.Errorf("create npm process: %w", err)
+		return "", fmt.Errorf("create %s process: %w", manager.Kind, err)
 	}
 	var output bytes.Buffer
 	// Return one bounded payload through the RPC. Streaming the same command to
@@ -1367,7 +2155,13 @@ func parsePlaywrightOutput(output string) (run, passed, failed, skipped int32) {
 /* Details */
 
 func (s *Runtime) EventHandler(event code.Change) error {
-	s.Wool.Info("detected change requiring re-start", wool.Field("path", event.Path))
-	s.Runtime.DesiredStart()
+	if s.testWatcher != nil {
+		if file, ok := s.watchedSourcePath(event.Path); ok {
+			s.testWatcher.changed(file)
+		}
+	}
+	if s.Settings.HotReload {
+		s.applyHotReloadChange(event.Path)
+	}
 	return nil
 }
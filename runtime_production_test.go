@@ -11,13 +11,43 @@ import (
 func TestPrepareProductionServerUsesNextStartForStandardBuild(t *testing.T) {
 	source := t.TempDir()
 
-	launch, err := prepareProductionServer(source, 3100)
+	launch, err := prepareProductionServer(source, "", &nodePackageManager{Kind: nodePackageManagerNPM}, 3100)
 	require.NoError(t, err)
 	require.Equal(t, "npm", launch.command)
 	require.Equal(t, []string{"run", "start", "--", "-p", "3100"}, launch.args)
 	require.Empty(t, launch.environment)
 }
 
+func TestPrepareProductionServerStartsThroughTheDetectedPackageManager(t *testing.T) {
+	source := t.TempDir()
+
+	launch, err := prepareProductionServer(source, "", &nodePackageManager{Kind: nodePackageManagerPNPM}, 3100)
+	require.NoError(t, err)
+	require.Equal(t, "corepack", launch.command)
+	require.Equal(t, []string{"pnpm", "run", "start", "-p", "3100"}, launch.args)
+}
+
+func TestPrepareProductionServerLaunchesAProjectOutsideTheWorkingDirectory(t *testing.T) {
+	service := t.TempDir()
+	source := filepath.Join(service, "code")
+	project, err := filepath.Rel(source, productionServerStage(service))
+	require.NoError(t, err)
+
+	launch, err := prepareProductionServer(source, project, &nodePackageManager{Kind: nodePackageManagerPNPM}, 3300)
+	require.NoError(t, err)
+	require.Equal(t, "corepack", launch.command)
+	require.Equal(t, []string{"pnpm", "--dir", project, "run", "start", "-p", "3300"}, launch.args)
+
+	writeProductionTestFile(t, service, ".codefly/production-server/.next/required-server-files.json", `{"config":{"output":"standalone"}}`)
+	writeProductionTestFile(t, service, ".codefly/production-server/.next/standalone/server.js", "server")
+	writeProductionTestFile(t, service, ".codefly/production-server/public/logo.svg", "logo")
+	launch, err = prepareProductionServer(source, project, &nodePackageManager{Kind: nodePackageManagerNPM}, 3300)
+	require.NoError(t, err)
+	require.Equal(t, "node", launch.command)
+	require.Equal(t, []string{"../.codefly/production-server/.next/standalone/server.js"}, launch.args)
+	require.FileExists(t, filepath.Join(service, ".codefly/production-server/.next/standalone/public/logo.svg"))
+}
+
 func TestPrepareProductionServerStagesStandaloneOutput(t *testing.T) {
 	source := t.TempDir()
 	writeProductionTestFile(t, source, ".next/required-server-files.json", `{"config":{"output":"standalone"}}`)
@@ -27,7 +57,7 @@ func TestPrepareProductionServerStagesStandaloneOutput(t *testing.T) {
 	writeProductionTestFile(t, source, ".next/standalone/public/stale.txt", "stale")
 	writeProductionTestFile(t, source, ".next/standalone/.next/static/stale.txt", "stale")
 
-	launch, err := prepareProductionServer(source, 3200)
+	launch, err := prepareProductionServer(source, "", &nodePackageManager{Kind: nodePackageManagerNPM}, 3200)
 	require.NoError(t, err)
 	require.Equal(t, "node", launch.command)
 	require.Equal(t, []string{".next/standalone/server.js"}, launch.args)
@@ -46,7 +76,7 @@ func TestPrepareProductionServerFailsClosedWhenStandaloneServerIsMissing(t *test
 	source := t.TempDir()
 	writeProductionTestFile(t, source, ".next/required-server-files.json", `{"config":{"output":"standalone"}}`)
 
-	_, err := prepareProductionServer(source, 3200)
+	_, err := prepareProductionServer(source, "", &nodePackageManager{Kind: nodePackageManagerNPM}, 3200)
 	require.ErrorContains(t, err, "standalone build is missing server.js")
 }
 
@@ -54,7 +84,7 @@ func TestPrepareProductionServerRejectsMalformedBuildManifest(t *testing.T) {
 	source := t.TempDir()
 	writeProductionTestFile(t, source, ".next/required-server-files.json", "{")
 
-	_, err := prepareProductionServer(source, 3200)
+	_, err := prepareProductionServer(source, "", &nodePackageManager{Kind: nodePackageManagerNPM}, 3200)
 	require.ErrorContains(t, err, "parse Next.js build manifest")
 }
 
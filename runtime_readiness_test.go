@@ -44,30 +44,96 @@ func TestReadinessTimeoutRejectsInvalidOrUnboundedValues(t *testing.T) {
 	}
 }
 
-func TestWaitForHTTPReadyRetriesUntilTheServerResponds(t *testing.T) {
+func readinessResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header:     make(http.Header),
+	}
+}
+
+func TestWaitForHTTPReadyRetriesUntilTheContractPasses(t *testing.T) {
 	var attempts atomic.Int32
+	var probed atomic.Value
 	client := &http.Client{
-		Transport: readinessRoundTripper(func(_ *http.Request) (*http.Response, error) {
-			if attempts.Add(1) < 3 {
+		Transport: readinessRoundTripper(func(request *http.Request) (*http.Response, error) {
+			probed.Store(request.URL.String())
+			switch attempts.Add(1) {
+			case 1, 2:
 				return nil, errors.New("cold compile in progress")
+			case 3:
+				return readinessResponse(http.StatusServiceUnavailable, "warming"), nil
+			default:
+				return readinessResponse(http.StatusOK, `{"status":"ok"}`), nil
 			}
-			return &http.Response{
-				StatusCode: http.StatusServiceUnavailable,
-				Body:       io.NopCloser(strings.NewReader("warming")),
-				Header:     make(http.Header),
-			}, nil
 		}),
 	}
+	contract, err := (&Settings{}).ReadinessContract()
+	require.NoError(t, err)
 
-	err := waitForHTTPReady(
+	err = waitForHTTPReady(
 		context.Background(),
 		client,
 		"http://frontend.test",
+		contract,
 		time.Second,
 		time.Millisecond,
 	)
 	require.NoError(t, err)
-	require.EqualValues(t, 3, attempts.Load())
+	require.EqualValues(t, 4, attempts.Load())
+	require.Equal(t, "http://frontend.test/api/healthz", probed.Load())
+}
+
+func TestWaitForHTTPReadyRejectsServerErrorsAndBodyMismatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		message string
+	}{
+		{"broken SSR", http.StatusInternalServerError, "<html>Internal Server Error</html>", "HTTP 500"},
+		{"missing route", http.StatusNotFound, "not found", "add a GET route handler at src/app/api/healthz/route.ts"},
+		{"degraded body", http.StatusOK, `{"status":"degraded"}`, `does not match {"status":"ok"}`},
+		{"HTML body", http.StatusOK, "<html></html>", "did not return JSON"},
+	}
+	settings := &Settings{Readiness: ReadinessSettings{Body: map[string]any{"status": "ok"}}}
+	contract, err := settings.ReadinessContract()
+	require.NoError(t, err)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &http.Client{
+				Transport: readinessRoundTripper(func(_ *http.Request) (*http.Response, error) {
+					return readinessResponse(test.status, test.body), nil
+				}),
+			}
+			err := waitForHTTPReady(context.Background(), client, "http://frontend.test", contract, 10*time.Millisecond, time.Millisecond)
+			require.ErrorContains(t, err, "not ready after 10ms")
+			require.ErrorContains(t, err, test.message)
+		})
+	}
+}
+
+func TestWaitForHTTPReadyRequiresConsecutiveSuccesses(t *testing.T) {
+	var attempts atomic.Int32
+	client := &http.Client{
+		Transport: readinessRoundTripper(func(_ *http.Request) (*http.Response, error) {
+			// A flapping server resets the streak.
+			if attempts.Add(1) == 2 {
+				return readinessResponse(http.StatusBadGateway, ""), nil
+			}
+			return readinessResponse(http.StatusNoContent, ""), nil
+		}),
+	}
+	contract, err := (&Settings{Readiness: ReadinessSettings{
+		Path:        "/ready",
+		StatusCodes: []int{http.StatusNoContent},
+		Successes:   3,
+	}}).ReadinessContract()
+	require.NoError(t, err)
+
+	err = waitForHTTPReady(context.Background(), client, "http://frontend.test", contract, time.Second, time.Millisecond)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, attempts.Load())
 }
 
 func TestWaitForHTTPReadyHonorsCancellation(t *testing.T) {
@@ -79,7 +145,7 @@ func TestWaitForHTTPReadyHonorsCancellation(t *testing.T) {
 		}),
 	}
 
-	err := waitForHTTPReady(ctx, client, "http://frontend.test", time.Second, time.Millisecond)
+	err := waitForHTTPReady(ctx, client, "http://frontend.test", readinessContract{Path: "/"}, time.Second, time.Millisecond)
 	require.ErrorIs(t, err, context.Canceled)
 }
 
@@ -94,6 +160,7 @@ func TestWaitForHTTPReadyReportsTheLastProbeOnTimeout(t *testing.T) {
 		context.Background(),
 		client,
 		"http://frontend.test",
+		readinessContract{Path: defaultReadinessPath},
 		10*time.Millisecond,
 		time.Millisecond,
 	)
@@ -70,6 +70,7 @@ func TestConsoleFallbackPreservesTypedPlaywrightFailureContract(t *testing.T) {
 	response, err := runtime.completedConsoleTestResult(
 		"e2e",
 		nodeTestPlaywright,
+		&nodePackageManager{Kind: nodePackageManagerNPM},
 		[]string{"run", "test", "--", "--reporter=json"},
 		console,
 		30*time.Second,
@@ -84,3 +85,32 @@ func TestConsoleFallbackPreservesTypedPlaywrightFailureContract(t *testing.T) {
 	require.EqualValues(t, 62, response.GetTestsRun(), "legacy projection must match the typed contract")
 	require.Contains(t, response.GetOutput(), "authenticate")
 }
+
+func TestA11yTestResponseCarriesPerRouteEvidence(t *testing.T) {
+	report, err := newA11yReport(a11yResultMarker+a11yFixtureResult, "serious")
+	require.NoError(t, err)
+
+	response := browserAuditTestResponse("axe-core", "a11y", len(report.Routes), report.evidence(), report.summary(), report.text(), time.Second)
+
+	require.Equal(t, runtimev0.TestRunResult_FAILED, response.GetResult().GetState())
+	require.Equal(t, "a11y", response.GetRun().GetSuiteName())
+	require.Equal(t, "3 route(s) with accessibility issues at or above serious", response.GetResult().GetMessage())
+	require.Equal(t, response.GetResult().GetMessage(), response.GetStatus().GetMessage())
+	require.Equal(t, int32(4), response.GetCounts().GetTotal())
+	require.Equal(t, int32(3), response.GetCounts().GetFailed())
+	require.Equal(t, int32(1), response.GetCounts().GetPassed())
+	require.Len(t, response.GetFailures(), 3)
+	require.Contains(t, response.GetFailures()[0], "[critical] image-alt")
+}
+
+func TestNoteFlakyTestsReportsThemInTheMessages(t *testing.T) {
+	response := browserAuditTestResponse("vitest", "unit", 3, nil, "3 passed", "", time.Second)
+	noteFlakyTests(response, 2)
+	require.Equal(t, "3 passed (2 flaky)", response.GetStatus().GetMessage())
+	require.Equal(t, "3 passed (2 flaky)", response.GetResult().GetMessage())
+	require.Equal(t, runtimev0.TestRunResult_PASSED, response.GetResult().GetState(), "a flaky pass is still a pass")
+
+	bare := &runtimev0.TestResponse{}
+	noteFlakyTests(bare, 1)
+	require.Nil(t, bare.Status)
+}
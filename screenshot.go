@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// screenshotRequest is the typed argument of the `screenshot` command:
+//
+//	screenshot {"url": "/pricing", "path": "shots/pricing.png",
+//	  "viewports": [{"name": "mobile", "width": 390, "height": 844}],
+//	  "browser": "webkit", "color_scheme": "dark", "wait_for": "main h1"}
+type screenshotRequest struct {
+	// URL is the path to load on the running frontend. Default: /.
+	URL string `json:"url"`
+	// Path is the PNG to write, relative to the source directory. With
+	// several viewports each file gets the viewport name as a suffix.
+	// Default: screenshot.png.
+	Path string `json:"path"`
+	// Viewports to capture; default one desktop 1280x720 viewport.
+	Viewports []VisualViewport `json:"viewports,omitempty"`
+	// Device is a Playwright device descriptor name such as "iPhone 13";
+	// it sets the viewport, scale, user agent and touch support.
+	Device string `json:"device,omitempty"`
+	// Browser is the engine: chromium (default), firefox, or webkit.
+	Browser string `json:"browser,omitempty"`
+	// WaitFor is a selector that must be visible before the capture.
+	WaitFor string `json:"wait_for,omitempty"`
+	// ColorScheme emulates prefers-color-scheme: light, dark, or no-preference.
+	ColorScheme string `json:"color_scheme,omitempty"`
+	// Selector crops the capture to the first element it matches.
+	Selector string `json:"selector,omitempty"`
+	// FullPage captures the whole scrollable page. Default: true.
+	FullPage *bool `json:"full_page,omitempty"`
+}
+
+var (
+	screenshotBrowsers     = []string{"chromium", "firefox", "webkit"}
+	screenshotColorSchemes = []string{"light", "dark", "no-preference"}
+)
+
+const screenshotResultMarker = "CODEFLY_SCREENSHOT "
+
+// screenshotShot is one file the capture script writes. Width and Height are
+// zero when a device descriptor sets the viewport.
+type screenshotShot struct {
+	File     string `json:"file"`
+	Viewport string `json:"viewport,omitempty"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+}
+
+// screenshotScriptRequest is the JSON the capture script reads from
+// CODEFLY_SCREENSHOT_REQUEST.
+type screenshotScriptRequest struct {
+	BaseURL     string           `json:"baseURL"`
+	TimeoutMs   int              `json:"timeoutMs"`
+	URL         string           `json:"url"`
+	Browser     string           `json:"browser"`
+	Device      string           `json:"device,omitempty"`
+	WaitFor     string           `json:"waitFor,omitempty"`
+	ColorScheme string           `json:"colorScheme,omitempty"`
+	Selector    string           `json:"selector,omitempty"`
+	FullPage    bool             `json:"fullPage"`
+	Shots       []screenshotShot `json:"shots"`
+}
+
+// screenshotFile is one written screenshot as the command reports it.
+type screenshotFile struct {
+	Path     string `json:"path"`
+	Viewport string `json:"viewport,omitempty"`
+	Device   string `json:"device,omitempty"`
+	Status   int    `json:"status"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+}
+
+// plan validates the request, applies defaults and resolves output files
+// against the source directory.
+func (r screenshotRequest) plan(sourceDir, baseURL string) (screenshotScriptRequest, error) {
+	script := screenshotScriptRequest{
+		BaseURL:     baseURL,
+		TimeoutMs:   browserAuditTimeoutMs,
+		URL:         r.URL,
+		Browser:     r.Browser,
+		Device:      r.Device,
+		WaitFor:     r.WaitFor,
+		ColorScheme: r.ColorScheme,
+		Selector:    r.Selector,
+		FullPage:    r.FullPage == nil || *r.FullPage,
+	}
+	if script.URL == "" {
+		script.URL = "/"
+	}
+	if !strings.HasPrefix(script.URL, "/") || strings.HasPrefix(script.URL, "//") {
+		return screenshotScriptRequest{}, fmt.Errorf("screenshot url %q must be a path on the frontend, starting with /", r.URL)
+	}
+	if script.Browser == "" {
+		script.Browser = "chromium"
+	}
+	if !slices.Contains(screenshotBrowsers, script.Browser) {
+		return screenshotScriptRequest{}, fmt.Errorf("screenshot browser must be one of %s, got %q", strings.Join(screenshotBrowsers, ", "), r.Browser)
+	}
+	if script.ColorScheme != "" && !slices.Contains(screenshotColorSchemes, script.ColorScheme) {
+		return screenshotScriptRequest{}, fmt.Errorf("screenshot color_scheme must be one of %s, got %q", strings.Join(screenshotColorSchemes, ", "), r.ColorScheme)
+	}
+	if r.Device != "" && len(r.Viewports) > 0 {
+		return screenshotScriptRequest{}, fmt.Errorf("screenshot device and viewports are exclusive: the device sets the viewport")
+	}
+
+	path := r.Path
+	if path == "" {
+		path = "screenshot.png"
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(sourceDir, path)
+	}
+	if r.Device != "" {
+		script.Shots = []screenshotShot{{File: path}}
+		return script, nil
+	}
+	viewports := r.Viewports
+	if len(viewports) == 0 {
+		viewports = []VisualViewport{defaultVisualViewport}
+	}
+	extension := filepath.Ext(path)
+	seen := map[string]bool{}
+	for i, viewport := range viewports {
+		if viewport.Name == "" || viewport.Width <= 0 || viewport.Height <= 0 {
+			return screenshotScriptRequest{}, fmt.Errorf("screenshot viewports[%d] needs a name and a positive width and height", i)
+		}
+		if seen[viewport.Name] {
+			return screenshotScriptRequest{}, fmt.Errorf("screenshot viewports[%d]: duplicate name %q", i, viewport.Name)
+		}
+		seen[viewport.Name] = true
+		file := path
+		if len(viewports) > 1 {
+			file = strings.TrimSuffix(path, extension) + "-" + visualUnsafeName.ReplaceAllString(viewport.Name, "_") + extension
+		}
+		script.Shots = append(script.Shots, screenshotShot{File: file, Viewport: viewport.Name, Width: viewport.Width, Height: viewport.Height})
+	}
+	return script, nil
+}
+
+// screenshotFiles reads the dimensions of each file the script wrote.
+func screenshotFiles(request screenshotScriptRequest, output string) ([]screenshotFile, error) {
+	var captured []struct {
+		File   string `json:"file"`
+		Status int    `json:"status"`
+	}
+	if err := parseBrowserResult(output, screenshotResultMarker, &captured); err != nil {
+		return nil, err
+	}
+	status := map[string]int{}
+	for _, capture := range captured {
+		status[capture.File] = capture.Status
+	}
+	files := make([]screenshotFile, 0, len(request.Shots))
+	for _, shot := range request.Shots {
+		data, err := os.ReadFile(shot.File)
+		if err != nil {
+			return nil, fmt.Errorf("screenshot was not written: %w", err)
+		}
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("decode screenshot %s: %w", shot.File, err)
+		}
+		files = append(files, screenshotFile{
+			Path: shot.File, Viewport: shot.Viewport, Device: request.Device,
+			Status: status[shot.File], Width: config.Width, Height: config.Height,
+		})
+	}
+	return files, nil
+}
+
+// screenshotScript captures each shot in its own context of the requested
+// engine, emulating the device or viewport and color scheme. Output
+// directories are created by the agent before the script runs.
+const screenshotScript = `const playwright = require('playwright');
+const request = JSON.parse(process.env.CODEFLY_SCREENSHOT_REQUEST);
+(async () => {
+  const browser = await playwright[request.browser].launch();
+  const results = [];
+  try {
+    for (const shot of request.shots) {
+      const options = { deviceScaleFactor: 1 };
+      if (request.device) {
+        const device = playwright.devices[request.device];
+        if (!device) throw new Error('unknown Playwright device ' + JSON.stringify(request.device));
+        Object.assign(options, device);
+        if (request.browser === 'firefox') delete options.isMobile;
+      } else {
+        options.viewport = { width: shot.width, height: shot.height };
+      }
+      if (request.colorScheme) options.colorScheme = request.colorScheme;
+      const context = await browser.newContext(options);
+      const page = await context.newPage();
+      const response = await page.goto(new URL(request.url, request.baseURL).href, { waitUntil: 'load', timeout: request.timeoutMs });
+      if (request.waitFor) await page.locator(request.waitFor).first().waitFor({ state: 'visible', timeout: request.timeoutMs });
+      if (request.selector) {
+        await page.locator(request.selector).first().screenshot({ path: shot.file, animations: 'disabled', timeout: request.timeoutMs });
+      } else {
+        await page.screenshot({ path: shot.file, fullPage: request.fullPage, animations: 'disabled' });
+      }
+      results.push({ file: shot.file, status: response ? response.status() : 0 });
+      await context.close();
+    }
+  } finally {
+    await browser.close();
+  }
+  console.log('` + screenshotResultMarker + `' + JSON.stringify(results));
+})().catch((error) => {
+  console.error(error);
+  process.exit(1);
+});
+`
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScreenshotArgumentsAcceptTheAdvertisedJSONAndFlags(t *testing.T) {
+	var request screenshotRequest
+	require.NoError(t, decodeCommandArgs([]string{`{"path":`, `"it's here.png",`, `"url": "/a'b", "browser": "webkit", "full_page": false}`}, &request))
+	require.Equal(t, "it's here.png", request.Path)
+	require.Equal(t, "/a'b", request.URL)
+	require.Equal(t, "webkit", request.Browser)
+	require.False(t, *request.FullPage)
+
+	request = screenshotRequest{}
+	require.NoError(t, decodeCommandArgs([]string{"--path", "home.png", "--url", "/about", "--full-page=false"}, &request))
+	require.Equal(t, "home.png", request.Path)
+	require.Equal(t, "/about", request.URL)
+	require.False(t, *request.FullPage)
+
+	request = screenshotRequest{}
+	require.NoError(t, decodeCommandArgs([]string{"--viewports", `[{"name": "mobile", "width": 390, "height": 844}]`}, &request))
+	require.Equal(t, []VisualViewport{{Name: "mobile", Width: 390, Height: 844}}, request.Viewports)
+
+	require.ErrorContains(t, decodeCommandArgs([]string{`{"pth": "typo.png"}`}, &screenshotRequest{}), `unknown field "pth"`)
+	require.ErrorContains(t, decodeCommandArgs([]string{"--path"}, &screenshotRequest{}), "--path needs a value")
+	require.ErrorContains(t, decodeCommandArgs([]string{"--full"}, &screenshotRequest{}), "unknown argument --full")
+}
+
+func TestScreenshotPlanResolvesFilesPerViewport(t *testing.T) {
+	script, err := screenshotRequest{}.plan("/src", "http://localhost:3000")
+	require.NoError(t, err)
+	require.Equal(t, screenshotScriptRequest{
+		BaseURL: "http://localhost:3000", TimeoutMs: browserAuditTimeoutMs, URL: "/", Browser: "chromium", FullPage: true,
+		Shots: []screenshotShot{{File: "/src/screenshot.png", Viewport: "desktop", Width: 1280, Height: 720}},
+	}, script)
+
+	script, err = screenshotRequest{
+		Path:        "shots/pricing.png",
+		URL:         "/pricing",
+		ColorScheme: "dark",
+		Viewports:   []VisualViewport{{Name: "mobile", Width: 390, Height: 844}, {Name: "wide screen", Width: 1920, Height: 1080}},
+	}.plan("/src", "http://localhost:3000")
+	require.NoError(t, err)
+	require.Equal(t, []screenshotShot{
+		{File: "/src/shots/pricing-mobile.png", Viewport: "mobile", Width: 390, Height: 844},
+		{File: "/src/shots/pricing-wide_screen.png", Viewport: "wide screen", Width: 1920, Height: 1080},
+	}, script.Shots)
+	require.Equal(t, "dark", script.ColorScheme)
+
+	script, err = screenshotRequest{Device: "iPhone 13", Path: "/tmp/phone.png", Browser: "webkit"}.plan("/src", "http://localhost:3000")
+	require.NoError(t, err)
+	require.Equal(t, []screenshotShot{{File: "/tmp/phone.png"}}, script.Shots)
+}
+
+func TestScreenshotPlanRejectsInvalidRequests(t *testing.T) {
+	for request, message := range map[*screenshotRequest]string{
+		{URL: "https://example.com"}: "must be a path on the frontend",
+		{URL: "//example.com/x"}:     "must be a path on the frontend",
+		{Browser: "safari"}:          "chromium, firefox, webkit",
+		{ColorScheme: "sepia"}:       "light, dark, no-preference",
+		{Device: "Pixel 7", Viewports: []VisualViewport{{Name: "a", Width: 1, Height: 1}}}:                "exclusive",
+		{Viewports: []VisualViewport{{Name: "a"}}}:                                                        "positive width and height",
+		{Viewports: []VisualViewport{{Name: "a", Width: 1, Height: 1}, {Name: "a", Width: 2, Height: 2}}}: "duplicate name",
+	} {
+		_, err := request.plan("/src", "http://localhost:3000")
+		require.ErrorContains(t, err, message)
+	}
+}
+
+func TestScreenshotFilesReportDimensions(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "home.png")
+	img := image.NewRGBA(image.Rect(0, 0, 12, 34))
+	img.Set(0, 0, color.Black)
+	require.NoError(t, writePNG(file, img))
+
+	request := screenshotScriptRequest{Shots: []screenshotShot{{File: file, Viewport: "desktop", Width: 1280, Height: 720}}}
+	files, err := screenshotFiles(request, screenshotResultMarker+`[{"file": "`+file+`", "status": 200}]`)
+	require.NoError(t, err)
+	require.Equal(t, []screenshotFile{{Path: file, Viewport: "desktop", Status: 200, Width: 12, Height: 34}}, files)
+
+	request.Shots[0].File = filepath.Join(dir, "missing.png")
+	_, err = screenshotFiles(request, screenshotResultMarker+`[]`)
+	require.ErrorContains(t, err, "screenshot was not written")
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	runners "github.com/codefly-dev/core/runners/base"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type serverState string
+
+const (
+	serverHealthy    serverState = "healthy"
+	serverUnhealthy  serverState = "unhealthy"
+	serverRestarting serverState = "restarting"
+	serverCrashLoop  serverState = "crash-loop"
+	serverStopped    serverState = "stopped"
+)
+
+// errServerExited marks a liveness failure: the process is gone, so there is
+// no point waiting for further health probes before restarting it.
+var errServerExited = errors.New("Next.js server process exited")
+
+// supervisorConfig bounds how aggressively a dead or wedged server is
+// restarted.
+type supervisorConfig struct {
+	// Interval between health checks once the server is ready.
+	Interval time.Duration
+	// FailureThreshold is the number of consecutive failed health probes
+	// that trigger a restart. A long development compile can fail one probe
+	// without the server being dead.
+	FailureThreshold int
+	// InitialBackoff doubles with every restart in the window, up to
+	// MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// MaxRestarts within Window is the crash-loop limit; past it the
+	// supervisor gives up and reports the failure instead of restarting.
+	MaxRestarts int
+	Window      time.Duration
+	// TailLines is how many server log lines a crash-loop failure carries.
+	TailLines int
+}
+
+var defaultSupervisorConfig = supervisorConfig{
+	Interval:         5 * time.Second,
+	FailureThreshold: 3,
+	InitialBackoff:   time.Second,
+	MaxBackoff:       30 * time.Second,
+	MaxRestarts:      5,
+	Window:           5 * time.Minute,
+	TailLines:        40,
+}
+
+// runningProcess is implemented by runner processes that can report whether
+// they are still alive. Processes without it are supervised through the
+// health endpoint alone.
+type runningProcess interface {
+	IsRunning(ctx context.Context) (bool, error)
+}
+
+// serverProcess holds the live server process. The supervisor replaces it on
+// every restart while Stop, Destroy and the commands read it, so all access
+// goes through its lock.
+type serverProcess struct {
+	mu   sync.Mutex
+	proc runners.Proc
+	// output parses the process output; it is flushed once the process is
+	// stopped, since nothing more will continue a pending error.
+	output *nextOutputParser
+}
+
+func (p *serverProcess) current() runners.Proc {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.proc
+}
+
+func (p *serverProcess) running() bool {
+	return p.current() != nil
+}
+
+// replace makes proc the live process, before it is started.
+func (p *serverProcess) replace(proc runners.Proc, output *nextOutputParser) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.proc, p.output = proc, output
+}
+
+// stop stops the live process, if any, and forgets it.
+func (p *serverProcess) stop(ctx context.Context) error {
+	p.mu.Lock()
+	proc, output := p.proc, p.output
+	p.proc, p.output = nil, nil
+	p.mu.Unlock()
+	if proc == nil {
+		return nil
+	}
+	err := proc.Stop(ctx)
+	if output != nil {
+		output.flush()
+	}
+	return err
+}
+
+// serverSupervisor watches a started Next.js server. It polls process
+// liveness and the readiness contract, restarts the server with exponential
+// backoff, and stops at the crash-loop limit with the last log lines of the
+// crash in the recorded failure.
+type serverSupervisor struct {
+	config supervisorConfig
+	// probe runs one readiness check against the server.
+	probe func(ctx context.Context) error
+	// alive reports process liveness; nil when the runner cannot tell.
+	alive func(ctx context.Context) (bool, error)
+	// restart stops the current process and starts a replacement, returning
+	// once the replacement is ready.
+	restart func(ctx context.Context) error
+	tail    *logTail
+	// transition observes every state change.
+	transition func(from, to serverState, cause error)
+
+	mu          sync.Mutex
+	state       serverState
+	restarts    []time.Time
+	total       int
+	lastFailure error
+	since       time.Time
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// supervisorStatus is a point-in-time view for Information and `health`.
+type supervisorStatus struct {
+	State       serverState
+	Since       time.Time
+	Restarts    int
+	LastFailure string
+}
+
+func (v *serverSupervisor) start(ctx context.Context) {
+	ctx, v.cancel = context.WithCancel(ctx)
+	v.done = make(chan struct{})
+	v.mu.Lock()
+	v.state, v.since = serverHealthy, time.Now()
+	v.mu.Unlock()
+	go func() {
+		defer close(v.done)
+		v.run(ctx)
+	}()
+}
+
+// stop cancels supervision and waits for an in-flight restart to unwind, so
+// the caller owns the runner again once it returns.
+func (v *serverSupervisor) stop() {
+	if v == nil || v.cancel == nil {
+		return
+	}
+	v.cancel()
+	<-v.done
+	v.setState(serverStopped, nil)
+}
+
+func (v *serverSupervisor) status() supervisorStatus {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	status := supervisorStatus{State: v.state, Since: v.since, Restarts: v.total}
+	if v.lastFailure != nil {
+		status.LastFailure = v.lastFailure.Error()
+	}
+	return status
+}
+
+func (v *serverSupervisor) run(ctx context.Context) {
+	ticker := time.NewTicker(v.config.Interval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := v.check(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			failures = 0
+			v.setState(serverHealthy, nil)
+			continue
+		}
+		failures++
+		if !errors.Is(err, errServerExited) && failures < v.config.FailureThreshold {
+			v.setState(serverUnhealthy, err)
+			continue
+		}
+		if !v.recover(ctx, err) {
+			return
+		}
+		failures = 0
+		ticker.Reset(v.config.Interval)
+	}
+}
+
+func (v *serverSupervisor) check(ctx context.Context) error {
+	if v.alive != nil {
+		running, err := v.alive(ctx)
+		if err == nil && !running {
+			return errServerExited
+		}
+	}
+	return v.probe(ctx)
+}
+
+// recover restarts the server until a replacement becomes ready. It returns
+// false when supervision ends, either canceled or at the crash-loop limit.
+func (v *serverSupervisor) recover(ctx context.Context, cause error) bool {
+	for {
+		now := time.Now()
+		v.mu.Lock()
+		recent := v.restarts[:0]
+		for _, at := range v.restarts {
+			if now.Sub(at) < v.config.Window {
+				recent = append(recent, at)
+			}
+		}
+		v.restarts = recent
+		attempts := len(recent)
+		v.mu.Unlock()
+
+		if attempts >= v.config.MaxRestarts {
+			v.setState(serverCrashLoop, v.crashLoopError(attempts, cause))
+			return false
+		}
+		v.setState(serverRestarting, cause)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(v.backoff(attempts)):
+		}
+
+		v.mu.Lock()
+		v.restarts = append(v.restarts, time.Now())
+		v.total++
+		v.mu.Unlock()
+
+		err := v.restart(ctx)
+		if ctx.Err() != nil {
+			return false
+		}
+		if err == nil {
+			v.setState(serverHealthy, nil)
+			return true
+		}
+		cause = err
+	}
+}
+
+func (v *serverSupervisor) backoff(attempts int) time.Duration {
+	backoff := v.config.InitialBackoff
+	for i := 0; i < attempts && backoff < v.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, v.config.MaxBackoff)
+}
+
+func (v *serverSupervisor) crashLoopError(attempts int, cause error) error {
+	message := fmt.Sprintf(
+		"Next.js server is crash-looping: %d restarts within %s, giving up (last failure: %v)",
+		attempts,
+		v.config.Window,
+		cause,
+	)
+	if v.tail != nil {
+		if lines := v.tail.lines(); len(lines) > 0 {
+			message += fmt.Sprintf("\nlast %d log lines:\n%s", len(lines), strings.Join(lines, "\n"))
+		}
+	}
+	return errors.New(message)
+}
+
+func (v *serverSupervisor) setState(state serverState, cause error) {
+	v.mu.Lock()
+	previous := v.state
+	changed := previous != state
+	if changed {
+		v.state, v.since = state, time.Now()
+	}
+	if cause != nil {
+		v.lastFailure = cause
+	}
+	v.mu.Unlock()
+	if changed && v.transition != nil {
+		v.transition(previous, state, cause)
+	}
+}
+
+// logTail keeps the last lines written to it. It sits beside the service
+// logger on the server's output so a crash report can quote the crash.
+type logTail struct {
+	mu      sync.Mutex
+	limit   int
+	buffer  []string
+	partial string
+}
+
+func newLogTail(limit int) *logTail {
+	return &logTail{limit: limit}
+}
+
+func (t *logTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	text := t.partial + string(p)
+	lines := strings.Split(text, "\n")
+	t.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		t.buffer = append(t.buffer, strings.TrimRight(line, "\r"))
+	}
+	if overflow := len(t.buffer) - t.limit; overflow > 0 {
+		t.buffer = append(t.buffer[:0], t.buffer[overflow:]...)
+	}
+	return len(p), nil
+}
+
+func (t *logTail) lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines := append([]string(nil), t.buffer...)
+	if t.partial != "" {
+		lines = append(lines, t.partial)
+		if len(lines) > t.limit {
+			lines = lines[1:]
+		}
+	}
+	return lines
+}
+
+// String renders the status for the `health` command.
+func (s supervisorStatus) String() string {
+	text := fmt.Sprintf("supervisor: %s since %s, %d restarts", s.State, s.Since.UTC().Format(time.RFC3339), s.Restarts)
+	if s.LastFailure != "" {
+		text += ", last failure: " + s.LastFailure
+	}
+	return text
+}
+
+// annotations render the status for the Information RPC.
+func (s supervisorStatus) annotations() map[string]string {
+	annotations := map[string]string{
+		"server.state":    string(s.State),
+		"server.since":    s.Since.UTC().Format(time.RFC3339),
+		"server.restarts": fmt.Sprintf("%d", s.Restarts),
+	}
+	if s.LastFailure != "" {
+		annotations["server.last-failure"] = s.LastFailure
+	}
+	return annotations
+}
+
+// informationAnnotationsField is the map<string, string> field of the
+// Information response that carries agent annotations.
+const informationAnnotationsField protoreflect.Name = "annotations"
+
+// annotateInformation adds annotations to the annotations field of an
+// Information response. A contract without that exact field is an error, so
+// the supervisor state is never dropped without a trace.
+func annotateInformation(response proto.Message, annotations map[string]string) error {
+	message := response.ProtoReflect()
+	field := message.Descriptor().Fields().ByName(informationAnnotationsField)
+	if field == nil || !field.IsMap() ||
+		field.MapKey().Kind() != protoreflect.StringKind ||
+		field.MapValue().Kind() != protoreflect.StringKind {
+		return fmt.Errorf("%s has no map<string, string> %s field", message.Descriptor().FullName(), informationAnnotationsField)
+	}
+	values := message.Mutable(field).Map()
+	for key, value := range annotations {
+		values.Set(protoreflect.ValueOfString(key).MapKey(), protoreflect.ValueOfString(value))
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	runtimev0 "github.com/codefly-dev/core/generated/go/codefly/services/runtime/v0"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func testSupervisorConfig() supervisorConfig {
+	return supervisorConfig{
+		Interval:         time.Millisecond,
+		FailureThreshold: 3,
+		InitialBackoff:   time.Millisecond,
+		MaxBackoff:       4 * time.Millisecond,
+		MaxRestarts:      3,
+		Window:           time.Minute,
+		TailLines:        3,
+	}
+}
+
+type recordedTransitions struct {
+	mu     sync.Mutex
+	states []serverState
+}
+
+func (r *recordedTransitions) record(_, to serverState, _ error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states = append(r.states, to)
+}
+
+func (r *recordedTransitions) contains(state serverState) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, recorded := range r.states {
+		if recorded == state {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSupervisorRestartsAnExitedProcessImmediately(t *testing.T) {
+	var running atomic.Bool
+	var restarts atomic.Int32
+	transitions := &recordedTransitions{}
+	supervisor := &serverSupervisor{
+		config: testSupervisorConfig(),
+		probe:  func(context.Context) error { return nil },
+		alive: func(context.Context) (bool, error) {
+			return running.Load(), nil
+		},
+		restart: func(context.Context) error {
+			restarts.Add(1)
+			running.Store(true)
+			return nil
+		},
+		transition: transitions.record,
+	}
+	supervisor.start(context.Background())
+	defer supervisor.stop()
+
+	require.Eventually(t, func() bool { return restarts.Load() == 1 }, time.Second, time.Millisecond)
+	require.Eventually(t, func() bool { return supervisor.status().State == serverHealthy }, time.Second, time.Millisecond)
+	require.True(t, transitions.contains(serverRestarting))
+	require.Equal(t, 1, supervisor.status().Restarts)
+	require.Contains(t, supervisor.status().LastFailure, "process exited")
+}
+
+func TestSupervisorToleratesProbeFailuresBelowTheThreshold(t *testing.T) {
+	var probes atomic.Int32
+	var restarts atomic.Int32
+	supervisor := &serverSupervisor{
+		config: testSupervisorConfig(),
+		probe: func(context.Context) error {
+			// Every other probe fails: never three in a row.
+			if probes.Add(1)%2 == 0 {
+				return errors.New("compiling /api/healthz")
+			}
+			return nil
+		},
+		restart: func(context.Context) error {
+			restarts.Add(1)
+			return nil
+		},
+	}
+	supervisor.start(context.Background())
+	require.Eventually(t, func() bool { return probes.Load() > 20 }, time.Second, time.Millisecond)
+	supervisor.stop()
+
+	require.Zero(t, restarts.Load())
+	require.Equal(t, serverStopped, supervisor.status().State)
+}
+
+func TestSupervisorStopsAtTheCrashLoopLimitWithTheLogTail(t *testing.T) {
+	tail := newLogTail(3)
+	var restarts atomic.Int32
+	supervisor := &serverSupervisor{
+		config: testSupervisorConfig(),
+		tail:   tail,
+		probe:  func(context.Context) error { return errors.New("connection refused") },
+		restart: func(context.Context) error {
+			attempt := restarts.Add(1)
+			fmt.Fprintf(tail, "ready in %dms\n", attempt)
+			fmt.Fprintf(tail, "FATAL ERROR: Reached heap limit Allocation failed (attempt %d)\n", attempt)
+			return fmt.Errorf("not ready after 30s (attempt %d)", attempt)
+		},
+	}
+	supervisor.start(context.Background())
+	defer supervisor.stop()
+
+	require.Eventually(t, func() bool { return supervisor.status().State == serverCrashLoop }, time.Second, time.Millisecond)
+	status := supervisor.status()
+	require.EqualValues(t, 3, restarts.Load())
+	require.Equal(t, 3, status.Restarts)
+	require.Contains(t, status.LastFailure, "crash-looping: 3 restarts within 1m0s")
+	require.Contains(t, status.LastFailure, "not ready after 30s (attempt 3)")
+	require.Contains(t, status.LastFailure, "last 3 log lines:\nFATAL ERROR: Reached heap limit Allocation failed (attempt 2)\nready in 3ms\nFATAL ERROR")
+	require.NotContains(t, status.LastFailure, "ready in 2ms")
+}
+
+func TestSupervisorBackoffDoublesUpToTheCap(t *testing.T) {
+	supervisor := &serverSupervisor{config: supervisorConfig{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}}
+	var backoffs []time.Duration
+	for attempts := range 5 {
+		backoffs = append(backoffs, supervisor.backoff(attempts))
+	}
+	require.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, backoffs)
+}
+
+func TestLogTailKeepsTheLastLinesAcrossPartialWrites(t *testing.T) {
+	tail := newLogTail(2)
+	_, _ = tail.Write([]byte("first\nsec"))
+	_, _ = tail.Write([]byte("ond\r\nthird\npartial"))
+	require.Equal(t, []string{"third", "partial"}, tail.lines())
+}
+
+func TestSupervisorStatusString(t *testing.T) {
+	since := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	status := supervisorStatus{State: serverHealthy, Since: since, Restarts: 2}
+	require.Equal(t, "supervisor: healthy since 2026-01-02T03:04:05Z, 2 restarts", status.String())
+
+	status = supervisorStatus{State: serverCrashLoop, Since: since, Restarts: 5, LastFailure: "heap limit"}
+	require.Equal(t, "supervisor: crash-loop since 2026-01-02T03:04:05Z, 5 restarts, last failure: heap limit", status.String())
+}
+
+func TestSupervisorStatusReachesTheInformationResponse(t *testing.T) {
+	since := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	status := supervisorStatus{State: serverCrashLoop, Since: since, Restarts: 5, LastFailure: "heap limit"}
+	response := &runtimev0.InformationResponse{}
+	require.NoError(t, annotateInformation(response, status.annotations()),
+		"the pinned Information contract must carry the supervisor state")
+
+	message := response.ProtoReflect()
+	values := message.Get(message.Descriptor().Fields().ByName(informationAnnotationsField)).Map()
+	reported := map[string]string{}
+	values.Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+		reported[key.String()] = value.String()
+		return true
+	})
+	require.Equal(t, map[string]string{
+		"server.state":        "crash-loop",
+		"server.since":        "2026-01-02T03:04:05Z",
+		"server.restarts":     "5",
+		"server.last-failure": "heap limit",
+	}, reported)
+
+	require.ErrorContains(t, annotateInformation(&runtimev0.InformationRequest{}, status.annotations()), "no map<string, string> annotations field")
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"io/fs"
 	"regexp"
+	"slices"
 	"strings"
 	"testing"
 	"text/template"
@@ -108,6 +109,41 @@ func TestFactoryTemplateUsesExplicitApplicationOwnedComposition(t *testing.T) {
 	}
 }
 
+func TestFactoryToolingSkipsAgentState(t *testing.T) {
+	t.Parallel()
+
+	// Agent state under .codefly holds scratch copies of the app (the e2e
+	// production server stage of a source-dir "." service) and run
+	// artifacts; type-checking, unit tests and lint must never pick them up.
+	tsconfigData, err := fs.ReadFile(factoryFS, "templates/factory/code/tsconfig.json")
+	if err != nil {
+		t.Fatalf("read factory tsconfig.json: %v", err)
+	}
+	var tsconfig struct {
+		Exclude []string `json:"exclude"`
+	}
+	if err := json.Unmarshal(tsconfigData, &tsconfig); err != nil {
+		t.Fatalf("parse factory tsconfig.json: %v", err)
+	}
+	if !slices.Contains(tsconfig.Exclude, ".codefly") {
+		t.Fatalf("tsconfig.json exclude = %v, want .codefly", tsconfig.Exclude)
+	}
+	for file, want := range map[string][]string{
+		"templates/factory/code/vitest.config.ts":  {"...configDefaults.exclude", `".codefly/**"`},
+		"templates/factory/code/eslint.config.mjs": {`".codefly/**"`},
+	} {
+		content, err := fs.ReadFile(factoryFS, file)
+		if err != nil {
+			t.Fatalf("read %s: %v", file, err)
+		}
+		for _, required := range want {
+			if !strings.Contains(string(content), required) {
+				t.Fatalf("%s must exclude agent state: missing %s", file, required)
+			}
+		}
+	}
+}
+
 func TestBuilderTemplateInstallsWorkspaceGraphReproducibly(t *testing.T) {
 	t.Parallel()
 
@@ -120,24 +156,14 @@ func TestBuilderTemplateInstallsWorkspaceGraphReproducibly(t *testing.T) {
 		"FROM {{.NodeImage}} AS base",
 		"COPY code/packages ./packages",
 		"COPY service.codefly.yaml /service.codefly.yaml",
-		"RUN npm ci",
+		"RUN {{.InstallCommand}}",
 		"RUN rm -rf node_modules",
-		"RUN mkdir -p public && npm run build",
+		"RUN mkdir -p public && {{.BuildCommand}}",
 	} {
 		if !strings.Contains(source, required) {
 			t.Fatalf("Dockerfile template missing %q", required)
 		}
 	}
-	if strings.Index(source, "COPY code/packages ./packages") > strings.Index(source, "RUN npm ci") {
-		t.Fatal("workspace packages must be copied before npm ci")
-	}
-	sourceCopy := strings.LastIndex(source, "COPY code/ .")
-	cleanInstall := strings.Index(source, "RUN rm -rf node_modules")
-	dependencyCopy := strings.LastIndex(source, "COPY --from=deps /app/node_modules ./node_modules")
-	build := strings.Index(source, "RUN mkdir -p public && npm run build")
-	if sourceCopy < 0 || !(sourceCopy < cleanInstall && cleanInstall < dependencyCopy && dependencyCopy < build) {
-		t.Fatal("builder must replace host node_modules with the clean dependency layer before build")
-	}
 	if strings.Contains(source, "node:{{.NodeVersion}}") {
 		t.Fatal("Dockerfile template must not use the floating Node major tag")
 	}
@@ -149,50 +175,309 @@ func TestBuilderTemplateInstallsWorkspaceGraphReproducibly(t *testing.T) {
 	if !strings.Contains(NodeImage, "@sha256:") {
 		t.Fatalf("NodeImage is not digest-pinned: %q", NodeImage)
 	}
-	rendered := &bytes.Buffer{}
 	parsed, err := template.New("Dockerfile").Parse(source)
 	if err != nil {
 		t.Fatalf("parse Dockerfile template: %v", err)
 	}
-	if err := parsed.Execute(rendered, DockerTemplating{NodeImage: NodeImage}); err != nil {
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		install  string
+		build    string
+		required []string
+	}{
+		{
+			name:    "npm",
+			files:   map[string]string{"package-lock.json": "{}"},
+			install: "RUN npm ci",
+			build:   "RUN mkdir -p public && npm run build",
+			required: []string{
+				"COPY code/package.json code/package-lock.json ./",
+			},
+		},
+		{
+			name: "pnpm",
+			files: map[string]string{
+				"pnpm-lock.yaml":      "lockfileVersion: '9.0'\n",
+				"pnpm-workspace.yaml": "packages:\n  - packages/*\n",
+			},
+			install: "RUN pnpm install --frozen-lockfile",
+			build:   "RUN mkdir -p public && pnpm run build",
+			required: []string{
+				"RUN corepack enable",
+				"COPY code/package.json code/pnpm-lock.yaml code/pnpm-workspace.yaml ./",
+				"RUN rm -rf node_modules packages/*/node_modules",
+				"COPY --from=deps /app/packages ./packages",
+			},
+		},
+		{
+			name: "yarn",
+			files: map[string]string{
+				"yarn.lock":                   "__metadata:\n  version: 8\n",
+				".yarnrc.yml":                 "nodeLinker: node-modules\n",
+				".yarn/releases/yarn-4.5.cjs": "",
+			},
+			install: "RUN yarn install --immutable",
+			build:   "RUN mkdir -p public && yarn run build",
+			required: []string{
+				"RUN corepack enable",
+				"COPY code/package.json code/yarn.lock code/.yarnrc.yml ./",
+				"COPY code/.yarn ./.yarn",
+			},
+		},
+		{
+			name:    "bun",
+			files:   map[string]string{"bun.lock": "{}"},
+			install: "RUN bun install --frozen-lockfile",
+			build:   "RUN mkdir -p public && bun run build",
+			required: []string{
+				"RUN npm install -g bun@" + defaultBunVersion,
+				"COPY code/package.json code/bun.lock ./",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sourceDir := t.TempDir()
+			writeProductionTestFile(t, sourceDir, "package.json", dockerTemplatingPackageJSON)
+			for name, content := range test.files {
+				writeProductionTestFile(t, sourceDir, name, content)
+			}
+			docker, err := newDockerTemplating(sourceDir, &Settings{})
+			if err != nil {
+				t.Fatalf("resolve Dockerfile inputs: %v", err)
+			}
+			rendered := &bytes.Buffer{}
+			if err := parsed.Execute(rendered, docker); err != nil {
+				t.Fatalf("render Dockerfile template: %v", err)
+			}
+			output := rendered.String()
+			if !strings.HasPrefix(output, "FROM "+NodeImage+" AS base") {
+				t.Fatal("rendered Dockerfile does not use the pinned Node image")
+			}
+			for _, required := range append([]string{test.install, test.build}, test.required...) {
+				if !strings.Contains(output, required) {
+					t.Fatalf("rendered %s Dockerfile missing %q:\n%s", test.name, required, output)
+				}
+			}
+			if test.name != "npm" && strings.Contains(output, "npm ci") {
+				t.Fatalf("rendered %s Dockerfile falls back to npm ci", test.name)
+			}
+			if strings.Index(output, "COPY code/packages ./packages") > strings.Index(output, test.install) {
+				t.Fatalf("workspace packages must be copied before %s", test.install)
+			}
+			sourceCopy := strings.LastIndex(output, "COPY code/ .")
+			cleanInstall := strings.Index(output, "RUN rm -rf node_modules")
+			dependencyCopy := strings.LastIndex(output, "COPY --from=deps /app/node_modules ./node_modules")
+			build := strings.Index(output, test.build)
+			if sourceCopy < 0 || !(sourceCopy < cleanInstall && cleanInstall < dependencyCopy && dependencyCopy < build) {
+				t.Fatal("builder must replace host node_modules with the clean dependency layer before build")
+			}
+			runner := strings.LastIndex(output, "AS runner")
+			if strings.Contains(output[runner:], "corepack enable") || strings.Contains(output[runner:], "bun@") {
+				t.Fatal("package manager toolchain leaked into the runtime image")
+			}
+		})
+	}
+}
+
+func TestBuilderTemplateMountsRegistryCredentialsAsASecret(t *testing.T) {
+	t.Parallel()
+
+	dockerfile, err := fs.ReadFile(builderFS, "templates/builder/Dockerfile.tmpl")
+	if err != nil {
+		t.Fatalf("read Dockerfile template: %v", err)
+	}
+	parsed, err := template.New("Dockerfile").Parse(string(dockerfile))
+	if err != nil {
+		t.Fatalf("parse Dockerfile template: %v", err)
+	}
+	sourceDir := t.TempDir()
+	writeProductionTestFile(t, sourceDir, "package.json", dockerTemplatingPackageJSON)
+	writeProductionTestFile(t, sourceDir, "package-lock.json", "{}")
+	docker, err := newDockerTemplating(sourceDir, &Settings{Registry: RegistrySettings{
+		URL:  "https://npm.example.com/",
+		Auth: []RegistryAuth{{Configuration: "npm"}},
+	}})
+	if err != nil {
+		t.Fatalf("resolve Dockerfile inputs: %v", err)
+	}
+	rendered := &bytes.Buffer{}
+	if err := parsed.Execute(rendered, docker); err != nil {
 		t.Fatalf("render Dockerfile template: %v", err)
 	}
-	if !strings.HasPrefix(rendered.String(), "FROM "+NodeImage+" AS base") {
-		t.Fatal("rendered Dockerfile does not use the pinned Node image")
+	output := rendered.String()
+	if !strings.Contains(output, "RUN --mount=type=secret,id=npmrc,target=/root/.npmrc,required=true npm ci") {
+		t.Fatalf("rendered Dockerfile does not mount the registry secret for the install:\n%s", output)
+	}
+	if strings.Contains(output, "RUN npm ci") || strings.Contains(output, "COPY code/.npmrc") {
+		t.Fatal("registry credentials must reach the install only through the secret mount")
+	}
+
+	yarn := t.TempDir()
+	writeProductionTestFile(t, yarn, "package.json", dockerTemplatingPackageJSON)
+	writeProductionTestFile(t, yarn, "yarn.lock", "__metadata:\n  version: 8\n")
+	writeProductionTestFile(t, yarn, ".yarnrc.yml", "nodeLinker: node-modules\n")
+	if _, err := newDockerTemplating(yarn, &Settings{Registry: RegistrySettings{URL: "https://npm.example.com/"}}); err == nil ||
+		!strings.Contains(err.Error(), "npm and pnpm") {
+		t.Fatalf("Yarn registry error = %v", err)
 	}
 }
 
-func TestHealthProbePathIsScaffoldedAsARouteHandler(t *testing.T) {
+func TestDockerTemplatingRequiresAFrozenInstallableTree(t *testing.T) {
 	t.Parallel()
 
-	deployment, err := fs.ReadFile(deploymentFS, "templates/deployment/kustomize/base/deployment.yaml.tmpl")
-	if err != nil {
-		t.Fatalf("read deployment template: %v", err)
+	unlocked := t.TempDir()
+	writeProductionTestFile(t, unlocked, "package.json", dockerTemplatingPackageJSON)
+	writeProductionTestFile(t, unlocked, "pnpm-workspace.yaml", "packages: []\n")
+	if _, err := newDockerTemplating(unlocked, &Settings{PackageManager: "pnpm"}); err == nil ||
+		!strings.Contains(err.Error(), "require a committed lockfile; run pnpm install") {
+		t.Fatalf("missing lockfile error = %v", err)
 	}
 
-	// Every httpGet probe (startup, readiness, liveness) must resolve to a
-	// scaffolded route, not just one of them — repointing a single probe at an
-	// unscaffolded path is exactly the reported failure. Anchoring on httpGet
-	// avoids the other `path:` keys in the manifest (volume mounts, subPaths).
-	probes := regexp.MustCompile(`httpGet:\s*\n\s*path:\s*(\S+)`).FindAllStringSubmatch(string(deployment), -1)
-	if len(probes) == 0 {
-		t.Fatal("deployment template declares no httpGet probes")
+	pnp := t.TempDir()
+	writeProductionTestFile(t, pnp, "package.json", dockerTemplatingPackageJSON)
+	writeProductionTestFile(t, pnp, "yarn.lock", "__metadata:\n  version: 8\n")
+	writeProductionTestFile(t, pnp, ".yarnrc.yml", "enableTelemetry: false\n")
+	if _, err := newDockerTemplating(pnp, &Settings{}); err == nil || !strings.Contains(err.Error(), "nodeLinker: node-modules") {
+		t.Fatalf("Plug'n'Play error = %v", err)
 	}
 
-	// App Router accepts GET as a function or a const, sync or async.
-	getHandler := regexp.MustCompile(`export\s+(?:async\s+)?function\s+GET\b|export\s+const\s+GET\b`)
+	declared := t.TempDir()
+	writeProductionTestFile(t, declared, "package.json", `{"packageManager":"bun@1.1.38"}`)
+	writeProductionTestFile(t, declared, "bun.lockb", "")
+	docker, err := newDockerTemplating(declared, &Settings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if docker.BunVersion != "1.1.38" || docker.Lockfile != "bun.lockb" || docker.Corepack {
+		t.Fatalf("declared Bun templating = %+v", docker)
+	}
+}
+
+const dockerTemplatingPackageJSON = `{"name":"frontend","scripts":{"build":"next build"}}`
+
+func TestHealthProbePathIsScaffoldedAsARouteHandler(t *testing.T) {
+	t.Parallel()
+
+	// Every SSR probe (startup, readiness, liveness) must execute the
+	// readiness contract baked into the image rather than a hard-coded
+	// httpGet path, so a configured readiness path or body assertion applies
+	// in the cluster exactly as it does under `codefly run`.
+	deployment := renderDeploymentTemplate(t)
+	if strings.Contains(deployment, "httpGet:") {
+		t.Fatal("SSR deployment probes must run the image readiness contract, not a fixed httpGet path")
+	}
+	probes := regexp.MustCompile(`(startupProbe|readinessProbe|livenessProbe):\s*\n\s*exec:\s*\n\s*command:\s*(\[.*\])`).
+		FindAllStringSubmatch(deployment, -1)
+	if len(probes) != 3 {
+		t.Fatalf("SSR deployment declares %d exec probes, want startup, readiness, and liveness", len(probes))
+	}
 	for _, probe := range probes {
-		// App Router maps src/app/<segments>/route.ts to /<segments>.
-		probePath := strings.Trim(probe[1], `"'`)
-		routeFile := "templates/factory/code/src/app" + probePath + "/route.ts"
-		route, err := fs.ReadFile(factoryFS, routeFile)
-		if err != nil {
-			t.Fatalf("probe path %s has no scaffolded route (%s): %v", probePath, routeFile, err)
+		var command []string
+		if err := json.Unmarshal([]byte(probe[2]), &command); err != nil {
+			t.Fatalf("%s command %s: %v", probe[1], probe[2], err)
 		}
-		if !getHandler.Match(route) {
-			t.Fatalf("health route %s must export a GET handler, got:\n%s", routeFile, route)
+		if len(command) == 0 || command[0] != "/app/codefly-readiness" {
+			t.Fatalf("%s does not run the readiness contract: %v", probe[1], command)
 		}
 	}
+
+	dockerfile := renderDockerfileTemplate(t, &Settings{})
+	if !strings.Contains(dockerfile, "builder/readiness.mjs ./codefly-readiness.mjs") ||
+		!strings.Contains(dockerfile, `exec node /app/codefly-readiness.mjs "$@"`) {
+		t.Fatalf("SSR image does not run the readiness contract script from its probe:\n%s", dockerfile)
+	}
+	ignore, err := fs.ReadFile(builderFS, "templates/builder/dockerignore.tmpl")
+	if err != nil {
+		t.Fatalf("read dockerignore template: %v", err)
+	}
+	if !strings.Contains(string(ignore), "!builder/readiness.mjs") {
+		t.Fatal("dockerignore excludes the readiness contract script from the build context")
+	}
+
+	// The default contract must resolve to a scaffolded route that satisfies
+	// it. App Router maps src/app/<segments>/route.ts to /<segments> and
+	// accepts GET as a function or a const, sync or async.
+	contract, err := (&Settings{}).ReadinessContract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	routeFile := "templates/factory/code/src/app" + contract.Path + "/route.ts"
+	route, err := fs.ReadFile(factoryFS, routeFile)
+	if err != nil {
+		t.Fatalf("readiness path %s has no scaffolded route (%s): %v", contract.Path, routeFile, err)
+	}
+	getHandler := regexp.MustCompile(`export\s+(?:async\s+)?function\s+GET\b|export\s+const\s+GET\b`)
+	if !getHandler.Match(route) {
+		t.Fatalf("health route %s must export a GET handler, got:\n%s", routeFile, route)
+	}
+}
+
+func TestStaticImageProbesServeWithoutNode(t *testing.T) {
+	t.Parallel()
+
+	// The static image is nginx: it has no node binary and does not carry
+	// the readiness script, so its probe command must not need them.
+	dockerfile := renderDockerfileTemplate(t, &Settings{Mode: "static"})
+	_, runner, _ := strings.Cut(dockerfile, "AS runner")
+	if strings.Contains(runner, "node ") || strings.Contains(runner, "codefly-readiness.mjs") {
+		t.Fatalf("static image probe must not need Node.js:\n%s", runner)
+	}
+	if !strings.Contains(runner, "exec wget -q -O /dev/null http://127.0.0.1/") ||
+		!strings.Contains(runner, "chmod 755 /app/codefly-readiness") {
+		t.Fatalf("static image does not carry the probe command the deployment runs:\n%s", runner)
+	}
+}
+
+// renderDockerfileTemplate renders the builder Dockerfile for an npm project
+// with settings.
+func renderDockerfileTemplate(t *testing.T, settings *Settings) string {
+	t.Helper()
+	source, err := fs.ReadFile(builderFS, "templates/builder/Dockerfile.tmpl")
+	if err != nil {
+		t.Fatalf("read Dockerfile template: %v", err)
+	}
+	tmpl, err := template.New("Dockerfile").Parse(string(source))
+	if err != nil {
+		t.Fatalf("parse Dockerfile template: %v", err)
+	}
+	sourceDir := t.TempDir()
+	writeProductionTestFile(t, sourceDir, "package.json", dockerTemplatingPackageJSON)
+	writeProductionTestFile(t, sourceDir, "package-lock.json", "{}")
+	docker, err := newDockerTemplating(sourceDir, settings)
+	if err != nil {
+		t.Fatalf("resolve Dockerfile inputs: %v", err)
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, docker); err != nil {
+		t.Fatalf("render Dockerfile template: %v", err)
+	}
+	return rendered.String()
+}
+
+// renderDeploymentTemplate renders the base Deployment with the fields the
+// Kubernetes deployer passes.
+func renderDeploymentTemplate(t *testing.T) string {
+	t.Helper()
+	source, err := fs.ReadFile(deploymentFS, "templates/deployment/kustomize/base/deployment.yaml.tmpl")
+	if err != nil {
+		t.Fatalf("read deployment template: %v", err)
+	}
+	tmpl, err := template.New("deployment").Parse(string(source))
+	if err != nil {
+		t.Fatalf("parse deployment template: %v", err)
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, map[string]any{
+		"Name":      "web",
+		"Namespace": "apps",
+		"Image":     "registry.example.com/web:1",
+	}); err != nil {
+		t.Fatalf("render deployment template: %v", err)
+	}
+	return rendered.String()
 }
 
 func TestDeploymentIdentityMatchesContainerIdentity(t *testing.T) {
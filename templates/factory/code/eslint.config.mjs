@@ -5,5 +5,5 @@ import nextTypeScript from "eslint-config-next/typescript";
 export default defineConfig([
   ...nextVitals,
   ...nextTypeScript,
-  globalIgnores(["node_modules/**", ".next/**", "dist/**", "src/gen/**"]),
+  globalIgnores(["node_modules/**", ".next/**", ".codefly/**", "dist/**", "src/gen/**"]),
 ]);
@@ -1,4 +1,4 @@
-import { defineConfig } from "vitest/config";
+import { configDefaults, defineConfig } from "vitest/config";
 import path from "path";
 
 export default defineConfig({
@@ -6,6 +6,8 @@ export default defineConfig({
     globals: true,
     environment: "jsdom",
     setupFiles: ["./src/test/setup.ts"],
+    // Agent state (coverage, test artifacts, scratch builds) is not source.
+    exclude: [...configDefaults.exclude, ".codefly/**"],
   },
   resolve: {
     alias: {
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// testRetries reads the agent-owned --retries=N extra argument, which
+// overrides test.retries, and returns the remaining runner arguments.
+func testRetries(extraArgs []string, setting int) (int, bool, []string, error) {
+	retries, explicit := setting, false
+	var remaining []string
+	for i := 0; i < len(extraArgs); i++ {
+		name, value, hasValue := strings.Cut(extraArgs[i], "=")
+		if name != "--retries" {
+			remaining = append(remaining, extraArgs[i])
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(extraArgs) {
+				return 0, false, nil, fmt.Errorf("--retries needs a value")
+			}
+			i++
+			value = extraArgs[i]
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return 0, false, nil, fmt.Errorf("--retries must be a non-negative integer, got %q", value)
+		}
+		retries, explicit = parsed, true
+	}
+	return max(retries, 0), explicit, remaining, nil
+}
+
+// jestCase identifies one test case of a Jest JSON report. Vitest's json
+// reporter writes the same format.
+type jestCase struct {
+	File     string
+	FullName string
+}
+
+// jestAssertions visits every assertion of a Jest JSON report, decoded as
+// generic JSON so rewriting it keeps the fields this agent does not read.
+func jestAssertions(report map[string]any, visit func(file string, assertion map[string]any)) {
+	results, _ := report["testResults"].([]any)
+	for _, result := range results {
+		file, _ := result.(map[string]any)
+		name, _ := file["name"].(string)
+		assertions, _ := file["assertionResults"].([]any)
+		for _, assertion := range assertions {
+			if values, ok := assertion.(map[string]any); ok {
+				visit(name, values)
+			}
+		}
+	}
+}
+
+func jestFullName(assertion map[string]any) string {
+	if fullName, ok := assertion["fullName"].(string); ok && fullName != "" {
+		return fullName
+	}
+	var parts []string
+	ancestors, _ := assertion["ancestorTitles"].([]any)
+	for _, ancestor := range ancestors {
+		if title, ok := ancestor.(string); ok {
+			parts = append(parts, title)
+		}
+	}
+	title, _ := assertion["title"].(string)
+	return strings.Join(append(parts, title), " ")
+}
+
+// failedJestCases lists the failed cases of a report.
+func failedJestCases(data []byte) ([]jestCase, error) {
+	var report map[string]any
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("parse test report: %w", err)
+	}
+	var failed []jestCase
+	jestAssertions(report, func(file string, assertion map[string]any) {
+		if assertion["status"] == "failed" {
+			failed = append(failed, jestCase{File: file, FullName: jestFullName(assertion)})
+		}
+	})
+	return failed, nil
+}
+
+// retryNamePattern matches exactly the given cases by full name, the form
+// --testNamePattern matches against in Jest and Vitest.
+func retryNamePattern(cases []jestCase) string {
+	var patterns []string
+	for _, c := range cases {
+		pattern := "^" + regexp.QuoteMeta(c.FullName) + "$"
+		if !slices.Contains(patterns, pattern) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return combineRegex(patterns)
+}
+
+// flakyTest is a case that failed, then passed on a retry.
+type flakyTest struct {
+	File     string `json:"file"`
+	Name     string `json:"name"`
+	Attempts int    `json:"attempts"`
+}
+
+// applyJestRetry folds a rerun into the report: each failed case that passed
+// in the rerun becomes passed, keeps its earlier failures as retryReasons and
+// counts its attempts in invocations, as Jest's own retryTimes reports them.
+// Suite and run totals are recomputed.
+func applyJestRetry(current, rerun []byte, attempt int) ([]byte, []flakyTest, error) {
+	var report, retried map[string]any
+	if err := json.Unmarshal(current, &report); err != nil {
+		return nil, nil, fmt.Errorf("parse test report: %w", err)
+	}
+	if err := json.Unmarshal(rerun, &retried); err != nil {
+		return nil, nil, fmt.Errorf("parse retried test report: %w", err)
+	}
+	passed := map[jestCase]bool{}
+	jestAssertions(retried, func(file string, assertion map[string]any) {
+		if assertion["status"] == "passed" {
+			passed[jestCase{File: file, FullName: jestFullName(assertion)}] = true
+		}
+	})
+
+	var flaky []flakyTest
+	var passedTests, failedTests, passedSuites, failedSuites float64
+	results, _ := report["testResults"].([]any)
+	for _, result := range results {
+		file, _ := result.(map[string]any)
+		name, _ := file["name"].(string)
+		assertions, _ := file["assertionResults"].([]any)
+		suiteFailed, recovered := false, false
+		for _, entry := range assertions {
+			assertion, ok := entry.(map[string]any)
+			if !ok {
+				continue
+			}
+			key := jestCase{File: name, FullName: jestFullName(assertion)}
+			if assertion["status"] == "failed" && passed[key] {
+				assertion["status"] = "passed"
+				assertion["retryReasons"] = assertion["failureMessages"]
+				assertion["failureMessages"] = []any{}
+				assertion["invocations"] = attempt + 1
+				flaky = append(flaky, flakyTest{File: name, Name: key.FullName, Attempts: attempt + 1})
+				recovered = true
+			}
+			switch assertion["status"] {
+			case "passed":
+				passedTests++
+			case "failed":
+				failedTests++
+				suiteFailed = true
+			}
+		}
+		// Only a retry makes a failed suite pass; one that failed outside
+		// its cases (a syntax error, a failing hook) stays failed.
+		if recovered && !suiteFailed {
+			file["status"] = "passed"
+			file["message"] = ""
+		}
+		switch file["status"] {
+		case "passed":
+			passedSuites++
+		case "failed":
+			failedSuites++
+		}
+	}
+	if len(flaky) > 0 {
+		report["numPassedTests"] = passedTests
+		report["numFailedTests"] = failedTests
+		report["numPassedTestSuites"] = passedSuites
+		report["numFailedTestSuites"] = failedSuites
+		runtimeErrors, _ := report["numRuntimeErrorTestSuites"].(float64)
+		report["success"] = failedTests == 0 && failedSuites == 0 && runtimeErrors == 0
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, flaky, nil
+}
+
+// playwrightFlakyTests lists the tests Playwright itself marked flaky.
+func playwrightFlakyTests(data []byte) []flakyTest {
+	tests, err := readPlaywrightTests("", data)
+	if err != nil {
+		return nil
+	}
+	var flaky []flakyTest
+	for _, test := range tests {
+		if test.Status == "flaky" {
+			flaky = append(flaky, flakyTest{File: test.File, Name: test.Title, Attempts: test.Retries + 1})
+		}
+	}
+	return flaky
+}
+
+// flakeHistoryFile persists flaky tests across runs, next to the reports.
+var flakeHistoryFile = filepath.Join(".codefly", "test-output", "flake-history.json")
+
+// flakeRecord is how often one test was flaky.
+type flakeRecord struct {
+	Suite     string    `json:"suite"`
+	File      string    `json:"file"`
+	Name      string    `json:"name"`
+	Flakes    int       `json:"flakes"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// recordFlakes adds this run's flaky tests to the history at path and returns
+// their updated records.
+func recordFlakes(path, suite string, flaky []flakyTest, now time.Time) ([]flakeRecord, error) {
+	if len(flaky) == 0 {
+		return nil, nil
+	}
+	var history []flakeRecord
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read flake history: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &history); err != nil {
+			return nil, fmt.Errorf("parse flake history %s: %w", path, err)
+		}
+	}
+	updated := make([]flakeRecord, 0, len(flaky))
+	for _, test := range flaky {
+		index := slices.IndexFunc(history, func(record flakeRecord) bool {
+			return record.Suite == suite && record.File == test.File && record.Name == test.Name
+		})
+		if index < 0 {
+			history = append(history, flakeRecord{Suite: suite, File: test.File, Name: test.Name, FirstSeen: now})
+			index = len(history) - 1
+		}
+		history[index].Flakes++
+		history[index].LastSeen = now
+		updated = append(updated, history[index])
+	}
+	data, err = json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create flake history directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return nil, fmt.Errorf("write flake history: %w", err)
+	}
+	return updated, nil
+}
+
+// flakeReport lists this run's flaky tests, repeat offenders first.
+func flakeReport(flaky []flakyTest, records []flakeRecord) string {
+	if len(flaky) == 0 {
+		return ""
+	}
+	flakes := map[string]flakeRecord{}
+	for _, record := range records {
+		flakes[record.File+"\x00"+record.Name] = record
+	}
+	lines := make([]string, 0, len(flaky))
+	repeated := 0
+	for _, test := range flaky {
+		line := fmt.Sprintf("%s (%s): passed on attempt %d", test.Name, filepath.Base(test.File), test.Attempts)
+		if record, ok := flakes[test.File+"\x00"+test.Name]; ok && record.Flakes > 1 {
+			line = fmt.Sprintf("%s; flaky in %d runs since %s", line, record.Flakes, record.FirstSeen.Format(time.DateOnly))
+			lines = slices.Insert(lines, repeated, line)
+			repeated++
+			continue
+		}
+		lines = append(lines, line)
+	}
+	header := fmt.Sprintf("%d flaky test(s)", len(flaky))
+	if repeated > 0 {
+		header += fmt.Sprintf(", %d repeat offender(s)", repeated)
+	}
+	return header + ":\n  " + strings.Join(lines, "\n  ")
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const jestRetryFixture = `{
+  "numTotalTests": 4,
+  "numPassedTests": 1,
+  "numFailedTests": 3,
+  "numTotalTestSuites": 2,
+  "numPassedTestSuites": 0,
+  "numFailedTestSuites": 2,
+  "numRuntimeErrorTestSuites": 0,
+  "success": false,
+  "testResults": [{
+    "name": "/app/src/cart.test.ts",
+    "status": "failed",
+    "message": "cart failed",
+    "assertionResults": [
+      {"ancestorTitles": ["cart"], "title": "adds (item)", "fullName": "cart adds (item)", "status": "failed", "failureMessages": ["timeout"]},
+      {"ancestorTitles": ["cart"], "title": "empties", "fullName": "cart empties", "status": "passed", "failureMessages": []}
+    ]
+  }, {
+    "name": "/app/src/pay.test.ts",
+    "status": "failed",
+    "message": "pay failed",
+    "assertionResults": [
+      {"ancestorTitles": [], "title": "charges", "status": "failed", "failureMessages": ["502"]},
+      {"ancestorTitles": [], "title": "refunds", "status": "failed", "failureMessages": ["boom"]}
+    ]
+  }]
+}`
+
+func TestTestRetriesReadsTheOverride(t *testing.T) {
+	retries, explicit, args, err := testRetries([]string{"--headed", "--retries=3"}, 1)
+	require.NoError(t, err)
+	require.Equal(t, 3, retries)
+	require.True(t, explicit)
+	require.Equal(t, []string{"--headed"}, args)
+
+	retries, explicit, args, err = testRetries([]string{"--bail"}, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, retries)
+	require.False(t, explicit)
+	require.Equal(t, []string{"--bail"}, args)
+
+	_, _, _, err = testRetries([]string{"--retries", "-1"}, 0)
+	require.Error(t, err)
+	_, _, _, err = testRetries([]string{"--retries"}, 0)
+	require.Error(t, err)
+}
+
+func TestRetryNamePatternMatchesFailedCasesExactly(t *testing.T) {
+	failed, err := failedJestCases([]byte(jestRetryFixture))
+	require.NoError(t, err)
+	require.Equal(t, []jestCase{
+		{File: "/app/src/cart.test.ts", FullName: "cart adds (item)"},
+		{File: "/app/src/pay.test.ts", FullName: "charges"},
+		{File: "/app/src/pay.test.ts", FullName: "refunds"},
+	}, failed)
+
+	pattern := retryNamePattern(failed)
+	require.Contains(t, pattern, `^cart adds \(item\)$`)
+	require.Contains(t, pattern, "^charges$")
+	require.NotContains(t, pattern, "empties")
+}
+
+func TestApplyJestRetryMarksRecoveredCasesFlaky(t *testing.T) {
+	rerun := `{"testResults": [
+	  {"name": "/app/src/cart.test.ts", "assertionResults": [{"fullName": "cart adds (item)", "status": "passed"}]},
+	  {"name": "/app/src/pay.test.ts", "assertionResults": [
+	    {"title": "charges", "ancestorTitles": [], "status": "passed"},
+	    {"title": "refunds", "ancestorTitles": [], "status": "failed", "failureMessages": ["boom"]}
+	  ]}
+	]}`
+	merged, flaky, err := applyJestRetry([]byte(jestRetryFixture), []byte(rerun), 1)
+	require.NoError(t, err)
+	require.Equal(t, []flakyTest{
+		{File: "/app/src/cart.test.ts", Name: "cart adds (item)", Attempts: 2},
+		{File: "/app/src/pay.test.ts", Name: "charges", Attempts: 2},
+	}, flaky)
+
+	var report map[string]any
+	require.NoError(t, json.Unmarshal(merged, &report))
+	require.EqualValues(t, 3, report["numPassedTests"])
+	require.EqualValues(t, 1, report["numFailedTests"])
+	require.EqualValues(t, 1, report["numPassedTestSuites"])
+	require.EqualValues(t, 1, report["numFailedTestSuites"])
+	require.Equal(t, false, report["success"])
+
+	results := report["testResults"].([]any)
+	cart := results[0].(map[string]any)
+	require.Equal(t, "passed", cart["status"])
+	recovered := cart["assertionResults"].([]any)[0].(map[string]any)
+	require.Equal(t, "passed", recovered["status"])
+	require.Equal(t, []any{"timeout"}, recovered["retryReasons"])
+	require.EqualValues(t, 2, recovered["invocations"])
+	require.Equal(t, "failed", results[1].(map[string]any)["status"], "a case still fails")
+
+	remaining, err := failedJestCases(merged)
+	require.NoError(t, err)
+	require.Equal(t, []jestCase{{File: "/app/src/pay.test.ts", FullName: "refunds"}}, remaining)
+}
+
+func TestApplyJestRetryKeepsSuitesThatFailedOutsideTheirCases(t *testing.T) {
+	current := `{"numRuntimeErrorTestSuites": 0, "testResults": [{
+	  "name": "/app/src/hook.test.ts", "status": "failed", "message": "beforeAll failed",
+	  "assertionResults": [{"fullName": "works", "status": "passed"}]
+	}]}`
+	rerun := `{"testResults": [{"name": "/app/src/hook.test.ts", "assertionResults": [{"fullName": "works", "status": "passed"}]}]}`
+	merged, flaky, err := applyJestRetry([]byte(current), []byte(rerun), 1)
+	require.NoError(t, err)
+	require.Empty(t, flaky)
+	require.Contains(t, string(merged), "beforeAll failed")
+}
+
+func TestPlaywrightFlakyTestsComeFromItsOwnRetries(t *testing.T) {
+	flaky := playwrightFlakyTests([]byte(playwrightReportFixture))
+	require.Equal(t, []flakyTest{{File: "checkout.spec.ts", Name: "payment › pays by card", Attempts: 2}}, flaky)
+	require.Nil(t, playwrightFlakyTests([]byte("not json")))
+}
+
+func TestRecordFlakesCountsRepeatOffenders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test-output", "flake-history.json")
+	first := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cart := flakyTest{File: "src/cart.test.ts", Name: "cart adds", Attempts: 2}
+	pay := flakyTest{File: "src/pay.test.ts", Name: "charges", Attempts: 3}
+
+	records, err := recordFlakes(path, "unit", []flakyTest{cart}, first)
+	require.NoError(t, err)
+	require.Equal(t, 1, records[0].Flakes)
+
+	records, err = recordFlakes(path, "unit", []flakyTest{pay, cart}, first.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, records[0].Flakes)
+	require.Equal(t, 2, records[1].Flakes)
+	require.Equal(t, first, records[1].FirstSeen)
+
+	records, err = recordFlakes(path, "e2e", []flakyTest{cart}, first)
+	require.NoError(t, err)
+	require.Equal(t, 1, records[0].Flakes, "history is kept per suite")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var history []flakeRecord
+	require.NoError(t, json.Unmarshal(data, &history))
+	require.Len(t, history, 3)
+}
+
+func TestFlakeReportListsRepeatOffendersFirst(t *testing.T) {
+	since := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	flaky := []flakyTest{
+		{File: "src/pay.test.ts", Name: "charges", Attempts: 2},
+		{File: "src/cart.test.ts", Name: "cart adds", Attempts: 3},
+	}
+	report := flakeReport(flaky, []flakeRecord{
+		{File: "src/pay.test.ts", Name: "charges", Flakes: 1, FirstSeen: since},
+		{File: "src/cart.test.ts", Name: "cart adds", Flakes: 4, FirstSeen: since},
+	})
+	lines := strings.Split(report, "\n")
+	require.Equal(t, "2 flaky test(s), 1 repeat offender(s):", lines[0])
+	require.Equal(t, "  cart adds (cart.test.ts): passed on attempt 3; flaky in 4 runs since 2026-03-01", lines[1])
+	require.Equal(t, "  charges (pay.test.ts): passed on attempt 2", lines[2])
+	require.Empty(t, flakeReport(nil, nil))
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	runtimev0 "github.com/codefly-dev/core/generated/go/codefly/services/runtime/v0"
+)
+
+// Test selection strategies, as reported in the test output.
+const (
+	selectVitestChanged    = "vitest --changed"
+	selectVitestRelated    = "vitest related"
+	selectJestRelated      = "jest --findRelatedTests"
+	selectPlaywrightRoutes = "playwright route map"
+	selectAll              = "all tests"
+	selectNone             = "no tests"
+)
+
+// testSelectionRequest reads the agent-owned --since=REF and --changed=FILE
+// extra arguments, which narrow a run to the tests affected by the files
+// changed since a git ref or by the files listed. --changed repeats or takes
+// a comma-separated list.
+func testSelectionRequest(extraArgs []string) (string, []string, []string, error) {
+	var since string
+	var files, remaining []string
+	for i := 0; i < len(extraArgs); i++ {
+		name, value, hasValue := strings.Cut(extraArgs[i], "=")
+		if name != "--since" && name != "--changed" {
+			remaining = append(remaining, extraArgs[i])
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(extraArgs) {
+				return "", nil, nil, fmt.Errorf("%s needs a value", name)
+			}
+			i++
+			value = extraArgs[i]
+		}
+		if name == "--since" {
+			since = value
+			continue
+		}
+		for _, file := range strings.Split(value, ",") {
+			if file = strings.TrimSpace(file); file != "" {
+				files = append(files, filepath.ToSlash(filepath.Clean(file)))
+			}
+		}
+	}
+	return since, files, remaining, nil
+}
+
+// gitChangedFiles lists the files under the source directory that differ
+// from ref, committed or not, plus untracked ones, relative to it. git runs
+// in the runner environment, like every other command of the service.
+func (s *Runtime) gitChangedFiles(ctx context.Context, ref string) ([]string, error) {
+	var files []string
+	for _, args := range [][]string{
+		{"diff", "--name-only", "--relative", ref, "--"},
+		{"ls-files", "--others", "--exclude-standard"},
+	} {
+		proc, err := s.runnerEnvironment.NewProcess("git", args...)
+		if err != nil {
+			return nil, fmt.Errorf("create git process: %w", err)
+		}
+		var output bytes.Buffer
+		proc.WithOutput(&output)
+		if err := proc.Run(ctx); err != nil {
+			return nil, fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(output.String()))
+		}
+		files = appendGitFileList(files, output.String())
+	}
+	return files, nil
+}
+
+// appendGitFileList adds the paths git printed one per line to files,
+// skipping blanks and duplicates.
+func appendGitFileList(files []string, output string) []string {
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !slices.Contains(files, line) {
+			files = append(files, line)
+		}
+	}
+	return files
+}
+
+// testSelection is how a run was narrowed to the tests affected by changed
+// files. Triggers maps each changed file to the tests it selected; for Vitest
+// and Jest those are the tests importing it directly, the runner following
+// the rest of the import graph itself.
+type testSelection struct {
+	Strategy string              `json:"strategy"`
+	Since    string              `json:"since,omitempty"`
+	Changed  []string            `json:"changed_files"`
+	Triggers map[string][]string `json:"triggers,omitempty"`
+	// Reason explains a run that could not be narrowed.
+	Reason string `json:"reason,omitempty"`
+	// args select the tests on the runner's command line; related lists the
+	// files of `vitest related`, which replaces the package script.
+	args    []string
+	related []string
+}
+
+var (
+	// testFilePattern is the default test file naming of Vitest, Jest and
+	// Playwright.
+	testFilePattern    = regexp.MustCompile(`(\.(test|spec)\.[cm]?[jt]sx?$)|(/__tests__/)`)
+	importSpecifier    = regexp.MustCompile(`(?:\bfrom\s*|\bimport\s*\(\s*|\brequire\s*\(\s*|\bimport\s+)["']([^"']+)["']`)
+	visitedPathLiteral = regexp.MustCompile("[\"'`](/[^\"'`\\s?#]*)")
+)
+
+// planTestSelection narrows a run of runner to the tests affected by the
+// changed files, relative to sourceDir. Files that no longer exist are
+// dropped: the tests they touched changed too, or no longer import them.
+func planTestSelection(runner nodeTestRunner, sourceDir, since string, changed []string) (testSelection, error) {
+	selection := testSelection{Since: since, Triggers: map[string][]string{}}
+	for _, file := range changed {
+		if fileExists(filepath.Join(sourceDir, file)) {
+			selection.Changed = append(selection.Changed, file)
+		}
+	}
+	if len(selection.Changed) == 0 {
+		selection.Strategy = selectNone
+		selection.Reason = "no changed files"
+		return selection, nil
+	}
+	tests, err := discoverTestFiles(sourceDir)
+	if err != nil {
+		return testSelection{}, err
+	}
+
+	switch runner {
+	case nodeTestVitest, nodeTestJest:
+		selection.Triggers = directTestImporters(sourceDir, tests.unit, selection.Changed)
+		switch {
+		case runner == nodeTestJest:
+			selection.Strategy = selectJestRelated
+			// --findRelatedTests takes every argument after it.
+			selection.args = append([]string{"--passWithNoTests", "--findRelatedTests"}, selection.Changed...)
+		case since != "":
+			selection.Strategy = selectVitestChanged
+			selection.args = []string{"--changed=" + since, "--passWithNoTests"}
+		default:
+			selection.Strategy = selectVitestRelated
+			selection.args = []string{"--passWithNoTests"}
+			selection.related = selection.Changed
+		}
+	case nodeTestPlaywright:
+		return planPlaywrightSelection(selection, sourceDir, tests.e2e)
+	default:
+		return testSelection{}, fmt.Errorf("test runner %q cannot select tests by changed files", runner)
+	}
+	return selection, nil
+}
+
+// planPlaywrightSelection runs the changed specs and the specs visiting the
+// routes of changed route files. A changed layout covers the routes below it
+// and middleware every route. Any other changed file can affect any page, so
+// the whole suite runs.
+func planPlaywrightSelection(selection testSelection, sourceDir string, specs []string) (testSelection, error) {
+	routes, err := analyzeNextRoutes(sourceDir)
+	if err != nil && !errors.Is(err, errNoNextRouter) {
+		return testSelection{}, err
+	}
+	visits := map[string][]string{}
+	for _, spec := range specs {
+		source, err := os.ReadFile(filepath.Join(sourceDir, spec))
+		if err != nil {
+			return testSelection{}, fmt.Errorf("read %s: %w", spec, err)
+		}
+		for _, match := range visitedPathLiteral.FindAllStringSubmatch(string(source), -1) {
+			visits[spec] = append(visits[spec], match[1])
+		}
+	}
+
+	var selected []string
+	for _, file := range selection.Changed {
+		var triggered []string
+		switch index := slices.IndexFunc(routes, func(route nextRoute) bool { return route.File == file }); {
+		case slices.Contains(specs, file):
+			triggered = []string{file}
+		case index >= 0:
+			route := routes[index]
+			for _, spec := range specs {
+				if slices.ContainsFunc(visits[spec], func(visited string) bool { return routeCoversPath(route, visited) }) {
+					triggered = append(triggered, spec)
+				}
+			}
+		default:
+			selection.Strategy = selectAll
+			selection.Reason = fmt.Sprintf("%s is neither a route nor a spec", file)
+			selection.Triggers = nil
+			return selection, nil
+		}
+		selection.Triggers[file] = triggered
+		for _, spec := range triggered {
+			if !slices.Contains(selected, spec) {
+				selected = append(selected, spec)
+			}
+		}
+	}
+	if len(selected) == 0 {
+		selection.Strategy = selectNone
+		selection.Reason = "no spec visits the changed routes"
+		return selection, nil
+	}
+	slices.Sort(selected)
+	selection.Strategy = selectPlaywrightRoutes
+	selection.args = selected
+	return selection, nil
+}
+
+// routeCoversPath reports whether a path a spec visits renders through route.
+// Dynamic segments match any segment, and so does a template literal
+// placeholder in the visited path.
+func routeCoversPath(route nextRoute, visited string) bool {
+	switch route.Kind {
+	case nextRouteMiddleware:
+		return true
+	case nextRouteLayout:
+		return matchVisitedSegments(splitRoute(route.Pattern), splitRoute(visited), true)
+	default:
+		return matchVisitedSegments(splitRoute(route.Pattern), splitRoute(visited), false)
+	}
+}
+
+func matchVisitedSegments(pattern, visited []string, prefix bool) bool {
+	if len(pattern) == 0 {
+		return prefix || len(visited) == 0
+	}
+	if param, ok := parseNextDynamicSegment(pattern[0]); ok && param.CatchAll {
+		minimum := 1
+		if param.Optional {
+			minimum = 0
+		}
+		for take := minimum; take <= len(visited); take++ {
+			if matchVisitedSegments(pattern[1:], visited[take:], prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(visited) == 0 {
+		return false
+	}
+	if !isDynamicSegment(pattern[0]) && !strings.Contains(visited[0], "${") && pattern[0] != visited[0] {
+		return false
+	}
+	return matchVisitedSegments(pattern[1:], visited[1:], prefix)
+}
+
+// projectTestFiles are the test files of a project, relative to it: e2e ones
+// import @playwright/test, unit ones do not.
+type projectTestFiles struct {
+	unit []string
+	e2e  []string
+}
+
+func discoverTestFiles(sourceDir string) (projectTestFiles, error) {
+	var tests projectTestFiles
+	err := filepath.WalkDir(sourceDir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if file != sourceDir && (entry.Name() == "node_modules" || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relative, err := filepath.Rel(sourceDir, file)
+		if err != nil {
+			return err
+		}
+		relative = filepath.ToSlash(relative)
+		if !testFilePattern.MatchString("/" + relative) {
+			return nil
+		}
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(source, []byte("@playwright/test")) {
+			tests.e2e = append(tests.e2e, relative)
+		} else {
+			tests.unit = append(tests.unit, relative)
+		}
+		return nil
+	})
+	if err != nil {
+		return projectTestFiles{}, fmt.Errorf("discover test files: %w", err)
+	}
+	return tests, nil
+}
+
+// directTestImporters maps each changed file to the tests that are it or
+// import it directly, through a relative path or the @/ alias.
+func directTestImporters(sourceDir string, tests, changed []string) map[string][]string {
+	triggers := map[string][]string{}
+	imports := map[string][]string{}
+	for _, test := range tests {
+		source, err := os.ReadFile(filepath.Join(sourceDir, test))
+		if err != nil {
+			continue
+		}
+		for _, match := range importSpecifier.FindAllStringSubmatch(string(source), -1) {
+			imports[test] = append(imports[test], resolveImportCandidates(test, match[1])...)
+		}
+	}
+	for _, file := range changed {
+		module := strings.TrimSuffix(file, path.Ext(file))
+		var triggered []string
+		for _, test := range tests {
+			if test == file || slices.ContainsFunc(imports[test], func(candidate string) bool {
+				return candidate == module || candidate == module+"/index" || candidate == file
+			}) {
+				triggered = append(triggered, test)
+			}
+		}
+		triggers[file] = triggered
+	}
+	return triggers
+}
+
+// resolveImportCandidates resolves a specifier against the importing file,
+// or against the project root and src/ for the @/ alias. Bare package
+// specifiers resolve to nothing.
+func resolveImportCandidates(importer, specifier string) []string {
+	var candidates []string
+	switch {
+	case strings.HasPrefix(specifier, "./"), strings.HasPrefix(specifier, "../"):
+		candidates = []string{path.Join(path.Dir(importer), specifier)}
+	case strings.HasPrefix(specifier, "@/"):
+		rest := strings.TrimPrefix(specifier, "@/")
+		candidates = []string{path.Clean(rest), path.Join("src", rest)}
+	}
+	for i, candidate := range candidates {
+		if extension := path.Ext(candidate); extension != "" && slices.Contains([]string{".js", ".jsx", ".ts", ".tsx", ".mjs", ".cjs", ".mts", ".cts"}, extension) {
+			candidates[i] = strings.TrimSuffix(candidate, extension)
+		}
+	}
+	return candidates
+}
+
+// text reports the selection in the test output.
+func (s testSelection) text() string {
+	header := "Test selection: " + s.Strategy
+	if s.Since != "" {
+		header += fmt.Sprintf(" (changed since %s)", s.Since)
+	}
+	lines := []string{header}
+	if s.Reason != "" {
+		lines = append(lines, "  "+s.Reason)
+	}
+	for _, file := range s.Changed {
+		triggered, ok := s.Triggers[file]
+		switch {
+		case !ok:
+			lines = append(lines, "  "+file)
+		case len(triggered) == 0:
+			lines = append(lines, fmt.Sprintf("  %s -> no tests", file))
+		default:
+			lines = append(lines, fmt.Sprintf("  %s -> %s", file, strings.Join(triggered, ", ")))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// selectedTestCommand runs script with args and the selection's arguments
+// last, since --findRelatedTests takes everything after it. `vitest related`
+// is a command of its own, so it replaces the package script.
+func selectedTestCommand(manager *nodePackageManager, script string, selection *testSelection, args []string) []string {
+	if selection == nil {
+		return manager.runScriptArgs(script, args...)
+	}
+	if len(selection.related) > 0 {
+		return manager.execArgs("vitest", slices.Concat([]string{"related", "--run"}, selection.related, args, selection.args)...)
+	}
+	return manager.runScriptArgs(script, slices.Concat(args, selection.args)...)
+}
+
+// noSelectedTestsResponse passes a run the changed files select no tests for.
+func noSelectedTestsResponse(runner nodeTestRunner, suite string, selection testSelection) *runtimev0.TestResponse {
+	message := "no tests selected: " + selection.Reason
+	return &runtimev0.TestResponse{
+		Status: &runtimev0.TestStatus{State: runtimev0.TestStatus_SUCCESS, Message: message},
+		Run:    &runtimev0.TestRun{Runner: string(runner), SuiteName: suite},
+		Result: &runtimev0.TestRunResult{State: runtimev0.TestRunResult_PASSED, Message: message},
+		Counts: &runtimev0.TestCounts{},
+		Output: selection.text(),
+	}
+}
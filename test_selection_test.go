@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func selectionFixture(t *testing.T) string {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"app/layout.tsx":                 "export default function Root() {}",
+		"app/page.tsx":                   "export default function Home() {}",
+		"app/blog/[slug]/page.tsx":       "export default function Post() {}",
+		"app/docs/[[...path]]/page.tsx":  "export default function Docs() {}",
+		"src/lib/math.ts":                "export const add = (a, b) => a + b",
+		"src/lib/math.test.ts":           "import { add } from './math'",
+		"src/lib/format.ts":              "export const format = String",
+		"src/components/nav.tsx":         "export function Nav() {}",
+		"src/components/nav.test.tsx":    "import { Nav } from '@/components/nav.tsx'",
+		"e2e/home.spec.ts":               "import { test } from '@playwright/test'\ntest('home', async ({ page }) => { await page.goto('/') })",
+		"e2e/blog.spec.ts":               "import { test } from '@playwright/test'\ntest('post', async ({ page }) => { await page.goto(`/blog/${slug}?ref=x`) })",
+		"e2e/docs.spec.ts":               "import { test } from '@playwright/test'\ntest('docs', async ({ page }) => { await page.goto('/docs') })",
+		"node_modules/pkg/index.test.js": "ignored",
+	} {
+		writeProductionTestFile(t, dir, name, content)
+	}
+	return dir
+}
+
+func TestTestSelectionRequestReadsSinceAndChangedFiles(t *testing.T) {
+	since, files, args, err := testSelectionRequest([]string{"--since=main", "--changed", "src/a.ts,./src/b.ts", "--headed", "--changed=c.ts"})
+	require.NoError(t, err)
+	require.Equal(t, "main", since)
+	require.Equal(t, []string{"src/a.ts", "src/b.ts", "c.ts"}, files)
+	require.Equal(t, []string{"--headed"}, args)
+
+	_, _, _, err = testSelectionRequest([]string{"--since"})
+	require.Error(t, err)
+}
+
+func TestAppendGitFileListSkipsBlanksAndDuplicates(t *testing.T) {
+	files := appendGitFileList(nil, "src/a.ts\nsrc/b.ts\n\n")
+	files = appendGitFileList(files, "src/b.ts\n  src/new.ts  \n")
+	require.Equal(t, []string{"src/a.ts", "src/b.ts", "src/new.ts"}, files)
+}
+
+func TestPlanTestSelectionUsesJestRelatedTests(t *testing.T) {
+	dir := selectionFixture(t)
+	selection, err := planTestSelection(nodeTestJest, dir, "", []string{"src/lib/math.ts", "src/components/nav.tsx", "src/lib/format.ts", "deleted.ts"})
+	require.NoError(t, err)
+	require.Equal(t, selectJestRelated, selection.Strategy)
+	require.Equal(t, []string{"src/lib/math.ts", "src/components/nav.tsx", "src/lib/format.ts"}, selection.Changed, "deleted files are dropped")
+	require.Equal(t, []string{"--passWithNoTests", "--findRelatedTests", "src/lib/math.ts", "src/components/nav.tsx", "src/lib/format.ts"}, selection.args)
+	require.Equal(t, map[string][]string{
+		"src/lib/math.ts":        {"src/lib/math.test.ts"},
+		"src/components/nav.tsx": {"src/components/nav.test.tsx"},
+		"src/lib/format.ts":      nil,
+	}, selection.Triggers)
+
+	text := selection.text()
+	require.Contains(t, text, "Test selection: jest --findRelatedTests")
+	require.Contains(t, text, "src/lib/math.ts -> src/lib/math.test.ts")
+	require.Contains(t, text, "src/lib/format.ts -> no tests")
+}
+
+func TestPlanTestSelectionUsesVitestChangedOrRelated(t *testing.T) {
+	dir := selectionFixture(t)
+	selection, err := planTestSelection(nodeTestVitest, dir, "origin/main", []string{"src/lib/math.ts"})
+	require.NoError(t, err)
+	require.Equal(t, selectVitestChanged, selection.Strategy)
+	require.Equal(t, []string{"--changed=origin/main", "--passWithNoTests"}, selection.args)
+	require.Empty(t, selection.related)
+
+	selection, err = planTestSelection(nodeTestVitest, dir, "", []string{"src/lib/math.test.ts"})
+	require.NoError(t, err)
+	require.Equal(t, selectVitestRelated, selection.Strategy)
+	require.Equal(t, []string{"src/lib/math.test.ts"}, selection.related)
+	require.Equal(t, []string{"src/lib/math.test.ts"}, selection.Triggers["src/lib/math.test.ts"], "a changed test selects itself")
+}
+
+func TestPlanTestSelectionMapsRoutesToPlaywrightSpecs(t *testing.T) {
+	dir := selectionFixture(t)
+	selection, err := planTestSelection(nodeTestPlaywright, dir, "", []string{"app/blog/[slug]/page.tsx", "e2e/home.spec.ts"})
+	require.NoError(t, err)
+	require.Equal(t, selectPlaywrightRoutes, selection.Strategy)
+	require.Equal(t, []string{"e2e/blog.spec.ts", "e2e/home.spec.ts"}, selection.args)
+	require.Equal(t, []string{"e2e/blog.spec.ts"}, selection.Triggers["app/blog/[slug]/page.tsx"])
+
+	selection, err = planTestSelection(nodeTestPlaywright, dir, "", []string{"app/docs/[[...path]]/page.tsx"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"e2e/docs.spec.ts"}, selection.args, "an optional catch-all matches its base path")
+
+	selection, err = planTestSelection(nodeTestPlaywright, dir, "", []string{"app/layout.tsx"})
+	require.NoError(t, err)
+	require.Len(t, selection.args, 3, "the root layout covers every route")
+
+	selection, err = planTestSelection(nodeTestPlaywright, dir, "", []string{"src/components/nav.tsx"})
+	require.NoError(t, err)
+	require.Equal(t, selectAll, selection.Strategy)
+	require.Empty(t, selection.args)
+	require.Contains(t, selection.Reason, "src/components/nav.tsx")
+}
+
+func TestPlanTestSelectionWithoutChangesSelectsNothing(t *testing.T) {
+	dir := selectionFixture(t)
+	selection, err := planTestSelection(nodeTestJest, dir, "HEAD", nil)
+	require.NoError(t, err)
+	require.Equal(t, selectNone, selection.Strategy)
+	require.True(t, strings.HasPrefix(selection.text(), "Test selection: no tests (changed since HEAD)"))
+
+	_, err = planTestSelection(nodeTestGeneric, dir, "", []string{"src/lib/math.ts"})
+	require.Error(t, err)
+}
+
+func TestRouteCoversPath(t *testing.T) {
+	post := nextRoute{Pattern: "/blog/[slug]", Kind: nextRoutePage}
+	require.True(t, routeCoversPath(post, "/blog/hello"))
+	require.True(t, routeCoversPath(post, "/blog/${slug}"))
+	require.False(t, routeCoversPath(post, "/blog"))
+	require.False(t, routeCoversPath(post, "/blog/a/b"))
+
+	catchAll := nextRoute{Pattern: "/shop/[...path]", Kind: nextRoutePage}
+	require.True(t, routeCoversPath(catchAll, "/shop/a/b"))
+	require.False(t, routeCoversPath(catchAll, "/shop"))
+
+	layout := nextRoute{Pattern: "/blog", Kind: nextRouteLayout}
+	require.True(t, routeCoversPath(layout, "/blog/hello"))
+	require.False(t, routeCoversPath(layout, "/about"))
+	require.True(t, routeCoversPath(nextRoute{Pattern: "/*", Kind: nextRouteMiddleware}, "/anything"))
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	runtimev0 "github.com/codefly-dev/core/generated/go/codefly/services/runtime/v0"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// TestSettings tune how Runtime.Test runs the package's test scripts.
+type TestSettings struct {
+	// Parallelism splits each run into this many shards run concurrently on
+	// this machine. The --parallel=N extra argument overrides it for one run.
+	// Default: 1.
+	Parallelism int `yaml:"parallelism,omitempty"`
+	// Retries reruns the failed cases of a Vitest or Jest run up to this many
+	// times; cases that pass on a retry are reported flaky. Playwright gets it
+	// as its own --retries. The --retries=N extra argument overrides it.
+	Retries int `yaml:"retries,omitempty"`
+	// Coverage thresholds fail a run that collects coverage below them.
+	Coverage CoverageSettings `yaml:"coverage,omitempty"`
+	// Watch reruns affected tests on every change while the service runs.
+	Watch TestWatchSettings `yaml:"watch,omitempty"`
+}
+
+// testShard is one slice of a sharded run, numbered from 1 as Playwright,
+// Vitest and Jest number them in --shard=index/total.
+type testShard struct {
+	Index int
+	Total int
+}
+
+func (s testShard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Total)
+}
+
+// planTestShards reads the agent-owned --shard=i/n and --parallel=N extra
+// arguments and returns the shards to run here, with the remaining arguments
+// for the runner. --shard selects this machine's slice, as in CI; --parallel
+// splits that slice again into N shards run concurrently, so shard 2/3 with
+// parallelism 2 runs shards 3/6 and 4/6. No shards means an unsharded run.
+func planTestShards(extraArgs []string, parallelism int) ([]testShard, []string, error) {
+	var spec, parallel string
+	var remaining []string
+	for i := 0; i < len(extraArgs); i++ {
+		arg := extraArgs[i]
+		var target *string
+		name, value, hasValue := strings.Cut(arg, "=")
+		switch name {
+		case "--shard":
+			target = &spec
+		case "--parallel":
+			target = &parallel
+		default:
+			remaining = append(remaining, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(extraArgs) {
+				return nil, nil, fmt.Errorf("%s needs a value", name)
+			}
+			i++
+			value = extraArgs[i]
+		}
+		*target = value
+	}
+
+	if parallel != "" {
+		parsed, err := strconv.Atoi(parallel)
+		if err != nil || parsed < 1 {
+			return nil, nil, fmt.Errorf("--parallel must be a positive integer, got %q", parallel)
+		}
+		parallelism = parsed
+	}
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	base := testShard{Index: 1, Total: 1}
+	if spec != "" {
+		index, total, ok := strings.Cut(spec, "/")
+		var err error
+		if ok {
+			if base.Index, err = strconv.Atoi(index); err == nil {
+				base.Total, err = strconv.Atoi(total)
+			}
+		}
+		if !ok || err != nil || base.Total < 1 || base.Index < 1 || base.Index > base.Total {
+			return nil, nil, fmt.Errorf("--shard must be index/total with 1 <= index <= total, got %q", spec)
+		}
+	} else if parallelism == 1 {
+		return nil, remaining, nil
+	}
+
+	shards := make([]testShard, 0, parallelism)
+	for i := 1; i <= parallelism; i++ {
+		shards = append(shards, testShard{Index: (base.Index-1)*parallelism + i, Total: base.Total * parallelism})
+	}
+	return shards, remaining, nil
+}
+
+// shardArgs selects the shard in the runner's own syntax, which Playwright,
+// Vitest and Jest share. Concurrent Playwright shards also get their own
+// output directory: each run wipes it on start.
+func shardArgs(runner nodeTestRunner, shard testShard, concurrent bool) ([]string, error) {
+	switch runner {
+	case nodeTestPlaywright:
+		args := []string{"--shard=" + shard.String()}
+		if concurrent {
+			args = append(args, fmt.Sprintf("--output=test-results/shard-%d-of-%d", shard.Index, shard.Total))
+		}
+		return args, nil
+	case nodeTestVitest, nodeTestJest:
+		return []string{"--shard=" + shard.String()}, nil
+	default:
+		return nil, fmt.Errorf("test runner %q does not support sharding", runner)
+	}
+}
+
+// shardOutcome is what one concurrent shard produced. A shard that could not
+// run has a nil response or an error.
+type shardOutcome struct {
+	shard    testShard
+	response *runtimev0.TestResponse
+	err      error
+}
+
+// testRunStateRank orders outcomes from best to worst; unknown states sit
+// between a pass and a failure.
+func testRunStateRank(state runtimev0.TestRunResult_State) int {
+	switch state {
+	case runtimev0.TestRunResult_PASSED:
+		return 0
+	case runtimev0.TestRunResult_FAILED:
+		return 2
+	case runtimev0.TestRunResult_ERRORED:
+		return 3
+	default:
+		return 1
+	}
+}
+
+// mergeShardResponses combines concurrent shards into one response. Repeated
+// fields are concatenated and counts summed; every failure is prefixed with
+// its shard, and the duration is the wall-clock time of the whole run.
+func mergeShardResponses(outcomes []shardOutcome, duration time.Duration) *runtimev0.TestResponse {
+	merged := &runtimev0.TestResponse{}
+	counts := &runtimev0.TestCounts{}
+	state := runtimev0.TestRunResult_PASSED
+	var failedShards, erroredShards []string
+	var output []string
+	for _, outcome := range outcomes {
+		label := "shard " + outcome.shard.String()
+		response := outcome.response
+		if response == nil {
+			response = &runtimev0.TestResponse{}
+		} else {
+			response = proto.Clone(response).(*runtimev0.TestResponse)
+		}
+		shardState := response.GetResult().GetState()
+		if outcome.err != nil || response.GetResult() == nil {
+			shardState = runtimev0.TestRunResult_ERRORED
+			message := response.GetStatus().GetMessage()
+			if outcome.err != nil {
+				message = outcome.err.Error()
+			}
+			erroredShards = append(erroredShards, outcome.shard.String())
+			response.Failures = append(response.Failures, "shard did not complete: "+message)
+		} else if shardState != runtimev0.TestRunResult_PASSED {
+			failedShards = append(failedShards, outcome.shard.String())
+		}
+		if testRunStateRank(shardState) > testRunStateRank(state) {
+			state = shardState
+		}
+		for i, failure := range response.Failures {
+			response.Failures[i] = fmt.Sprintf("[%s] %s", label, failure)
+		}
+		if text := strings.TrimSpace(response.Output); text != "" {
+			output = append(output, fmt.Sprintf("== %s ==\n%s", label, text))
+		}
+		addCounts(counts, response.GetCounts())
+		response.Counts = nil
+		response.Output = ""
+		proto.Merge(merged, response)
+	}
+
+	merged.Counts = counts
+	merged.TestsRun = counts.Total
+	merged.TestsPassed = counts.Passed
+	merged.TestsFailed = counts.Failed
+	merged.TestsSkipped = counts.Skipped
+	merged.Output = strings.Join(output, "\n\n")
+	if merged.Run == nil {
+		merged.Run = &runtimev0.TestRun{}
+	}
+	merged.Run.Duration = durationpb.New(duration)
+
+	message := fmt.Sprintf("all tests passed in %d shard(s)", len(outcomes))
+	switch {
+	case len(erroredShards) > 0:
+		message = fmt.Sprintf("shard(s) %s did not complete", strings.Join(erroredShards, ", "))
+	case state != runtimev0.TestRunResult_PASSED:
+		message = fmt.Sprintf("%d test(s) failed in shard(s) %s", counts.Failed, strings.Join(failedShards, ", "))
+	}
+	merged.Result = &runtimev0.TestRunResult{State: state, Message: message}
+	statusState := runtimev0.TestStatus_SUCCESS
+	if state != runtimev0.TestRunResult_PASSED {
+		statusState = runtimev0.TestStatus_ERROR
+	}
+	merged.Status = &runtimev0.TestStatus{State: statusState, Message: message}
+	return merged
+}
+
+// addCounts adds the counts of one shard into total. Every integer field is a
+// count and summed, whatever the contract version declares; other fields are
+// merged as proto.Merge does.
+func addCounts(total, shard *runtimev0.TestCounts) {
+	if shard == nil {
+		return
+	}
+	sums := total.ProtoReflect()
+	rest := &runtimev0.TestCounts{}
+	shard.ProtoReflect().Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		current := sums.Get(field)
+		switch count := value.Interface().(type) {
+		case int32:
+			sums.Set(field, protoreflect.ValueOfInt32(int32(current.Int())+count))
+		case int64:
+			sums.Set(field, protoreflect.ValueOfInt64(current.Int()+count))
+		case uint32:
+			sums.Set(field, protoreflect.ValueOfUint32(uint32(current.Uint())+count))
+		case uint64:
+			sums.Set(field, protoreflect.ValueOfUint64(current.Uint()+count))
+		default:
+			rest.ProtoReflect().Set(field, value)
+		}
+		return true
+	})
+	proto.Merge(total, rest)
+}
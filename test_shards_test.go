@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	runtimev0 "github.com/codefly-dev/core/generated/go/codefly/services/runtime/v0"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestPlanTestShardsSplitsTheMachineSliceLocally(t *testing.T) {
+	shards, args, err := planTestShards([]string{"--headed"}, 0)
+	require.NoError(t, err)
+	require.Nil(t, shards, "no shard spec and no parallelism is an unsharded run")
+	require.Equal(t, []string{"--headed"}, args)
+
+	shards, args, err = planTestShards([]string{"--shard=2/3"}, 1)
+	require.NoError(t, err)
+	require.Equal(t, []testShard{{Index: 2, Total: 3}}, shards)
+	require.Empty(t, args)
+
+	shards, _, err = planTestShards([]string{"--shard", "2/3", "--parallel", "2"}, 1)
+	require.NoError(t, err)
+	require.Equal(t, []testShard{{Index: 3, Total: 6}, {Index: 4, Total: 6}}, shards)
+
+	shards, args, err = planTestShards([]string{"--retries=1"}, 3)
+	require.NoError(t, err)
+	require.Equal(t, []testShard{{Index: 1, Total: 3}, {Index: 2, Total: 3}, {Index: 3, Total: 3}}, shards)
+	require.Equal(t, []string{"--retries=1"}, args)
+
+	shards, _, err = planTestShards([]string{"--parallel=1"}, 4)
+	require.NoError(t, err)
+	require.Nil(t, shards, "--parallel overrides the setting")
+}
+
+func TestPlanTestShardsRejectsMalformedSpecs(t *testing.T) {
+	for _, args := range [][]string{{"--shard=3/2"}, {"--shard=0/2"}, {"--shard=1"}, {"--shard=a/b"}} {
+		_, _, err := planTestShards(args, 1)
+		require.ErrorContains(t, err, "--shard must be index/total", args)
+	}
+	_, _, err := planTestShards([]string{"--parallel=0"}, 1)
+	require.ErrorContains(t, err, "--parallel must be a positive integer")
+	_, _, err = planTestShards([]string{"--shard"}, 1)
+	require.ErrorContains(t, err, "--shard needs a value")
+}
+
+func TestShardArgsUseTheRunnerSyntax(t *testing.T) {
+	args, err := shardArgs(nodeTestVitest, testShard{Index: 1, Total: 4}, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"--shard=1/4"}, args)
+
+	args, err = shardArgs(nodeTestPlaywright, testShard{Index: 2, Total: 4}, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"--shard=2/4"}, args)
+	args, err = shardArgs(nodeTestPlaywright, testShard{Index: 2, Total: 4}, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"--shard=2/4", "--output=test-results/shard-2-of-4"}, args)
+
+	_, err = shardArgs(nodeTestGeneric, testShard{Index: 1, Total: 2}, true)
+	require.ErrorContains(t, err, "does not support sharding")
+}
+
+func TestMergeShardResponsesSumsCountsAndAttributesFailures(t *testing.T) {
+	passed := browserAuditTestResponse("vitest", "unit", 3, nil, "3 passed", "", time.Second)
+	failed := browserAuditTestResponse("vitest", "unit", 4, []string{"cart > totals: expected 3 to be 4"}, "1 failed", "1 failed", 2*time.Second)
+
+	merged := mergeShardResponses([]shardOutcome{
+		{shard: testShard{Index: 1, Total: 2}, response: passed},
+		{shard: testShard{Index: 2, Total: 2}, response: failed},
+	}, 2500*time.Millisecond)
+
+	require.Equal(t, runtimev0.TestRunResult_FAILED, merged.GetResult().GetState())
+	require.Equal(t, runtimev0.TestStatus_ERROR, merged.GetStatus().GetState())
+	require.Equal(t, "1 test(s) failed in shard(s) 2/2", merged.GetResult().GetMessage())
+	require.Equal(t, int32(7), merged.GetCounts().GetTotal())
+	require.Equal(t, int32(6), merged.GetCounts().GetPassed())
+	require.Equal(t, int32(1), merged.GetCounts().GetFailed())
+	require.Equal(t, int32(7), merged.TestsRun)
+	require.Equal(t, []string{"[shard 2/2] cart > totals: expected 3 to be 4"}, merged.Failures)
+	require.Equal(t, "== shard 2/2 ==\n1 failed", merged.Output)
+	require.Equal(t, 2500*time.Millisecond, merged.GetRun().GetDuration().AsDuration())
+	require.Equal(t, "vitest", merged.GetRun().GetRunner())
+	require.Equal(t, []string{"cart > totals: expected 3 to be 4"}, failed.Failures, "shard responses are not modified")
+}
+
+func TestMergeShardResponsesReportsShardsThatDidNotComplete(t *testing.T) {
+	passed := browserAuditTestResponse("playwright", "e2e", 2, nil, "2 passed", "", time.Second)
+
+	merged := mergeShardResponses([]shardOutcome{
+		{shard: testShard{Index: 1, Total: 2}, response: passed},
+		{shard: testShard{Index: 2, Total: 2}, err: errors.New("test runner produced no results")},
+	}, time.Second)
+
+	require.Equal(t, runtimev0.TestRunResult_ERRORED, merged.GetResult().GetState())
+	require.Equal(t, "shard(s) 2/2 did not complete", merged.GetResult().GetMessage())
+	require.Equal(t, []string{"[shard 2/2] shard did not complete: test runner produced no results"}, merged.Failures)
+	require.Equal(t, int32(2), merged.GetCounts().GetPassed())
+
+	merged = mergeShardResponses([]shardOutcome{
+		{shard: testShard{Index: 1, Total: 2}, response: passed},
+		{shard: testShard{Index: 2, Total: 2}, response: passed},
+	}, time.Second)
+	require.Equal(t, runtimev0.TestRunResult_PASSED, merged.GetResult().GetState())
+	require.Equal(t, "all tests passed in 2 shard(s)", merged.GetResult().GetMessage())
+	require.Equal(t, int32(4), merged.GetCounts().GetTotal())
+}
+
+func TestAddCountsSumsEveryTypedCount(t *testing.T) {
+	total := &runtimev0.TestCounts{}
+	addCounts(total, &runtimev0.TestCounts{Total: 5, Passed: 3, Failed: 1, Skipped: 1})
+	addCounts(total, &runtimev0.TestCounts{Total: 2, Passed: 2})
+	addCounts(total, nil)
+	require.Equal(t, int32(7), total.Total)
+	require.Equal(t, int32(5), total.Passed)
+	require.Equal(t, int32(1), total.Failed)
+	require.Equal(t, int32(1), total.Skipped)
+
+	// Counts beyond the four above are summed too.
+	total, shard := &runtimev0.TestCounts{}, &runtimev0.TestCounts{}
+	fields := shard.ProtoReflect().Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if field := fields.Get(i); field.Kind() == protoreflect.Int32Kind && !field.IsList() {
+			shard.ProtoReflect().Set(field, protoreflect.ValueOfInt32(3))
+		}
+	}
+	addCounts(total, shard)
+	addCounts(total, shard)
+	for i := 0; i < fields.Len(); i++ {
+		if field := fields.Get(i); field.Kind() == protoreflect.Int32Kind && !field.IsList() {
+			require.Equal(t, int64(6), total.ProtoReflect().Get(field).Int(), field.Name())
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codefly-dev/core/wool"
+)
+
+// TestWatchSettings turn on test-watch mode: the file watcher of hot reload
+// also reruns the Vitest or Jest tests each change affects, and streams the
+// results to the CLI.
+type TestWatchSettings struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Script is the package script to run. Default: test.
+	Script string `yaml:"script,omitempty"`
+	// Debounce gathers the changes of one save into one run, as a Go
+	// duration. Default: 300ms.
+	Debounce string `yaml:"debounce,omitempty"`
+}
+
+const defaultTestWatchDebounce = 300 * time.Millisecond
+
+func (w TestWatchSettings) script() string {
+	if w.Script == "" {
+		return "test"
+	}
+	return w.Script
+}
+
+func (w TestWatchSettings) debounce() (time.Duration, error) {
+	if w.Debounce == "" {
+		return defaultTestWatchDebounce, nil
+	}
+	debounce, err := time.ParseDuration(w.Debounce)
+	if err != nil || debounce < 0 {
+		return 0, fmt.Errorf("test.watch.debounce must be a non-negative duration, got %q", w.Debounce)
+	}
+	return debounce, nil
+}
+
+// testWatchFile is the outcome of one test file in a watch run.
+type testWatchFile struct {
+	File     string   `json:"file"`
+	Status   string   `json:"status"`
+	Passed   int      `json:"passed"`
+	Failed   int      `json:"failed"`
+	Skipped  int      `json:"skipped"`
+	Failures []string `json:"failures,omitempty"`
+}
+
+// parseTestWatchReport reads the per-file results of a Jest or Vitest JSON
+// report, with paths relative to sourceDir.
+func parseTestWatchReport(data []byte, sourceDir string) ([]testWatchFile, error) {
+	var report map[string]any
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("parse test report: %w", err)
+	}
+	files := []testWatchFile{}
+	results, _ := report["testResults"].([]any)
+	for _, result := range results {
+		values, _ := result.(map[string]any)
+		name, _ := values["name"].(string)
+		status, _ := values["status"].(string)
+		file := testWatchFile{File: coveragePath(name, sourceDir), Status: status}
+		assertions, _ := values["assertionResults"].([]any)
+		for _, entry := range assertions {
+			assertion, _ := entry.(map[string]any)
+			switch assertion["status"] {
+			case "passed":
+				file.Passed++
+			case "failed":
+				file.Failed++
+				file.Failures = append(file.Failures, jestFullName(assertion))
+			default:
+				file.Skipped++
+			}
+		}
+		// A file that failed outside its cases, such as on a syntax error,
+		// has only its message to show for it.
+		if message, _ := values["message"].(string); status == "failed" && file.Failed == 0 && message != "" {
+			file.Failures = append(file.Failures, firstLine(message))
+		}
+		if file.Failed > 0 {
+			file.Status = "failed"
+		}
+		files = append(files, file)
+	}
+	slices.SortFunc(files, func(a, b testWatchFile) int { return strings.Compare(a.File, b.File) })
+	return files, nil
+}
+
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	return line
+}
+
+// testWatchRun is what one rerun produced.
+type testWatchRun struct {
+	Strategy string
+	Files    []testWatchFile
+}
+
+// testWatchUpdate is streamed after every rerun. NewlyFailing lists the
+// tests that failed now but not in the previous run of their file; Fixed the
+// ones that failed then and pass now.
+type testWatchUpdate struct {
+	Run          int             `json:"run"`
+	Changed      []string        `json:"changed_files"`
+	Strategy     string          `json:"strategy,omitempty"`
+	Files        []testWatchFile `json:"files"`
+	Passed       int             `json:"passed"`
+	Failed       int             `json:"failed"`
+	NewlyFailing []string        `json:"newly_failing,omitempty"`
+	Fixed        []string        `json:"fixed,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	DurationMs   int64           `json:"duration_ms"`
+}
+
+func (u testWatchUpdate) text() string {
+	header := fmt.Sprintf("Test watch #%d (%s): ", u.Run, strings.Join(u.Changed, ", "))
+	switch {
+	case u.Error != "":
+		return header + "error: " + u.Error
+	case len(u.Files) == 0:
+		return header + "no affected tests"
+	}
+	lines := []string{header + fmt.Sprintf("%d file(s), %d passed, %d failed in %s",
+		len(u.Files), u.Passed, u.Failed, (time.Duration(u.DurationMs)*time.Millisecond).String())}
+	for _, file := range u.Files {
+		lines = append(lines, fmt.Sprintf("  %s %s (%d passed, %d failed)", strings.ToUpper(file.Status), file.File, file.Passed, file.Failed))
+	}
+	if len(u.NewlyFailing) > 0 {
+		lines = append(lines, "  newly failing: "+strings.Join(u.NewlyFailing, "; "))
+	}
+	if len(u.Fixed) > 0 {
+		lines = append(lines, "  fixed: "+strings.Join(u.Fixed, "; "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// testWatcher reruns tests on file changes, one run at a time. Changes made
+// during a run are gathered for the next one.
+type testWatcher struct {
+	debounce time.Duration
+	// run tests the changed files.
+	run func(ctx context.Context, changed []string) (testWatchRun, error)
+	// publish streams each update.
+	publish func(testWatchUpdate)
+
+	mu      sync.Mutex
+	pending []string
+	wake    chan struct{}
+	// failing holds the failing tests of the last run of each file, as
+	// "file › test".
+	failing map[string][]string
+	runs    int
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newTestWatcher(debounce time.Duration, run func(context.Context, []string) (testWatchRun, error), publish func(testWatchUpdate)) *testWatcher {
+	return &testWatcher{
+		debounce: debounce,
+		run:      run,
+		publish:  publish,
+		wake:     make(chan struct{}, 1),
+		failing:  map[string][]string{},
+	}
+}
+
+func (w *testWatcher) start(ctx context.Context) {
+	ctx, w.cancel = context.WithCancel(ctx)
+	w.done = make(chan struct{})
+	go func() {
+		defer close(w.done)
+		w.loop(ctx)
+	}()
+}
+
+// stop cancels the watcher and waits for an in-flight run to unwind.
+func (w *testWatcher) stop() {
+	if w == nil || w.cancel == nil {
+		return
+	}
+	w.cancel()
+	<-w.done
+}
+
+// changed queues a changed file, relative to the source directory.
+func (w *testWatcher) changed(file string) {
+	w.mu.Lock()
+	if !slices.Contains(w.pending, file) {
+		w.pending = append(w.pending, file)
+	}
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *testWatcher) loop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		}
+		// Let a burst of saves settle into one run.
+		timer := time.NewTimer(w.debounce)
+	settle:
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-w.wake:
+				timer.Reset(w.debounce)
+			case <-timer.C:
+				break settle
+			}
+		}
+		w.mu.Lock()
+		changed := w.pending
+		w.pending = nil
+		w.mu.Unlock()
+		if len(changed) == 0 {
+			continue
+		}
+		started := time.Now()
+		run, err := w.run(ctx, changed)
+		if ctx.Err() != nil {
+			return
+		}
+		w.publish(w.update(changed, run, err, time.Since(started)))
+	}
+}
+
+// update compares a run with the previous runs of the same files.
+func (w *testWatcher) update(changed []string, run testWatchRun, err error, duration time.Duration) testWatchUpdate {
+	w.runs++
+	update := testWatchUpdate{Run: w.runs, Changed: changed, Strategy: run.Strategy, Files: run.Files, DurationMs: duration.Milliseconds()}
+	if err != nil {
+		update.Error = err.Error()
+		return update
+	}
+	for _, file := range run.Files {
+		update.Passed += file.Passed
+		update.Failed += file.Failed
+		var failing []string
+		for _, failure := range file.Failures {
+			failing = append(failing, file.File+" › "+failure)
+		}
+		for _, test := range failing {
+			if !slices.Contains(w.failing[file.File], test) {
+				update.NewlyFailing = append(update.NewlyFailing, test)
+			}
+		}
+		for _, test := range w.failing[file.File] {
+			if !slices.Contains(failing, test) {
+				update.Fixed = append(update.Fixed, test)
+			}
+		}
+		w.failing[file.File] = failing
+	}
+	return update
+}
+
+// testWatchReportFile holds the latest update for tools polling it.
+var testWatchReportFile = filepath.Join(".codefly", "test-output", "watch-latest.json")
+
+// startTestWatch starts test-watch mode when test.watch enables it and the
+// watched script runs Vitest or Jest. It first stops the watcher of a
+// previous Init, which would otherwise keep rerunning tests alongside.
+func (s *Runtime) startTestWatch(ctx context.Context) error {
+	s.stopTestWatch()
+	settings := s.Settings.Test.Watch
+	if !settings.Enabled {
+		return nil
+	}
+	debounce, err := settings.debounce()
+	if err != nil {
+		return err
+	}
+	manifest, err := readNodePackageManifest(s.sourceLocation)
+	if err != nil {
+		return err
+	}
+	script := settings.script()
+	if !manifest.hasScript(script) {
+		return fmt.Errorf("package.json has no %q script to watch", script)
+	}
+	runner := manifest.testRunner(script)
+	if runner != nodeTestVitest && runner != nodeTestJest {
+		return fmt.Errorf("test watch runs Vitest or Jest, but script %q runs %s", script, runner)
+	}
+	s.testWatcher = newTestWatcher(debounce, func(ctx context.Context, changed []string) (testWatchRun, error) {
+		return s.runWatchedTests(ctx, script, runner, changed)
+	}, s.publishTestWatchUpdate)
+	s.testWatcher.start(ctx)
+	s.Wool.Forwardf("test watch: rerunning %s tests of %q on change", runner, script)
+	return nil
+}
+
+func (s *Runtime) stopTestWatch() {
+	s.testWatcher.stop()
+	s.testWatcher = nil
+}
+
+// runWatchedTests runs the tests the changed files affect.
+func (s *Runtime) runWatchedTests(ctx context.Context, script string, runner nodeTestRunner, changed []string) (testWatchRun, error) {
+	selection, err := planTestSelection(runner, s.sourceLocation, "", changed)
+	if err != nil {
+		return testWatchRun{}, err
+	}
+	run := testWatchRun{Strategy: selection.Strategy, Files: []testWatchFile{}}
+	if selection.Strategy == selectNone {
+		return run, nil
+	}
+	if err := s.ensureNodeDependencies(ctx); err != nil {
+		return run, fmt.Errorf("prepare Node.js dependencies: %w", err)
+	}
+	manager, err := s.resolvePackageManager()
+	if err != nil {
+		return run, err
+	}
+	envs, err := s.EnvironmentVariables.All()
+	if err != nil {
+		return run, err
+	}
+	jsonFile := filepath.Join(s.sourceLocation, ".codefly", "test-output", fmt.Sprintf("watch-%d.json", time.Now().UnixNano()))
+	if err := os.MkdirAll(filepath.Dir(jsonFile), 0o755); err != nil {
+		return run, fmt.Errorf("create test cache dir: %w", err)
+	}
+	defer os.Remove(jsonFile)
+	reporterArgs, reporterEnvs := nodeTestReporterConfiguration(runner, jsonFile)
+	args := selectedTestCommand(manager, script, &selection, reporterArgs)
+	attempt, err := s.runNodeTestAttempt(ctx, manager, args, append(envs, reporterEnvs...), jsonFile)
+	if err != nil {
+		return run, err
+	}
+	if len(attempt.jsonBytes) == 0 {
+		return run, errors.Join(fmt.Errorf("the test runner wrote no report"), attempt.runErr)
+	}
+	run.Files, err = parseTestWatchReport(attempt.jsonBytes, s.sourceLocation)
+	return run, err
+}
+
+func (s *Runtime) publishTestWatchUpdate(update testWatchUpdate) {
+	s.Wool.Forwardf("%s", update.text())
+	s.Wool.Info("test watch run",
+		wool.Field("run", update.Run),
+		wool.Field("passed", update.Passed),
+		wool.Field("failed", update.Failed),
+		wool.Field("newly_failing", update.NewlyFailing))
+	data, err := json.MarshalIndent(update, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(filepath.Join(s.sourceLocation, testWatchReportFile), data, 0o644); err != nil {
+		s.Wool.Warn("cannot write test watch report", wool.ErrField(err))
+	}
+}
+
+// watchedSourcePath makes a watcher event path relative to the source
+// directory. Paths outside it, such as service.codefly.yaml, are not source,
+// and neither are the directories the agent and tooling write to.
+func (s *Runtime) watchedSourcePath(path string) (string, bool) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.Location, path)
+	}
+	relative, err := filepath.Rel(s.sourceLocation, path)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	relative = filepath.ToSlash(relative)
+	if top, _, _ := strings.Cut(relative, "/"); slices.Contains(generatedSourceDirs, top) {
+		return "", false
+	}
+	return relative, true
+}
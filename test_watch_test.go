@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTestWatchReportReadsEachFile(t *testing.T) {
+	files, err := parseTestWatchReport([]byte(`{"testResults": [
+	  {"name": "/app/src/pay.test.ts", "status": "failed", "message": "SyntaxError: Unexpected token\n  at pay.test.ts:3", "assertionResults": []},
+	  {"name": "/app/src/cart.test.ts", "status": "failed", "assertionResults": [
+	    {"ancestorTitles": ["cart"], "title": "adds", "status": "passed"},
+	    {"ancestorTitles": ["cart"], "title": "empties", "status": "failed"},
+	    {"ancestorTitles": ["cart"], "title": "later", "status": "pending"}
+	  ]}
+	]}`), "/app")
+	require.NoError(t, err)
+	require.Equal(t, []testWatchFile{
+		{File: "src/cart.test.ts", Status: "failed", Passed: 1, Failed: 1, Skipped: 1, Failures: []string{"cart empties"}},
+		{File: "src/pay.test.ts", Status: "failed", Failures: []string{"SyntaxError: Unexpected token"}},
+	}, files)
+}
+
+func TestTestWatcherReportsNewlyFailingAndFixedTests(t *testing.T) {
+	watcher := newTestWatcher(0, nil, nil)
+	first := watcher.update([]string{"src/cart.ts"}, testWatchRun{Files: []testWatchFile{
+		{File: "src/cart.test.ts", Status: "failed", Passed: 1, Failed: 1, Failures: []string{"cart empties"}},
+		{File: "src/pay.test.ts", Status: "failed", Failed: 1, Failures: []string{"pays"}},
+	}}, nil, time.Second)
+	require.Equal(t, 1, first.Run)
+	require.Equal(t, 1, first.Passed)
+	require.Equal(t, 2, first.Failed)
+	require.Equal(t, []string{"src/cart.test.ts › cart empties", "src/pay.test.ts › pays"}, first.NewlyFailing)
+
+	second := watcher.update([]string{"src/cart.ts"}, testWatchRun{Files: []testWatchFile{
+		{File: "src/cart.test.ts", Status: "failed", Passed: 1, Failed: 1, Failures: []string{"cart adds"}},
+	}}, nil, time.Second)
+	require.Equal(t, []string{"src/cart.test.ts › cart adds"}, second.NewlyFailing)
+	require.Equal(t, []string{"src/cart.test.ts › cart empties"}, second.Fixed)
+
+	third := watcher.update([]string{"src/pay.ts"}, testWatchRun{Files: []testWatchFile{
+		{File: "src/pay.test.ts", Status: "failed", Failed: 1, Failures: []string{"pays"}},
+	}}, nil, time.Second)
+	require.Empty(t, third.NewlyFailing, "a test failing again is not newly failing")
+	require.Contains(t, third.text(), "Test watch #3 (src/pay.ts): 1 file(s), 0 passed, 1 failed in 1s")
+	require.Contains(t, third.text(), "FAILED src/pay.test.ts (0 passed, 1 failed)")
+
+	failed := watcher.update([]string{"src/pay.ts"}, testWatchRun{}, errors.New("runner crashed"), 0)
+	require.Equal(t, "Test watch #4 (src/pay.ts): error: runner crashed", failed.text())
+}
+
+func TestTestWatcherGathersChangesIntoOneRun(t *testing.T) {
+	var mu sync.Mutex
+	var runs [][]string
+	updates := make(chan testWatchUpdate, 4)
+	watcher := newTestWatcher(20*time.Millisecond, func(_ context.Context, changed []string) (testWatchRun, error) {
+		mu.Lock()
+		runs = append(runs, changed)
+		mu.Unlock()
+		return testWatchRun{Strategy: selectVitestRelated}, nil
+	}, func(update testWatchUpdate) { updates <- update })
+	watcher.start(context.Background())
+	defer watcher.stop()
+
+	watcher.changed("src/a.ts")
+	watcher.changed("src/b.ts")
+	watcher.changed("src/a.ts")
+	select {
+	case update := <-updates:
+		require.Equal(t, []string{"src/a.ts", "src/b.ts"}, update.Changed)
+		require.Equal(t, "Test watch #1 (src/a.ts, src/b.ts): no affected tests", update.text())
+	case <-time.After(5 * time.Second):
+		t.Fatal("no test watch update")
+	}
+	mu.Lock()
+	require.Len(t, runs, 1)
+	mu.Unlock()
+}
+
+func TestTestWatchSettingsDefaults(t *testing.T) {
+	debounce, err := TestWatchSettings{}.debounce()
+	require.NoError(t, err)
+	require.Equal(t, defaultTestWatchDebounce, debounce)
+	require.Equal(t, "test", TestWatchSettings{}.script())
+
+	_, err = TestWatchSettings{Debounce: "soon"}.debounce()
+	require.Error(t, err)
+}
@@ -46,6 +46,17 @@ func nextValidationCapabilities() *agentv0.ValidationCapabilities {
 					Name:           "smoke",
 					DependencyMode: agentv0.TestDependencyMode_TEST_DEPENDENCY_MODE_START_STACK,
 				},
+				{
+					// axe-core audits of the running frontend's pages; the
+					// suite needs no package script.
+					Name:           "a11y",
+					DependencyMode: agentv0.TestDependencyMode_TEST_DEPENDENCY_MODE_START_STACK,
+				},
+				{
+					// Screenshot diffs against .codefly/visual-baselines.
+					Name:           "visual",
+					DependencyMode: agentv0.TestDependencyMode_TEST_DEPENDENCY_MODE_START_STACK,
+				},
 			},
 		},
 		Audit:         validationOperation(workspace),
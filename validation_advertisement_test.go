@@ -43,4 +43,14 @@ func TestFrontendTestSuitesDeclareTheirProductionGraph(t *testing.T) {
 		agentv0.TestDependencyMode_TEST_DEPENDENCY_MODE_START_STACK,
 		suites["smoke"].GetDependencyMode(),
 	)
+	require.Equal(
+		t,
+		agentv0.TestDependencyMode_TEST_DEPENDENCY_MODE_START_STACK,
+		suites["a11y"].GetDependencyMode(),
+	)
+	require.Equal(
+		t,
+		agentv0.TestDependencyMode_TEST_DEPENDENCY_MODE_START_STACK,
+		suites["visual"].GetDependencyMode(),
+	)
 }
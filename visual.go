@@ -0,0 +1,441 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// VisualSettings configures the `visual` command and test suite: which
+// routes are screenshotted at which viewports, and how much may change.
+//
+//	visual:
+//	  routes: [/, /pricing]
+//	  viewports:
+//	    - {name: mobile, width: 390, height: 844}
+//	    - {name: desktop, width: 1280, height: 800}
+//	  tolerance: 0.001
+type VisualSettings struct {
+	// Routes to screenshot. Default: /.
+	Routes []string `yaml:"routes,omitempty"`
+	// Viewports to screenshot each route at. Default: desktop 1280x720.
+	Viewports []VisualViewport `yaml:"viewports,omitempty"`
+	// Tolerance is the fraction of pixels allowed to differ from the
+	// baseline, from 0 (identical) to 1. Default: 0.
+	Tolerance float64 `yaml:"tolerance,omitempty"`
+	// PixelThreshold is how far a pixel's color may move before it counts
+	// as different, from 0 to 1 of the channel range. Default: 0.1, which
+	// absorbs anti-aliasing noise; 0 requires an exact match.
+	PixelThreshold *float64 `yaml:"pixel-threshold,omitempty"`
+}
+
+type VisualViewport struct {
+	Name   string `yaml:"name" json:"name"`
+	Width  int    `yaml:"width" json:"width"`
+	Height int    `yaml:"height" json:"height"`
+}
+
+const (
+	visualBaselineDir      = "visual-baselines"
+	visualOutputDir        = "visual-output"
+	defaultVisualPixelDiff = 0.1
+	visualResultMarker     = "CODEFLY_VISUAL "
+)
+
+var defaultVisualViewport = VisualViewport{Name: "desktop", Width: 1280, Height: 720}
+
+const (
+	visualPassed          = "passed"
+	visualFailed          = "failed"
+	visualMissingBaseline = "missing-baseline"
+	visualUpdated         = "updated"
+	visualError           = "error"
+)
+
+// visualShot is one route at one viewport, and where its images live.
+type visualShot struct {
+	Route    string `json:"route"`
+	Viewport string `json:"viewport"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	// File is where the capture script writes the screenshot.
+	File     string `json:"file"`
+	baseline string
+	diff     string
+}
+
+// visualCaptureRequest is the JSON the capture script reads from
+// CODEFLY_VISUAL_REQUEST.
+type visualCaptureRequest struct {
+	BaseURL   string       `json:"baseURL"`
+	TimeoutMs int          `json:"timeoutMs"`
+	Shots     []visualShot `json:"shots"`
+}
+
+type visualCapture struct {
+	File   string `json:"file"`
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// visualResult is the comparison of one shot against its baseline.
+type visualResult struct {
+	Route      string  `json:"route"`
+	Viewport   string  `json:"viewport"`
+	Status     string  `json:"status"`
+	DiffPixels int     `json:"diff_pixels,omitempty"`
+	DiffRatio  float64 `json:"diff_ratio,omitempty"`
+	Baseline   string  `json:"baseline"`
+	Actual     string  `json:"actual,omitempty"`
+	Diff       string  `json:"diff,omitempty"`
+	Message    string  `json:"message,omitempty"`
+}
+
+type visualReport struct {
+	Passed  bool           `json:"passed"`
+	Updated bool           `json:"updated,omitempty"`
+	Results []visualResult `json:"results"`
+}
+
+func (v VisualSettings) validate() error {
+	if v.Tolerance < 0 || v.Tolerance > 1 {
+		return fmt.Errorf("visual.tolerance must be between 0 and 1")
+	}
+	if v.PixelThreshold != nil && (*v.PixelThreshold < 0 || *v.PixelThreshold > 1) {
+		return fmt.Errorf("visual.pixel-threshold must be between 0 and 1")
+	}
+	seen := map[string]bool{}
+	for i, viewport := range v.Viewports {
+		if viewport.Name == "" || viewport.Width <= 0 || viewport.Height <= 0 {
+			return fmt.Errorf("visual.viewports[%d] needs a name and a positive width and height", i)
+		}
+		if seen[viewport.Name] {
+			return fmt.Errorf("visual.viewports[%d]: duplicate name %q", i, viewport.Name)
+		}
+		seen[viewport.Name] = true
+	}
+	return nil
+}
+
+func (v VisualSettings) pixelThreshold() float64 {
+	if v.PixelThreshold == nil {
+		return defaultVisualPixelDiff
+	}
+	return *v.PixelThreshold
+}
+
+// shots plans the screenshots of a run. Baselines live under
+// <source>/.codefly/visual-baselines and are meant to be committed; captures
+// and diff images go to .codefly/visual-output, which each run replaces.
+func (v VisualSettings) shots(sourceDir string, requested []string) ([]visualShot, error) {
+	if err := v.validate(); err != nil {
+		return nil, err
+	}
+	routes := requested
+	if len(routes) == 0 {
+		routes = v.Routes
+	}
+	if len(routes) == 0 {
+		routes = []string{"/"}
+	}
+	viewports := v.Viewports
+	if len(viewports) == 0 {
+		viewports = []VisualViewport{defaultVisualViewport}
+	}
+	cache := filepath.Join(sourceDir, ".codefly")
+	var shots []visualShot
+	for _, route := range routes {
+		if !strings.HasPrefix(route, "/") {
+			return nil, fmt.Errorf("visual route %q must be a path starting with /", route)
+		}
+		for _, viewport := range viewports {
+			name := visualShotName(route, viewport.Name)
+			shots = append(shots, visualShot{
+				Route:    route,
+				Viewport: viewport.Name,
+				Width:    viewport.Width,
+				Height:   viewport.Height,
+				File:     filepath.Join(cache, visualOutputDir, "actual", name),
+				baseline: filepath.Join(cache, visualBaselineDir, name),
+				diff:     filepath.Join(cache, visualOutputDir, "diff", name),
+			})
+		}
+	}
+	return shots, nil
+}
+
+var visualUnsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// visualShotName is the image file name of a route at a viewport:
+// /blog/hello at mobile is blog_hello@mobile.png, / is index@mobile.png.
+func visualShotName(route, viewport string) string {
+	name := strings.Trim(visualUnsafeName.ReplaceAllString(strings.Trim(route, "/"), "_"), "_")
+	if name == "" {
+		name = "index"
+	}
+	return fmt.Sprintf("%s@%s.png", name, visualUnsafeName.ReplaceAllString(viewport, "_"))
+}
+
+// compareVisualShots compares each capture with its baseline and writes a
+// diff image for each failure. With update, captures become the baselines.
+func (v VisualSettings) compareVisualShots(shots []visualShot, captures []visualCapture, update bool) visualReport {
+	byFile := map[string]visualCapture{}
+	for _, capture := range captures {
+		byFile[capture.File] = capture
+	}
+	report := visualReport{Passed: true, Updated: update}
+	for _, shot := range shots {
+		result := visualResult{Route: shot.Route, Viewport: shot.Viewport, Baseline: shot.baseline, Actual: shot.File}
+		capture, ok := byFile[shot.File]
+		switch {
+		case !ok:
+			result.Status, result.Message = visualError, "no screenshot was captured"
+		case capture.Error != "":
+			result.Status, result.Message = visualError, capture.Error
+		case capture.Status >= 400:
+			result.Status, result.Message = visualError, fmt.Sprintf("HTTP %d", capture.Status)
+		case update:
+			result.Status = visualUpdated
+			if err := copyFile(shot.File, shot.baseline); err != nil {
+				result.Status, result.Message = visualError, err.Error()
+			}
+		default:
+			v.compareVisualShot(shot, &result)
+		}
+		if result.Status == visualFailed || result.Status == visualMissingBaseline || result.Status == visualError {
+			report.Passed = false
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+func (v VisualSettings) compareVisualShot(shot visualShot, result *visualResult) {
+	baseline, err := readPNG(shot.baseline)
+	if errors.Is(err, os.ErrNotExist) {
+		result.Status, result.Message = visualMissingBaseline, "no baseline: accept this screenshot with --update"
+		return
+	}
+	if err != nil {
+		result.Status, result.Message = visualError, err.Error()
+		return
+	}
+	actual, err := readPNG(shot.File)
+	if err != nil {
+		result.Status, result.Message = visualError, err.Error()
+		return
+	}
+	differing, total, diff := diffImages(baseline, actual, v.pixelThreshold())
+	result.DiffPixels = differing
+	result.DiffRatio = float64(differing) / float64(total)
+	if result.DiffRatio <= v.Tolerance {
+		result.Status = visualPassed
+		return
+	}
+	result.Status = visualFailed
+	result.Message = fmt.Sprintf("%d pixels (%.3f%%) differ, tolerance %.3f%%", differing, result.DiffRatio*100, v.Tolerance*100)
+	if baseline.Bounds().Size() != actual.Bounds().Size() {
+		result.Message += fmt.Sprintf("; size changed from %v to %v", baseline.Bounds().Size(), actual.Bounds().Size())
+	}
+	if err := writePNG(shot.diff, diff); err != nil {
+		result.Message += fmt.Sprintf("; cannot write diff image: %v", err)
+		return
+	}
+	result.Diff = shot.diff
+}
+
+// diffImages compares two images pixel by pixel over the union of their
+// bounds; pixels present in only one image differ. A pixel differs when any
+// channel moves by more than threshold of its range. The diff image is the
+// actual screenshot faded to gray with differing pixels in red.
+func diffImages(baseline, actual image.Image, threshold float64) (differing, total int, diff *image.RGBA) {
+	bb, ab := baseline.Bounds(), actual.Bounds()
+	width := max(bb.Dx(), ab.Dx())
+	height := max(bb.Dy(), ab.Dy())
+	diff = image.NewRGBA(image.Rect(0, 0, width, height))
+	limit := uint32(threshold * 0xffff)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			inBaseline := x < bb.Dx() && y < bb.Dy()
+			inActual := x < ab.Dx() && y < ab.Dy()
+			same := inBaseline && inActual &&
+				colorsClose(baseline.At(bb.Min.X+x, bb.Min.Y+y), actual.At(ab.Min.X+x, ab.Min.Y+y), limit)
+			if !same {
+				differing++
+				diff.Set(x, y, color.RGBA{R: 0xff, A: 0xff})
+				continue
+			}
+			gray := color.GrayModel.Convert(actual.At(ab.Min.X+x, ab.Min.Y+y)).(color.Gray)
+			faded := 0xff - (0xff-gray.Y)/4
+			diff.Set(x, y, color.RGBA{R: faded, G: faded, B: faded, A: 0xff})
+		}
+	}
+	return differing, width * height, diff
+}
+
+func colorsClose(left, right color.Color, limit uint32) bool {
+	lr, lg, lb, la := left.RGBA()
+	rr, rg, rb, ra := right.RGBA()
+	return channelDelta(lr, rr) <= limit && channelDelta(lg, rg) <= limit &&
+		channelDelta(lb, rb) <= limit && channelDelta(la, ra) <= limit
+}
+
+func channelDelta(left, right uint32) uint32 {
+	if left > right {
+		return left - right
+	}
+	return right - left
+}
+
+func readPNG(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	decoded, err := png.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return decoded, nil
+}
+
+func writePNG(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("encode %s: %w", path, err)
+	}
+	return file.Close()
+}
+
+func copyFile(source, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(destination), 0o755); err != nil {
+		return err
+	}
+	out, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("copy %s to %s: %w", source, destination, err)
+	}
+	return out.Close()
+}
+
+// evidence is one entry per failing shot.
+func (r visualReport) evidence() []string {
+	var evidence []string
+	for _, result := range r.Results {
+		if result.Status == visualPassed || result.Status == visualUpdated {
+			continue
+		}
+		entry := fmt.Sprintf("%s @ %s: %s: %s", result.Route, result.Viewport, result.Status, result.Message)
+		if result.Diff != "" {
+			entry += "\n  diff: " + result.Diff
+		}
+		evidence = append(evidence, entry)
+	}
+	return evidence
+}
+
+// summary is the test status message of the visual suite.
+func (r visualReport) summary() string {
+	switch {
+	case r.Updated && r.Passed:
+		return fmt.Sprintf("%d visual baseline(s) updated", len(r.Results))
+	case r.Passed:
+		return fmt.Sprintf("%d screenshot(s) match their baselines", len(r.Results))
+	default:
+		return fmt.Sprintf("%d of %d screenshot(s) differ from their baselines", len(r.evidence()), len(r.Results))
+	}
+}
+
+func (r visualReport) text() string {
+	var out strings.Builder
+	for _, result := range r.Results {
+		fmt.Fprintf(&out, "%s @ %s: %s", result.Route, result.Viewport, result.Status)
+		if result.Message != "" {
+			fmt.Fprintf(&out, " (%s)", result.Message)
+		}
+		if result.Diff != "" {
+			fmt.Fprintf(&out, " diff: %s", result.Diff)
+		}
+		out.WriteString("\n")
+	}
+	switch {
+	case r.Updated && r.Passed:
+		fmt.Fprintf(&out, "Visual baselines updated: %d", len(r.Results))
+	case r.Passed:
+		fmt.Fprintf(&out, "Visual PASSED: %d screenshot(s) match their baselines", len(r.Results))
+	default:
+		fmt.Fprintf(&out, "Visual FAILED: %d of %d screenshot(s)", len(r.evidence()), len(r.Results))
+	}
+	return out.String()
+}
+
+func (r visualReport) JSON() (string, error) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("encode visual report: %w", err)
+	}
+	return string(data), nil
+}
+
+// visualCaptureScript screenshots each shot in its own headless Chromium
+// context at the shot's viewport, with animations and the caret disabled so
+// identical pages produce identical pixels.
+const visualCaptureScript = `const { chromium } = require('playwright');
+const request = JSON.parse(process.env.CODEFLY_VISUAL_REQUEST);
+(async () => {
+  const browser = await chromium.launch();
+  const results = [];
+  try {
+    for (const shot of request.shots) {
+      const context = await browser.newContext({
+        viewport: { width: shot.width, height: shot.height },
+        deviceScaleFactor: 1,
+        reducedMotion: 'reduce',
+      });
+      const page = await context.newPage();
+      const result = { file: shot.file };
+      try {
+        const response = await page.goto(new URL(shot.route, request.baseURL).href, { waitUntil: 'load', timeout: request.timeoutMs });
+        result.status = response ? response.status() : 0;
+        await page.waitForLoadState('networkidle', { timeout: request.timeoutMs }).catch(() => {});
+        await page.screenshot({ path: shot.file, fullPage: true, animations: 'disabled', caret: 'hide' });
+      } catch (error) {
+        result.error = String(error && error.message ? error.message : error).split('\n')[0];
+      }
+      results.push(result);
+      await context.close();
+    }
+  } finally {
+    await browser.close();
+  }
+  console.log('` + visualResultMarker + `' + JSON.stringify(results));
+})().catch((error) => {
+  console.error(error);
+  process.exit(1);
+});
+`
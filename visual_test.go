@@ -0,0 +1,150 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func solidImage(width, height int, fill color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, fill)
+		}
+	}
+	return img
+}
+
+func TestVisualShotsPlanRoutesAtEveryViewport(t *testing.T) {
+	settings := VisualSettings{
+		Routes:    []string{"/", "/blog/hello world"},
+		Viewports: []VisualViewport{{Name: "mobile", Width: 390, Height: 844}, {Name: "desktop", Width: 1280, Height: 800}},
+	}
+	shots, err := settings.shots("/src", nil)
+	require.NoError(t, err)
+	require.Len(t, shots, 4)
+	require.Equal(t, visualShot{
+		Route: "/blog/hello world", Viewport: "desktop", Width: 1280, Height: 800,
+		File:     "/src/.codefly/visual-output/actual/blog_hello_world@desktop.png",
+		baseline: "/src/.codefly/visual-baselines/blog_hello_world@desktop.png",
+		diff:     "/src/.codefly/visual-output/diff/blog_hello_world@desktop.png",
+	}, shots[3])
+	require.Equal(t, "index@mobile.png", filepath.Base(shots[0].File))
+
+	shots, err = VisualSettings{}.shots("/src", []string{"/pricing"})
+	require.NoError(t, err)
+	require.Equal(t, []visualShot{{
+		Route: "/pricing", Viewport: "desktop", Width: 1280, Height: 720,
+		File:     "/src/.codefly/visual-output/actual/pricing@desktop.png",
+		baseline: "/src/.codefly/visual-baselines/pricing@desktop.png",
+		diff:     "/src/.codefly/visual-output/diff/pricing@desktop.png",
+	}}, shots)
+
+	_, err = VisualSettings{Tolerance: 2}.shots("/src", nil)
+	require.ErrorContains(t, err, "tolerance")
+	_, err = VisualSettings{Viewports: []VisualViewport{{Name: "tablet"}}}.shots("/src", nil)
+	require.ErrorContains(t, err, "positive width and height")
+	_, err = VisualSettings{}.shots("/src", []string{"pricing"})
+	require.ErrorContains(t, err, "must be a path")
+	over := 1.5
+	_, err = VisualSettings{PixelThreshold: &over}.shots("/src", nil)
+	require.ErrorContains(t, err, "pixel-threshold")
+}
+
+func TestVisualPixelThresholdAllowsAnExactMatch(t *testing.T) {
+	require.Equal(t, defaultVisualPixelDiff, VisualSettings{}.pixelThreshold())
+	exact := 0.0
+	require.Equal(t, 0.0, VisualSettings{PixelThreshold: &exact}.pixelThreshold())
+
+	var settings VisualSettings
+	require.NoError(t, yaml.Unmarshal([]byte("pixel-threshold: 0\n"), &settings))
+	require.NotNil(t, settings.PixelThreshold)
+	require.Equal(t, 0.0, settings.pixelThreshold())
+}
+
+func TestDiffImagesCountsChangedAndMissingPixels(t *testing.T) {
+	white := color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	baseline := solidImage(10, 10, white)
+	actual := solidImage(10, 10, white)
+	actual.SetRGBA(0, 0, color.RGBA{A: 0xff})
+	actual.SetRGBA(1, 0, color.RGBA{R: 0xf8, G: 0xf8, B: 0xf8, A: 0xff}) // anti-aliasing noise
+
+	differing, total, diff := diffImages(baseline, actual, defaultVisualPixelDiff)
+	require.Equal(t, 1, differing)
+	require.Equal(t, 100, total)
+	require.Equal(t, color.RGBA{R: 0xff, A: 0xff}, diff.RGBAAt(0, 0))
+	require.NotEqual(t, color.RGBA{R: 0xff, A: 0xff}, diff.RGBAAt(1, 0))
+
+	taller := solidImage(10, 12, white)
+	differing, total, _ = diffImages(baseline, taller, defaultVisualPixelDiff)
+	require.Equal(t, 20, differing, "rows only one image has differ")
+	require.Equal(t, 120, total)
+
+	differing, _, _ = diffImages(baseline, actual, 0)
+	require.Equal(t, 2, differing, "a zero threshold counts every changed pixel")
+}
+
+func TestCompareVisualShotsAgainstBaselines(t *testing.T) {
+	source := t.TempDir()
+	settings := VisualSettings{
+		Routes:    []string{"/", "/pricing", "/new", "/broken"},
+		Tolerance: 0.02,
+	}
+	shots, err := settings.shots(source, nil)
+	require.NoError(t, err)
+	white := color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+
+	home := solidImage(10, 10, white)
+	require.NoError(t, writePNG(shots[0].baseline, home))
+	home.SetRGBA(3, 3, color.RGBA{A: 0xff}) // 1% changed, within tolerance
+	require.NoError(t, writePNG(shots[0].File, home))
+
+	require.NoError(t, writePNG(shots[1].baseline, solidImage(10, 10, white)))
+	require.NoError(t, writePNG(shots[1].File, solidImage(10, 10, color.RGBA{B: 0xff, A: 0xff})))
+
+	require.NoError(t, writePNG(shots[2].File, solidImage(10, 10, white)))
+
+	captures := []visualCapture{
+		{File: shots[0].File, Status: 200},
+		{File: shots[1].File, Status: 200},
+		{File: shots[2].File, Status: 200},
+		{File: shots[3].File, Error: "page.goto: Timeout 30000ms exceeded."},
+	}
+	report := settings.compareVisualShots(shots, captures, false)
+	require.False(t, report.Passed)
+	require.Equal(t, visualPassed, report.Results[0].Status)
+	require.Equal(t, 1, report.Results[0].DiffPixels)
+
+	pricing := report.Results[1]
+	require.Equal(t, visualFailed, pricing.Status)
+	require.Equal(t, 1.0, pricing.DiffRatio)
+	require.Equal(t, shots[1].diff, pricing.Diff)
+	require.FileExists(t, pricing.Diff)
+
+	require.Equal(t, visualMissingBaseline, report.Results[2].Status)
+	require.Equal(t, visualError, report.Results[3].Status)
+
+	evidence := report.evidence()
+	require.Len(t, evidence, 3)
+	require.Contains(t, evidence[0], "/pricing @ desktop: failed: 100 pixels (100.000%) differ, tolerance 2.000%\n  diff: ")
+	require.Contains(t, report.text(), "Visual FAILED: 3 of 4 screenshot(s)")
+
+	updated := settings.compareVisualShots(shots[:3], captures[:3], true)
+	require.True(t, updated.Passed)
+	require.Contains(t, updated.text(), "Visual baselines updated: 3")
+	accepted, err := os.ReadFile(shots[2].baseline)
+	require.NoError(t, err)
+	captured, err := os.ReadFile(shots[2].File)
+	require.NoError(t, err)
+	require.Equal(t, captured, accepted)
+
+	rerun := settings.compareVisualShots(shots[:3], captures[:3], false)
+	require.True(t, rerun.Passed)
+	require.Contains(t, rerun.text(), "Visual PASSED: 3 screenshot(s) match their baselines")
+}